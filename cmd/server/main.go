@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"doss/internal/auth"
+	"doss/internal/config"
+	"doss/internal/kms"
+	"doss/internal/lifecycle"
 	"doss/internal/metadata"
+	"doss/internal/storage"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -39,11 +46,66 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 	done <- true
 }
 
+// getLifecycleInterval reads LIFECYCLE_INTERVAL as a Go duration, such as
+// "10m". Lifecycle rules work in whole days, so hourly is plenty by default.
+func getLifecycleInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("LIFECYCLE_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return time.Hour
+	}
+	return interval
+}
+
+// getErasureParity reads ERASURE_PARITY, the number of drives a blob can
+// lose and still be read.
+func getErasureParity() int {
+	parity, err := strconv.Atoi(os.Getenv("ERASURE_PARITY"))
+	if err != nil || parity <= 0 {
+		return 2
+	}
+	return parity
+}
+
+// getRewrapInterval reads KMS_REWRAP_INTERVAL as a Go duration. A rotated
+// key keeps unsealing old data keys, so there is no hurry.
+func getRewrapInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("KMS_REWRAP_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return time.Hour
+	}
+	return interval
+}
+
 func main() {
+	rootSecret := config.RootSecretKey()
+	if rootSecret == "" {
+		log.Fatalln("ROOT_SECRET_KEY must be set outside local development (APP_ENV=local)")
+	}
 
 	srv := server.NewServer()
 	metadata.InitDB("./data")
 	defer metadata.CloseDB()
+	switch backend := config.StorageBackend(); backend {
+	case "fs":
+		storage.InitFS("./data/blobs")
+	case "dedup":
+		storage.InitDedup("./data/chunks", metadata.DB)
+	case "erasure":
+		drives := config.StorageDrives()
+		if len(drives) == 0 {
+			log.Fatalln("STORAGE_DRIVES must list the drives when STORAGE_BACKEND=erasure")
+		}
+		storage.InitErasure(drives, getErasureParity())
+	default:
+		log.Fatalf("unknown STORAGE_BACKEND %q", backend)
+	}
+	kms.InitLocal(config.KeystoreFile(), config.MasterKeyFile())
+	auth.InitKeyStore(config.RootAccessKey(), rootSecret)
+
+	lifecycleWorker := lifecycle.NewWorker(getLifecycleInterval())
+	lifecycleWorker.Start()
+	rewrapper := kms.NewRewrapper(getRewrapInterval())
+	rewrapper.Start()
 
 	// Create a done channel to signal when the shutdown is complete
 	done := make(chan bool, 1)
@@ -51,12 +113,19 @@ func main() {
 	// Run graceful shutdown in a separate goroutine
 	go gracefulShutdown(srv, done)
 
-	err := srv.ListenAndServe()
+	var err error
+	if certFile, keyFile := config.TLSCertFile(), config.TLSKeyFile(); certFile != "" && keyFile != "" {
+		err = srv.ListenAndServeTLS(certFile, keyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		panic(fmt.Sprintf("http srv error: %s", err))
 	}
 
 	// Wait for the graceful shutdown to complete
 	<-done
+	lifecycleWorker.Stop()
+	rewrapper.Stop()
 	log.Println("Graceful shutdown complete.")
 }
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"doss/internal/auth"
+	"doss/internal/metadata"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type createAccessKeyRequest struct {
+	OwnerID string `json:"owner_id"`
+}
+
+type accessKeyStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// accessKeyResponse never carries the sealed secret. SecretKey is only set
+// when a secret has just been generated.
+type accessKeyResponse struct {
+	AccessKeyID string    `json:"access_key_id"`
+	SecretKey   string    `json:"secret_key,omitempty"`
+	OwnerID     string    `json:"owner_id"`
+	Status      string    `json:"status"`
+	Created     time.Time `json:"created"`
+	LastUsed    time.Time `json:"last_used,omitzero"`
+}
+
+func newAccessKeyResponse(k *metadata.AccessKey, secret string) accessKeyResponse {
+	return accessKeyResponse{
+		AccessKeyID: k.AccessKeyID,
+		SecretKey:   secret,
+		OwnerID:     k.OwnerID,
+		Status:      k.Status,
+		Created:     k.Created,
+		LastUsed:    k.LastUsed,
+	}
+}
+
+// AccessKeyCollectionGetHandler lists every access key, or those of the
+// owner named by ?owner_id.
+func AccessKeyCollectionGetHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	keys, err := metadata.ListAccessKeys(r.URL.Query().Get("owner_id"))
+	if err != nil {
+		log.Printf("ListAccessKeys error: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+
+	resp := make([]accessKeyResponse, 0, len(keys))
+	for i := range keys {
+		resp = append(resp, newAccessKeyResponse(&keys[i], ""))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// AccessKeyCollectionPostHandler creates a key pair for an owner. The
+// response is the only place the secret is ever shown.
+func AccessKeyCollectionPostHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req createAccessKeyRequest
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.OwnerID == "" {
+		log.Printf("AccessKeyCollectionPostHandler error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+
+	k, secret, err := auth.CreateAccessKey(req.OwnerID)
+	if err != nil {
+		log.Printf("CreateAccessKey error: %v", err)
+		writeAccessKeyError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newAccessKeyResponse(k, secret))
+}
+
+func AccessKeyItemGetHandler(w http.ResponseWriter, r *http.Request) {
+	accessKeyID, ok := parseAccessKeyID(w, r)
+	if !ok {
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	k, err := metadata.GetAccessKey(accessKeyID)
+	if err != nil {
+		log.Printf("GetAccessKey error: %v", err)
+		writeAccessKeyError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAccessKeyResponse(k, ""))
+}
+
+// AccessKeyStatusPutHandler disables or re-enables a key. Requests signed
+// with an inactive key are rejected.
+func AccessKeyStatusPutHandler(w http.ResponseWriter, r *http.Request) {
+	accessKeyID, ok := parseAccessKeyID(w, r)
+	if !ok {
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req accessKeyStatusRequest
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		log.Printf("AccessKeyStatusPutHandler error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+
+	k, err := metadata.UpdateAccessKey(accessKeyID, func(k *metadata.AccessKey) error {
+		k.Status = req.Status
+		return nil
+	})
+	if err != nil {
+		log.Printf("UpdateAccessKey error: %v", err)
+		writeAccessKeyError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAccessKeyResponse(k, ""))
+}
+
+// AccessKeyRotateHandler gives a key a new secret, shown once in the
+// response. The old secret stops working at once.
+func AccessKeyRotateHandler(w http.ResponseWriter, r *http.Request) {
+	accessKeyID, ok := parseAccessKeyID(w, r)
+	if !ok {
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	k, secret, err := auth.RotateAccessKey(accessKeyID)
+	if err != nil {
+		log.Printf("RotateAccessKey error: %v", err)
+		writeAccessKeyError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAccessKeyResponse(k, secret))
+}
+
+func AccessKeyItemDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	accessKeyID, ok := parseAccessKeyID(w, r)
+	if !ok {
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	if err := metadata.DeleteAccessKey(accessKeyID); err != nil {
+		log.Printf("DeleteAccessKey error: %v", err)
+		writeAccessKeyError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeAccessKeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, metadata.ErrAccessKeyNotFound):
+		writeError(w, http.StatusNotFound, ErrAccessKeyNotFound)
+	case errors.Is(err, metadata.ErrAccessKeyExists):
+		writeError(w, http.StatusConflict, ErrAccessKeyExists)
+	case errors.Is(err, metadata.ErrInvalidAccessKey):
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+	default:
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+	}
+}
+
+func parseAccessKeyID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	k := chi.URLParam(r, "accessKeyID")
+	if k == "" {
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return "", false
+	}
+	return k, true
+}
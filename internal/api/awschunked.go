@@ -0,0 +1,273 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"doss/internal/auth"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxChunkLineSize bounds a chunk header or trailer line, which only
+	// ever holds a size, a signature or one checksum.
+	maxChunkLineSize = 4096
+	// maxChunkTrailerSize bounds all trailing headers together.
+	maxChunkTrailerSize = 16 << 10
+)
+
+// decodeStreamingBody replaces the body of an aws-chunked upload with the
+// decoded payload. Trailing headers are moved into r.Trailer as the end of
+// the body is read, which is where trailing checksums are looked up. It
+// does nothing for an ordinary body.
+func decodeStreamingBody(r *http.Request) error {
+	mode := r.Header.Get("x-amz-content-sha256")
+	signed := mode == auth.StreamingSignedPayload || mode == auth.StreamingSignedPayloadTrailer
+	if !signed && mode != auth.StreamingUnsignedTrailer {
+		return nil
+	}
+
+	decoded, err := strconv.ParseInt(r.Header.Get("x-amz-decoded-content-length"), 10, 64)
+	if err != nil || decoded < 0 {
+		return ErrMissingContentLength
+	}
+	var signer *auth.ChunkSigner
+	if signed {
+		var ok bool
+		if signer, ok = auth.ChunkSignerFromContext(r.Context()); !ok {
+			return ErrChunkSignatureRequired
+		}
+	}
+
+	// The framing is not part of the object, so neither is its encoding.
+	var encodings []string
+	for _, e := range strings.Split(r.Header.Get("Content-Encoding"), ",") {
+		if e = strings.TrimSpace(e); e != "" && e != "aws-chunked" {
+			encodings = append(encodings, e)
+		}
+	}
+	if len(encodings) > 0 {
+		r.Header.Set("Content-Encoding", strings.Join(encodings, ","))
+	} else {
+		r.Header.Del("Content-Encoding")
+	}
+
+	if r.Trailer == nil {
+		r.Trailer = make(http.Header)
+	}
+	r.Body = &chunkedReader{
+		src:         r.Body,
+		r:           bufio.NewReader(r.Body),
+		signer:      signer,
+		hash:        sha256.New(),
+		withTrailer: mode != auth.StreamingSignedPayload,
+		trailer:     r.Trailer,
+		want:        decoded,
+	}
+	r.ContentLength = decoded
+	return nil
+}
+
+// chunkedReader decodes aws-chunked framing: chunks of the form
+// "<hex size>[;chunk-signature=<sig>]\r\n<data>\r\n", ended by an empty
+// chunk and, in the trailer variants, trailing headers and a blank line.
+// A chunk is handed out as it arrives; when its signature turns out wrong
+// the read that ends it fails, so the upload is abandoned.
+type chunkedReader struct {
+	src         io.Closer
+	r           *bufio.Reader
+	signer      *auth.ChunkSigner
+	hash        hash.Hash
+	withTrailer bool
+	trailer     http.Header
+	want        int64
+
+	signature string // of the chunk being read
+	remain    int64  // bytes of the chunk still to read
+	decoded   int64
+	err       error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	for c.remain == 0 {
+		if err := c.nextChunk(); err != nil {
+			c.err = err
+			return 0, err
+		}
+	}
+
+	n, err := c.r.Read(p[:min(int64(len(p)), c.remain)])
+	c.hash.Write(p[:n])
+	c.remain -= int64(n)
+	c.decoded += int64(n)
+	if c.decoded > c.want {
+		c.err = ErrIncompleteBody
+		return 0, c.err
+	}
+	if c.remain == 0 {
+		if err := c.endChunk(); err != nil {
+			c.err = err
+			return 0, err
+		}
+	}
+	if err == io.EOF {
+		err = nil
+		if c.remain > 0 {
+			c.err = ErrIncompleteBody
+			err = c.err
+		}
+	}
+	return n, err
+}
+
+// nextChunk reads a chunk header. At the final, empty chunk it reads the
+// trailer and returns io.EOF once everything checks out.
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	sizeField, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeField, 16, 64)
+	if err != nil || size < 0 {
+		return ErrMalformedChunk
+	}
+	c.signature = ""
+	if sig, ok := strings.CutPrefix(ext, "chunk-signature="); ok {
+		c.signature = sig
+	}
+	if c.signer != nil && c.signature == "" {
+		return ErrMalformedChunk
+	}
+
+	if size > 0 {
+		c.remain = size
+		c.hash.Reset()
+		return nil
+	}
+
+	c.hash.Reset()
+	if err := c.verifyChunk(); err != nil {
+		return err
+	}
+	if c.withTrailer {
+		if err := c.readTrailer(); err != nil {
+			return err
+		}
+	} else if err := c.readCRLF(); err != nil {
+		return err
+	}
+	if c.decoded != c.want {
+		return ErrIncompleteBody
+	}
+	return io.EOF
+}
+
+func (c *chunkedReader) endChunk() error {
+	if err := c.readCRLF(); err != nil {
+		return err
+	}
+	return c.verifyChunk()
+}
+
+func (c *chunkedReader) verifyChunk() error {
+	if c.signer != nil && !c.signer.VerifyChunk(c.signature, c.hash.Sum(nil)) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// readTrailer reads "name:value" lines up to a blank line. In the signed
+// variant the last one is x-amz-trailer-signature, which covers the others.
+func (c *chunkedReader) readTrailer() error {
+	var canonical bytes.Buffer
+	signature := ""
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return ErrMalformedChunk
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "x-amz-trailer-signature" {
+			signature = value
+			continue
+		}
+		canonical.WriteString(name + ":" + value + "\n")
+		if canonical.Len() > maxChunkTrailerSize {
+			return ErrMalformedChunk
+		}
+		c.trailer.Set(textproto.CanonicalMIMEHeaderKey(name), value)
+	}
+	if c.signer != nil && !c.signer.VerifyTrailer(signature, canonical.Bytes()) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+func (c *chunkedReader) readLine() (string, error) {
+	var line []byte
+	for {
+		part, isPrefix, err := c.r.ReadLine()
+		if err == io.EOF {
+			return "", ErrIncompleteBody
+		}
+		if err != nil {
+			return "", err
+		}
+		line = append(line, part...)
+		if len(line) > maxChunkLineSize {
+			return "", ErrMalformedChunk
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+func (c *chunkedReader) readCRLF() error {
+	var crlf [2]byte
+	if _, err := io.ReadFull(c.r, crlf[:]); err != nil {
+		return ErrIncompleteBody
+	}
+	if string(crlf[:]) != "\r\n" {
+		return ErrMalformedChunk
+	}
+	return nil
+}
+
+func (c *chunkedReader) Close() error {
+	return c.src.Close()
+}
+
+// writeBodyError answers a request whose body could not be decoded or
+// stored. Only framing and signature problems are the client's fault.
+func writeBodyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrSignatureMismatch), errors.Is(err, ErrChunkSignatureRequired):
+		writeError(w, http.StatusForbidden, err)
+	case errors.Is(err, ErrMissingContentLength):
+		writeError(w, http.StatusLengthRequired, err)
+	case errors.Is(err, ErrMalformedChunk), errors.Is(err, ErrIncompleteBody),
+		errors.Is(err, auth.ErrContentSHA256Mismatch):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+	}
+}
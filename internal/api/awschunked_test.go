@@ -0,0 +1,63 @@
+package api
+
+import (
+	"doss/internal/auth"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeStreamingBody(t *testing.T) {
+	const body = "5\r\nhello\r\n7\r\n, world\r\n0\r\nx-amz-checksum-crc32:/6tyOg==\r\n\r\n"
+
+	r := httptest.NewRequest("PUT", "/b/k", strings.NewReader(body))
+	r.Header.Set("Content-Encoding", "aws-chunked,gzip")
+	r.Header.Set("x-amz-content-sha256", auth.StreamingUnsignedTrailer)
+	r.Header.Set("x-amz-decoded-content-length", "12")
+	r.Header.Set("x-amz-trailer", "x-amz-checksum-crc32")
+	if err := decodeStreamingBody(r); err != nil {
+		t.Fatalf("decodeStreamingBody: %v", err)
+	}
+	if got := r.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding = %q; want gzip", got)
+	}
+	got, err := io.ReadAll(r.Body)
+	if err != nil || string(got) != "hello, world" {
+		t.Fatalf("decoded body = %q, %v", got, err)
+	}
+	if v := r.Trailer.Get("x-amz-checksum-crc32"); v != "/6tyOg==" {
+		t.Errorf("trailer checksum = %q", v)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		length string
+		want   error
+	}{
+		{"short", "5\r\nhel", "5", ErrIncompleteBody},
+		{"length mismatch", "5\r\nhello\r\n0\r\n\r\n", "6", ErrIncompleteBody},
+		{"bad size", "zz\r\nhello\r\n0\r\n\r\n", "5", ErrMalformedChunk},
+		{"missing crlf", "5\r\nhelloXX0\r\n\r\n", "5", ErrMalformedChunk},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("PUT", "/b/k", strings.NewReader(tt.body))
+		r.Header.Set("x-amz-content-sha256", auth.StreamingUnsignedTrailer)
+		r.Header.Set("x-amz-decoded-content-length", tt.length)
+		if err := decodeStreamingBody(r); err != nil {
+			t.Fatalf("%s: decodeStreamingBody: %v", tt.name, err)
+		}
+		if _, err := io.ReadAll(r.Body); !errors.Is(err, tt.want) {
+			t.Errorf("%s: read error = %v; want %v", tt.name, err, tt.want)
+		}
+	}
+
+	r = httptest.NewRequest("PUT", "/b/k", strings.NewReader(body))
+	r.Header.Set("x-amz-content-sha256", auth.StreamingSignedPayload)
+	r.Header.Set("x-amz-decoded-content-length", "12")
+	if err := decodeStreamingBody(r); !errors.Is(err, ErrChunkSignatureRequired) {
+		t.Errorf("signed upload without SigV4: got %v; want ErrChunkSignatureRequired", err)
+	}
+}
@@ -24,12 +24,38 @@ func BucketPutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Has("encryption") {
+		handlePutBucketEncryption(w, r, ownerID, bucketName)
+		return
+	}
+
+	if r.URL.Query().Has("compression") {
+		handlePutBucketCompression(w, r, ownerID, bucketName)
+		return
+	}
+
 	if r.URL.Query().Has("notification") {
 		handlePutBucketNotification(w, r, ownerID, bucketName)
 		return
 	}
 
-	if err := metadata.CreateBucket(ownerID, bucketName); err != nil {
+	if r.URL.Query().Has("versioning") {
+		handlePutBucketVersioning(w, r, ownerID, bucketName)
+		return
+	}
+
+	if r.URL.Query().Has("object-lock") {
+		handlePutObjectLockConfig(w, r, ownerID, bucketName)
+		return
+	}
+
+	if r.URL.Query().Has("lifecycle") {
+		handlePutBucketLifecycle(w, r, ownerID, bucketName)
+		return
+	}
+
+	objectLock := r.Header.Get("x-amz-bucket-object-lock-enabled") == "true"
+	if err := metadata.CreateBucket(ownerID, bucketName, objectLock); err != nil {
 		log.Printf("CreateBucket error: %v", err)
 		if errors.Is(err, metadata.ErrBucketAlreadyExists) {
 			writeError(w, http.StatusConflict, ErrBucketAlreadyExists)
@@ -42,8 +68,8 @@ func BucketPutHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-// BucketGetHandler
-// TODO: Change to ListObjects/ListObjectsV2
+// BucketGetHandler serves the GET subresources of a bucket and otherwise
+// lists its objects, as ListObjectsV2 with list-type=2 or ListObjects (V1).
 func BucketGetHandler(w http.ResponseWriter, r *http.Request) {
 	bucketName, ok := parseBucketName(w, r)
 	if !ok {
@@ -66,6 +92,16 @@ func BucketGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Has("encryption") {
+		handleGetBucketEncryption(w, ownerID, bucketName)
+		return
+	}
+
+	if r.URL.Query().Has("compression") {
+		handleGetBucketCompression(w, ownerID, bucketName)
+		return
+	}
+
 	if r.URL.Query().Has("notification") {
 		handleGetBucketNotification(w, ownerID, bucketName)
 		return
@@ -76,7 +112,57 @@ func BucketGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusNotImplemented, nil)
+	if r.URL.Query().Has("versioning") {
+		handleGetBucketVersioning(w, ownerID, bucketName)
+		return
+	}
+
+	if r.URL.Query().Has("object-lock") {
+		handleGetObjectLockConfig(w, ownerID, bucketName)
+		return
+	}
+
+	if r.URL.Query().Has("lifecycle") {
+		handleGetBucketLifecycle(w, ownerID, bucketName)
+		return
+	}
+
+	if r.URL.Query().Has("versions") {
+		handleListObjectVersions(w, r, ownerID, bucketName)
+		return
+	}
+
+	if r.URL.Query().Has("uploads") {
+		handleListMultipartUploads(w, r, ownerID, bucketName)
+		return
+	}
+
+	if r.URL.Query().Get("list-type") == "2" {
+		handleListObjectsV2(w, r, ownerID, bucketName)
+		return
+	}
+
+	handleListObjectsV1(w, r, ownerID, bucketName)
+}
+
+func BucketPostHandler(w http.ResponseWriter, r *http.Request) {
+	bucketName, ok := parseBucketName(w, r)
+	if !ok {
+		return
+	}
+
+	ownerID := getOwnerID(r)
+	if ownerID == "" {
+		writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+		return
+	}
+
+	if r.URL.Query().Has("delete") {
+		handleDeleteObjects(w, r, ownerID, bucketName)
+		return
+	}
+
+	writeError(w, http.StatusBadRequest, ErrBadRequest)
 }
 
 func BucketListHandler(w http.ResponseWriter, r *http.Request) {
@@ -112,6 +198,21 @@ func BucketDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Has("encryption") {
+		handleDeleteBucketEncryption(w, ownerID, bucketName)
+		return
+	}
+
+	if r.URL.Query().Has("compression") {
+		handleDeleteBucketCompression(w, ownerID, bucketName)
+		return
+	}
+
+	if r.URL.Query().Has("lifecycle") {
+		handleDeleteBucketLifecycle(w, ownerID, bucketName)
+		return
+	}
+
 	if err := metadata.DeleteBucket(ownerID, bucketName); err != nil {
 		log.Printf("DeleteBucket error: %v", err)
 		writeBucketAccessError(w, err)
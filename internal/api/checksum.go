@@ -0,0 +1,254 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/md5"
+	"doss/internal/metadata"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	checksumHeaderPrefix = "x-amz-checksum-"
+	checksumModeHeader   = "x-amz-checksum-mode"
+)
+
+var checksumAlgorithms = []string{
+	metadata.ChecksumCRC32,
+	metadata.ChecksumCRC32C,
+	metadata.ChecksumSHA1,
+	metadata.ChecksumSHA256,
+}
+
+func checksumHeader(algorithm string) string {
+	return checksumHeaderPrefix + strings.ToLower(algorithm)
+}
+
+// uploadChecksum checks the data of a PutObject or UploadPart against the
+// digests the client sent: Content-MD5 and at most one x-amz-checksum-*
+// value, given either as a header or as a trailer after the body.
+type uploadChecksum struct {
+	contentMD5 []byte
+	algorithm  string
+	expected   string
+	// trailer, when set, looks the expected value up once the body has
+	// been read.
+	trailer func() string
+	hash    hash.Hash
+}
+
+func parseUploadChecksum(r *http.Request) (*uploadChecksum, error) {
+	uc := &uploadChecksum{}
+
+	if v := r.Header.Get("Content-MD5"); v != "" {
+		raw, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(raw) != md5.Size {
+			return nil, ErrInvalidDigest
+		}
+		uc.contentMD5 = raw
+	}
+
+	for _, algorithm := range checksumAlgorithms {
+		v := r.Header.Get(checksumHeader(algorithm))
+		if v == "" {
+			continue
+		}
+		if uc.algorithm != "" {
+			return nil, ErrInvalidChecksum
+		}
+		uc.algorithm, uc.expected = algorithm, v
+	}
+
+	if name := r.Header.Get("x-amz-trailer"); name != "" {
+		algorithm, ok := strings.CutPrefix(strings.ToLower(name), checksumHeaderPrefix)
+		algorithm = strings.ToUpper(algorithm)
+		if !ok || !metadata.ValidChecksumAlgorithm(algorithm) || uc.algorithm != "" {
+			return nil, ErrInvalidChecksum
+		}
+		uc.algorithm = algorithm
+		uc.trailer = func() string { return r.Trailer.Get(name) }
+	}
+
+	if algorithm := r.Header.Get("x-amz-sdk-checksum-algorithm"); algorithm != "" {
+		if uc.algorithm == "" || !strings.EqualFold(algorithm, uc.algorithm) {
+			return nil, ErrInvalidChecksum
+		}
+	}
+
+	if uc.algorithm != "" {
+		uc.hash = metadata.NewChecksumHash(uc.algorithm)
+		if uc.trailer == nil && !checksumLengthValid(uc.hash, uc.expected) {
+			return nil, ErrInvalidChecksum
+		}
+	}
+	return uc, nil
+}
+
+func checksumLengthValid(h hash.Hash, value string) bool {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	return err == nil && len(raw) == h.Size()
+}
+
+// compute makes sure a checksum in algorithm is taken even if the client
+// did not send one. It fails if the client sent a different one.
+func (uc *uploadChecksum) compute(algorithm string) error {
+	if algorithm == "" {
+		return nil
+	}
+	if uc.algorithm == "" {
+		uc.algorithm = algorithm
+		uc.hash = metadata.NewChecksumHash(algorithm)
+		return nil
+	}
+	if uc.algorithm != algorithm {
+		return ErrInvalidChecksum
+	}
+	return nil
+}
+
+// wrap returns r with the checksum taken as it is read.
+func (uc *uploadChecksum) wrap(r io.Reader) io.Reader {
+	if uc.hash == nil {
+		return r
+	}
+	return io.TeeReader(r, uc.hash)
+}
+
+// verify compares the digests with the blob that was stored from the
+// wrapped reader, and returns the checksum to keep with the data.
+func (uc *uploadChecksum) verify(blob *storedBlob) (*metadata.ObjectChecksum, error) {
+	if uc.contentMD5 != nil && hex.EncodeToString(uc.contentMD5) != blob.etag {
+		return nil, ErrBadDigest
+	}
+	if uc.hash == nil {
+		return nil, nil
+	}
+
+	value := base64.StdEncoding.EncodeToString(uc.hash.Sum(nil))
+	expected := uc.expected
+	if uc.trailer != nil {
+		if expected = uc.trailer(); expected == "" {
+			return nil, ErrInvalidChecksum
+		}
+	}
+	if expected != "" && expected != value {
+		return nil, ErrBadDigest
+	}
+	return &metadata.ObjectChecksum{Algorithm: uc.algorithm, Value: value}, nil
+}
+
+// requestedChecksumAlgorithm reads x-amz-checksum-algorithm, which asks
+// for a checksum to be computed by the server on CreateMultipartUpload and
+// CopyObject.
+func requestedChecksumAlgorithm(r *http.Request) (string, error) {
+	algorithm := strings.ToUpper(r.Header.Get("x-amz-checksum-algorithm"))
+	if algorithm != "" && !metadata.ValidChecksumAlgorithm(algorithm) {
+		return "", ErrInvalidChecksum
+	}
+	return algorithm, nil
+}
+
+// xmlChecksum is embedded in S3 XML bodies that carry a checksum, which S3
+// spells as one element per algorithm.
+type xmlChecksum struct {
+	ChecksumCRC32  string `xml:"ChecksumCRC32,omitempty"`
+	ChecksumCRC32C string `xml:"ChecksumCRC32C,omitempty"`
+	ChecksumSHA1   string `xml:"ChecksumSHA1,omitempty"`
+	ChecksumSHA256 string `xml:"ChecksumSHA256,omitempty"`
+}
+
+func newXMLChecksum(checksum *metadata.ObjectChecksum) xmlChecksum {
+	var x xmlChecksum
+	if checksum == nil {
+		return x
+	}
+	switch checksum.Algorithm {
+	case metadata.ChecksumCRC32:
+		x.ChecksumCRC32 = checksum.Value
+	case metadata.ChecksumCRC32C:
+		x.ChecksumCRC32C = checksum.Value
+	case metadata.ChecksumSHA1:
+		x.ChecksumSHA1 = checksum.Value
+	case metadata.ChecksumSHA256:
+		x.ChecksumSHA256 = checksum.Value
+	}
+	return x
+}
+
+func (x xmlChecksum) value() string {
+	return cmp.Or(x.ChecksumCRC32, x.ChecksumCRC32C, x.ChecksumSHA1, x.ChecksumSHA256)
+}
+
+// setChecksumHeader reports a stored checksum, as on upload responses and
+// on reads with x-amz-checksum-mode: ENABLED.
+func setChecksumHeader(w http.ResponseWriter, checksum *metadata.ObjectChecksum) {
+	if checksum != nil {
+		w.Header().Set(checksumHeader(checksum.Algorithm), checksum.Value)
+	}
+}
+
+func checksumModeEnabled(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(checksumModeHeader), "ENABLED")
+}
+
+// verifyReader checks a whole blob against the MD5 it was stored with as
+// it is streamed back. The last bytes are held back on a mismatch, so a
+// client sees a truncated response rather than silently corrupt data.
+type verifyReader struct {
+	io.ReadCloser
+	blobID  string
+	hash    hash.Hash
+	want    []byte
+	etagKey []byte
+	remain  int64
+}
+
+// newVerifyReader returns rc unchanged when etag is not a plain MD5.
+// etagKey is the data key of an SSE-C blob, whose ETag is
+// customerKeyETag of the MD5.
+func newVerifyReader(rc io.ReadCloser, blobID string, etag string, etagKey []byte, size int64) io.ReadCloser {
+	want, err := hex.DecodeString(etag)
+	if err != nil || len(want) != md5.Size {
+		return rc
+	}
+	return &verifyReader{ReadCloser: rc, blobID: blobID, hash: md5.New(), want: want, etagKey: etagKey, remain: size}
+}
+
+func (v *verifyReader) Read(p []byte) (int, error) {
+	if v.remain == 0 {
+		return 0, v.check()
+	}
+	if int64(len(p)) > v.remain {
+		p = p[:v.remain]
+	}
+	n, err := v.ReadCloser.Read(p)
+	v.hash.Write(p[:n])
+	v.remain -= int64(n)
+	if v.remain == 0 {
+		if err := v.check(); err != io.EOF {
+			return 0, err
+		}
+		return n, nil
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (v *verifyReader) check() error {
+	sum := v.hash.Sum(nil)
+	if v.etagKey != nil {
+		sum = customerKeyETag(v.etagKey, sum)
+	}
+	if !bytes.Equal(sum, v.want) {
+		return fmt.Errorf("blob %s: %w", v.blobID, ErrDataCorrupted)
+	}
+	return io.EOF
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadChecksum(t *testing.T) {
+	body := []byte("hello, checksums")
+	sum := md5.Sum(body)
+	crcValue := base64.StdEncoding.EncodeToString(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(body)))
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    error
+	}{
+		{"none", nil, nil},
+		{"content-md5", map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(sum[:])}, nil},
+		{"bad content-md5", map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(make([]byte, 16))}, ErrBadDigest},
+		{"crc32", map[string]string{"x-amz-checksum-crc32": crcValue}, nil},
+		{"bad crc32", map[string]string{"x-amz-checksum-crc32": "AAAAAA=="}, ErrBadDigest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("PUT", "/b/k", bytes.NewReader(body))
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		uc, err := parseUploadChecksum(r)
+		if err != nil {
+			t.Fatalf("%s: parseUploadChecksum: %v", tt.name, err)
+		}
+		if _, err := io.ReadAll(uc.wrap(r.Body)); err != nil {
+			t.Fatal(err)
+		}
+		checksum, err := uc.verify(&storedBlob{etag: hex.EncodeToString(sum[:])})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: verify = %v; want %v", tt.name, err, tt.want)
+		}
+		if tt.name == "crc32" && (checksum == nil || checksum.Value != crcValue) {
+			t.Errorf("%s: stored checksum = %+v; want %s", tt.name, checksum, crcValue)
+		}
+	}
+
+	r := httptest.NewRequest("PUT", "/b/k", nil)
+	r.Header.Set("x-amz-checksum-crc32", crcValue)
+	r.Header.Set("x-amz-checksum-sha256", crcValue)
+	if _, err := parseUploadChecksum(r); !errors.Is(err, ErrInvalidChecksum) {
+		t.Errorf("two checksums: got %v; want ErrInvalidChecksum", err)
+	}
+}
+
+func TestVerifyReader(t *testing.T) {
+	data := []byte(strings.Repeat("stored data ", 1000))
+	sum := md5.Sum(data)
+	etag := hex.EncodeToString(sum[:])
+
+	rc := newVerifyReader(io.NopCloser(bytes.NewReader(data)), "blob", etag, nil, int64(len(data)))
+	if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("intact read = %d bytes, %v", len(got), err)
+	}
+
+	corrupt := bytes.Clone(data)
+	corrupt[len(corrupt)-1] ^= 1
+	rc = newVerifyReader(io.NopCloser(bytes.NewReader(corrupt)), "blob", etag, nil, int64(len(data)))
+	got, err := io.ReadAll(rc)
+	if !errors.Is(err, ErrDataCorrupted) {
+		t.Fatalf("corrupt read: got %v; want ErrDataCorrupted", err)
+	}
+	if len(got) >= len(data) {
+		t.Errorf("corrupt read returned all %d bytes; want the tail held back", len(got))
+	}
+
+	// An SSE-C blob is checked against its masked ETag.
+	dataKey := bytes.Repeat([]byte{7}, 32)
+	masked := hex.EncodeToString(customerKeyETag(dataKey, sum[:]))
+	rc = newVerifyReader(io.NopCloser(bytes.NewReader(data)), "blob", masked, dataKey, int64(len(data)))
+	if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("intact SSE-C read = %d bytes, %v", len(got), err)
+	}
+	rc = newVerifyReader(io.NopCloser(bytes.NewReader(corrupt)), "blob", masked, dataKey, int64(len(data)))
+	if _, err := io.ReadAll(rc); !errors.Is(err, ErrDataCorrupted) {
+		t.Fatalf("corrupt SSE-C read: got %v; want ErrDataCorrupted", err)
+	}
+	// The plain MD5 would reveal the plaintext's digest, so it is never
+	// accepted for an SSE-C blob.
+	rc = newVerifyReader(io.NopCloser(bytes.NewReader(data)), "blob", etag, dataKey, int64(len(data)))
+	if _, err := io.ReadAll(rc); !errors.Is(err, ErrDataCorrupted) {
+		t.Fatalf("SSE-C read against the plain MD5: got %v; want ErrDataCorrupted", err)
+	}
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"doss/internal/metadata"
+	"errors"
+)
+
+// objectCompression returns the codec a new object should be compressed
+// with under its bucket's settings, or "" to store it as uploaded.
+func objectCompression(ownerID string, bucketName string, key string, contentType string) (string, error) {
+	cfg, err := metadata.GetBucketCompression(ownerID, bucketName)
+	if errors.Is(err, metadata.ErrCompressionConfigNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !cfg.Matches(key, contentType) {
+		return "", nil
+	}
+	return cfg.Algorithm, nil
+}
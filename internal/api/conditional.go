@@ -0,0 +1,101 @@
+package api
+
+import (
+	"doss/internal/metadata"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// checkPreconditions evaluates If-Match, If-Unmodified-Since, If-None-Match
+// and If-Modified-Since in the order RFC 9110 prescribes. It returns 0 when
+// the request may proceed, otherwise the status to reply with.
+func checkPreconditions(r *http.Request, etag string, lastModified time.Time) int {
+	status := evaluatePreconditions(
+		r.Header.Get("If-Match"),
+		r.Header.Get("If-Unmodified-Since"),
+		r.Header.Get("If-None-Match"),
+		r.Header.Get("If-Modified-Since"),
+		etag, lastModified,
+	)
+	if status == http.StatusNotModified {
+		return notModifiedStatus(r)
+	}
+	return status
+}
+
+// checkCopySourcePreconditions applies the x-amz-copy-source-if-* headers
+// to the source of a copy. A copy never answers 304: any failed condition
+// is a 412.
+func checkCopySourcePreconditions(r *http.Request, etag string, lastModified time.Time) int {
+	status := evaluatePreconditions(
+		r.Header.Get("x-amz-copy-source-if-match"),
+		r.Header.Get("x-amz-copy-source-if-unmodified-since"),
+		r.Header.Get("x-amz-copy-source-if-none-match"),
+		r.Header.Get("x-amz-copy-source-if-modified-since"),
+		etag, lastModified,
+	)
+	if status != 0 {
+		return http.StatusPreconditionFailed
+	}
+	return 0
+}
+
+func evaluatePreconditions(ifMatch, ifUnmodifiedSince, ifNoneMatch, ifModifiedSince string, etag string, lastModified time.Time) int {
+	lastModified = lastModified.Truncate(time.Second)
+
+	if ifMatch != "" {
+		if !etagMatches(ifMatch, etag) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ifUnmodifiedSince != "" {
+		if t, err := http.ParseTime(ifUnmodifiedSince); err == nil && lastModified.After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch != "" {
+		if etagMatches(ifNoneMatch, etag) {
+			return http.StatusNotModified
+		}
+	} else if ifModifiedSince != "" {
+		if t, err := http.ParseTime(ifModifiedSince); err == nil && !lastModified.After(t) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+func notModifiedStatus(r *http.Request) int {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return http.StatusNotModified
+	}
+	return http.StatusPreconditionFailed
+}
+
+// etagMatches reports whether the comma separated list in header names etag.
+// Weak validators compare equal to their strong form, as S3 does.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if strings.Trim(candidate, `"`) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writePreconditionStatus finishes a request that failed checkPreconditions.
+// A 304 still carries the validators so caches can refresh their entry.
+func writePreconditionStatus(w http.ResponseWriter, status int, meta *metadata.ObjectMeta) {
+	if status == http.StatusNotModified {
+		w.Header().Set("ETag", quoteETag(meta.ETag))
+		w.Header().Set("Last-Modified", meta.LastModified.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(status)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckPreconditions(t *testing.T) {
+	const etag = "abc"
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	at := modified.Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    int
+	}{
+		{"none", "GET", nil, 0},
+		{"if-match", "GET", map[string]string{"If-Match": `"abc"`}, 0},
+		{"if-match list", "GET", map[string]string{"If-Match": `"x", W/"abc"`}, 0},
+		{"if-match star", "GET", map[string]string{"If-Match": "*"}, 0},
+		{"if-match fails", "GET", map[string]string{"If-Match": `"x"`}, http.StatusPreconditionFailed},
+		{"if-none-match", "GET", map[string]string{"If-None-Match": `"abc"`}, http.StatusNotModified},
+		{"if-none-match on put", "PUT", map[string]string{"If-None-Match": "*"}, http.StatusPreconditionFailed},
+		{"if-none-match differs", "GET", map[string]string{"If-None-Match": `"x"`}, 0},
+		{"if-modified-since", "GET", map[string]string{"If-Modified-Since": before}, 0},
+		{"not modified since", "GET", map[string]string{"If-Modified-Since": at}, http.StatusNotModified},
+		{"if-unmodified-since", "GET", map[string]string{"If-Unmodified-Since": after}, 0},
+		{"modified since", "GET", map[string]string{"If-Unmodified-Since": before}, http.StatusPreconditionFailed},
+		{"bad date ignored", "GET", map[string]string{"If-Unmodified-Since": "yesterday"}, 0},
+		// If-Match wins over If-Unmodified-Since, and If-None-Match over
+		// If-Modified-Since.
+		{"if-match over unmodified-since", "GET", map[string]string{"If-Match": `"abc"`, "If-Unmodified-Since": before}, 0},
+		{"if-none-match over modified-since", "GET", map[string]string{"If-None-Match": `"x"`, "If-Modified-Since": at}, 0},
+		// A failed If-Match is reported before a matching If-None-Match.
+		{"412 before 304", "GET", map[string]string{"If-Match": `"x"`, "If-None-Match": `"abc"`}, http.StatusPreconditionFailed},
+		{"if-match then 304", "GET", map[string]string{"If-Match": `"abc"`, "If-None-Match": `"abc"`}, http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/bucket/key", nil)
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		if got := checkPreconditions(r, etag, modified.Add(500*time.Millisecond)); got != tt.want {
+			t.Errorf("%s: checkPreconditions = %d; want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCopySourcePreconditions(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	r := httptest.NewRequest("PUT", "/bucket/copy", nil)
+	r.Header.Set("x-amz-copy-source-if-none-match", `"abc"`)
+	if got := checkCopySourcePreconditions(r, "abc", modified); got != http.StatusPreconditionFailed {
+		t.Errorf("matching if-none-match = %d; want 412", got)
+	}
+	r.Header.Set("x-amz-copy-source-if-none-match", `"x"`)
+	if got := checkCopySourcePreconditions(r, "abc", modified); got != 0 {
+		t.Errorf("differing if-none-match = %d; want 0", got)
+	}
+}
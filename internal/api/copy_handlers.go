@@ -0,0 +1,374 @@
+package api
+
+import (
+	"doss/internal/metadata"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type copyObjectResponse struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+	xmlChecksum
+}
+
+type copyPartResponse struct {
+	XMLName      xml.Name `xml:"CopyPartResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+	xmlChecksum
+}
+
+type copySource struct {
+	bucket     string
+	key        string
+	versionID  string
+	hasVersion bool
+}
+
+// parseCopySource reads x-amz-copy-source, which names the source as a
+// URL-encoded "bucket/key" with an optional leading slash and an optional
+// "?versionId=" suffix.
+func parseCopySource(r *http.Request) (*copySource, bool) {
+	raw, query, _ := strings.Cut(r.Header.Get("x-amz-copy-source"), "?")
+	decoded, err := url.PathUnescape(raw)
+	if err != nil {
+		return nil, false
+	}
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(decoded, "/"), "/")
+	if !ok || bucket == "" || key == "" {
+		return nil, false
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, false
+	}
+	return &copySource{
+		bucket:     bucket,
+		key:        key,
+		versionID:  params.Get("versionId"),
+		hasVersion: params.Has("versionId"),
+	}, true
+}
+
+// loadCopySource resolves the source object, which goes through the same
+// ownership checks as a GET, and applies the copy-source conditions.
+func loadCopySource(w http.ResponseWriter, r *http.Request, ownerID string) (*metadata.ObjectMeta, bool) {
+	src, ok := parseCopySource(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+		return nil, false
+	}
+
+	var meta *metadata.ObjectMeta
+	var err error
+	if src.hasVersion {
+		meta, err = metadata.GetObjectVersion(ownerID, src.bucket, src.key, src.versionID)
+	} else {
+		meta, err = metadata.GetObject(ownerID, src.bucket, src.key)
+	}
+	if err != nil {
+		log.Printf("GetObject (copy source) error: %v", err)
+		writeObjectAccessError(w, err)
+		return nil, false
+	}
+	if meta.IsDeleteMarker {
+		// S3 rejects a delete marker as a copy source.
+		writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+		return nil, false
+	}
+	if status := checkCopySourcePreconditions(r, meta.ETag, meta.LastModified); status != 0 {
+		writeError(w, status, ErrPreconditionFailed)
+		return nil, false
+	}
+	if meta.VersionID != "" {
+		w.Header().Set("x-amz-copy-source-version-id", meta.VersionID)
+	}
+	return meta, true
+}
+
+// requestsNewEncoding reports whether a copy asks for server-side
+// encryption or a checksum. Either one changes how an object is stored, so
+// it may be copied onto itself to apply them.
+func requestsNewEncoding(r *http.Request) bool {
+	for name := range r.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-server-side-encryption") || strings.HasPrefix(name, checksumHeaderPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func handleCopyObject(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	directive := r.Header.Get("x-amz-metadata-directive")
+	if directive != "" && directive != "COPY" && directive != "REPLACE" {
+		writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+		return
+	}
+	taggingDirective := r.Header.Get("x-amz-tagging-directive")
+	if taggingDirective != "" && taggingDirective != "COPY" && taggingDirective != "REPLACE" {
+		writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+		return
+	}
+	tags, ok := parseTaggingHeader(w, r)
+	if !ok {
+		return
+	}
+
+	retention, legalHold, ok := parseObjectLockHeaders(w, r)
+	if !ok {
+		return
+	}
+	checksumAlgorithm, err := requestedChecksumAlgorithm(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	encryption, dataKey, ok := newObjectEncryption(w, r, ownerID, bucketName)
+	if !ok {
+		return
+	}
+
+	src, ok := loadCopySource(w, r, ownerID)
+	if !ok {
+		return
+	}
+	if taggingDirective != "REPLACE" {
+		tags = src.Tags
+	}
+	if src.Bucket == bucketName && src.Key == key && directive != "REPLACE" && taggingDirective != "REPLACE" && !requestsNewEncoding(r) {
+		// S3 refuses a self-copy that would change nothing.
+		writeError(w, http.StatusBadRequest, ErrInvalidCopyRequest)
+		return
+	}
+
+	if err := metadata.HeadBucket(ownerID, bucketName); err != nil {
+		log.Printf("HeadBucket error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	srcKey, err := objectDataKey(r, src.Encryption, sseCopyCustomerPrefix)
+	if err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+
+	contentType, headers := src.ContentType, src.ObjectHeaders
+	if directive == "REPLACE" {
+		contentType = r.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = defaultContentType
+		}
+		if headers, ok = parseObjectHeaders(w, r); !ok {
+			return
+		}
+	}
+	// The copy follows the destination bucket's compression settings, not
+	// the source's.
+	compression, err := objectCompression(ownerID, bucketName, key, contentType)
+	if err != nil {
+		log.Printf("GetBucketCompression error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	// The copy keeps a checksum in the source's algorithm unless another
+	// is asked for. It is taken afresh, since the checksum of a multipart
+	// source does not describe a single-blob copy.
+	var checksum uploadChecksum
+	if checksumAlgorithm == "" && src.Checksum != nil {
+		checksumAlgorithm = src.Checksum.Algorithm
+	}
+	if err := checksum.compute(checksumAlgorithm); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rc, err := openObject(src, srcKey, 0, src.Size)
+	if err != nil {
+		log.Printf("CopyObject storage error: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+	blob, err := storeBlob(checksum.wrap(rc), dataKey, compression)
+	rc.Close()
+	if err != nil {
+		log.Printf("CopyObject storage error: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+	objectChecksum, err := checksum.verify(blob)
+	if err != nil {
+		log.Printf("CopyObject checksum error: %v", err)
+		releaseBlob(blob.id)
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+
+	meta := metadata.ObjectMeta{
+		Bucket:        bucketName,
+		Key:           key,
+		Size:          blob.size,
+		ETag:          blob.objectETag(encryption, dataKey),
+		ContentType:   contentType,
+		LastModified:  time.Now().UTC(),
+		OwnerID:       ownerID,
+		BlobID:        blob.id,
+		FrameIndex:    blob.frameIndex,
+		Retention:     retention,
+		LegalHold:     legalHold,
+		Encryption:    encryption,
+		Compression:   compression,
+		Checksum:      objectChecksum,
+		Tags:          tags,
+		ObjectHeaders: headers,
+	}
+
+	prev, err := metadata.PutObject(ownerID, &meta)
+	if err != nil {
+		log.Printf("PutObject (copy) error: %v", err)
+		releaseBlob(blob.id)
+		writeObjectAccessError(w, err)
+		return
+	}
+	if prev != nil {
+		releaseObject(prev)
+	}
+
+	if meta.VersionID != "" {
+		w.Header().Set("x-amz-version-id", meta.VersionID)
+	}
+	setEncryptionHeaders(w, r, meta.Encryption)
+	writeXML(w, http.StatusOK, copyObjectResponse{
+		Xmlns:        s3XMLNamespace,
+		LastModified: meta.LastModified.Format(s3TimeFormat),
+		ETag:         quoteETag(meta.ETag),
+		xmlChecksum:  newXMLChecksum(meta.Checksum),
+	})
+}
+
+func handleUploadPartCopy(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	uploadID := r.URL.Query().Get("uploadId")
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > metadata.MaxPartNumber {
+		writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+		return
+	}
+
+	upload, err := metadata.GetMultipartUpload(ownerID, bucketName, key, uploadID)
+	if err != nil {
+		log.Printf("GetMultipartUpload error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+	dataKey, err := objectDataKey(r, upload.Encryption, sseCustomerPrefix)
+	if err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+
+	src, ok := loadCopySource(w, r, ownerID)
+	if !ok {
+		return
+	}
+
+	offset, length := int64(0), src.Size
+	if h := r.Header.Get("x-amz-copy-source-range"); h != "" {
+		rng, ok := parseCopySourceRange(h, src.Size)
+		if !ok {
+			writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+			return
+		}
+		offset, length = rng.start, rng.length
+	}
+
+	srcKey, err := objectDataKey(r, src.Encryption, sseCopyCustomerPrefix)
+	if err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+	var checksum uploadChecksum
+	checksum.compute(upload.ChecksumAlgorithm)
+
+	rc, err := openObject(src, srcKey, offset, length)
+	if err != nil {
+		log.Printf("UploadPartCopy storage error: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+	blob, err := storeBlob(checksum.wrap(rc), dataKey, upload.Compression)
+	rc.Close()
+	if err != nil {
+		log.Printf("UploadPartCopy storage error: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+	partChecksum, err := checksum.verify(blob)
+	if err != nil {
+		log.Printf("UploadPartCopy checksum error: %v", err)
+		releaseBlob(blob.id)
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+
+	part := metadata.PartMeta{
+		Number:       partNumber,
+		BlobID:       blob.id,
+		Size:         blob.size,
+		ETag:         blob.objectETag(upload.Encryption, dataKey),
+		LastModified: time.Now().UTC(),
+		FrameIndex:   blob.frameIndex,
+		Checksum:     partChecksum,
+	}
+
+	prev, err := metadata.PutPart(ownerID, bucketName, key, uploadID, &part)
+	if err != nil {
+		log.Printf("PutPart (copy) error: %v", err)
+		releaseBlob(blob.id)
+		writeObjectAccessError(w, err)
+		return
+	}
+	if prev != nil {
+		releaseBlob(prev.BlobID)
+	}
+
+	setEncryptionHeaders(w, r, upload.Encryption)
+	writeXML(w, http.StatusOK, copyPartResponse{
+		Xmlns:        s3XMLNamespace,
+		LastModified: part.LastModified.Format(s3TimeFormat),
+		ETag:         quoteETag(part.ETag),
+		xmlChecksum:  newXMLChecksum(part.Checksum),
+	})
+}
+
+// parseCopySourceRange is stricter than parseRange: the copy-source range
+// must be an explicit "bytes=first-last" inside the source object.
+func parseCopySourceRange(header string, size int64) (*byteRange, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, false
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return nil, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, false
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start || end >= size {
+		return nil, false
+	}
+	return &byteRange{start: start, length: end - start + 1}, true
+}
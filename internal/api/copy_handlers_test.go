@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"testing"
+)
+
+func TestParseCopySourceRange(t *testing.T) {
+	tests := []struct {
+		header string
+		want   *byteRange
+	}{
+		{"bytes=0-9", &byteRange{0, 10}},
+		{"bytes=5-5", &byteRange{5, 1}},
+		{"bytes=90-99", &byteRange{90, 10}},
+		// Unlike a GET Range, a copy range must be explicit and lie
+		// within the source.
+		{"bytes=90-100", nil},
+		{"bytes=100-100", nil},
+		{"bytes=10-", nil},
+		{"bytes=-10", nil},
+		{"bytes=9-0", nil},
+		{"bytes=0-9,20-29", nil},
+		{"0-9", nil},
+	}
+	for _, tt := range tests {
+		got, ok := parseCopySourceRange(tt.header, 100)
+		if ok != (tt.want != nil) || (ok && *got != *tt.want) {
+			t.Errorf("parseCopySourceRange(%q) = %+v, %v; want %+v", tt.header, got, ok, tt.want)
+		}
+	}
+}
+
+func TestCopyObject(t *testing.T) {
+	s := newTestServer(t)
+	resp, body := s.do("PUT", "/copies", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	resp, body = s.do("PUT", "/copies/src", "0123456789", map[string]string{"x-amz-meta-color": "blue"})
+	s.mustStatus(resp, body, http.StatusOK)
+
+	resp, body = s.do("PUT", "/copies/dst", "", map[string]string{"x-amz-copy-source": "/copies/src"})
+	s.mustStatus(resp, body, http.StatusOK)
+	resp, body = s.do("GET", "/copies/dst", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if body != "0123456789" {
+		t.Errorf("copy = %q", body)
+	}
+
+	// Copying an object onto itself must change something.
+	resp, body = s.do("PUT", "/copies/src", "", map[string]string{"x-amz-copy-source": "/copies/src"})
+	s.mustStatus(resp, body, http.StatusBadRequest)
+	resp, body = s.do("PUT", "/copies/src", "", map[string]string{
+		"x-amz-copy-source":        "copies/src",
+		"x-amz-metadata-directive": "COPY",
+	})
+	s.mustStatus(resp, body, http.StatusBadRequest)
+	resp, body = s.do("PUT", "/copies/src", "", map[string]string{
+		"x-amz-copy-source":        "/copies/src",
+		"x-amz-metadata-directive": "REPLACE",
+		"x-amz-meta-color":         "red",
+	})
+	s.mustStatus(resp, body, http.StatusOK)
+	resp, body = s.do("HEAD", "/copies/src", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if got := resp.Header.Get("x-amz-meta-color"); got != "red" {
+		t.Errorf("self-copy with REPLACE: color = %q; want red", got)
+	}
+
+	// Asking for encryption or a checksum is a change too.
+	resp, body = s.do("PUT", "/copies/src", "", map[string]string{
+		"x-amz-copy-source":            "/copies/src",
+		"x-amz-server-side-encryption": "AES256",
+	})
+	s.mustStatus(resp, body, http.StatusOK)
+	if got := resp.Header.Get("x-amz-server-side-encryption"); got != "AES256" {
+		t.Errorf("self-copy with encryption: encryption %q; want AES256", got)
+	}
+	resp, body = s.do("PUT", "/copies/src", "", map[string]string{
+		"x-amz-copy-source":        "/copies/src",
+		"x-amz-checksum-algorithm": "SHA256",
+	})
+	s.mustStatus(resp, body, http.StatusOK)
+
+	resp, body = s.do("PUT", "/copies/dst", "", map[string]string{"x-amz-copy-source": "/copies/missing"})
+	s.mustStatus(resp, body, http.StatusNotFound)
+
+	// The source version is only reported once the copy goes ahead.
+	resp, body = s.do("PUT", "/copies?versioning", `{"status":"Enabled"}`, nil)
+	s.mustStatus(resp, body, http.StatusNoContent)
+	resp, body = s.do("PUT", "/copies/versioned", "v", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	versionID := resp.Header.Get("x-amz-version-id")
+	resp, body = s.do("PUT", "/copies/dst", "", map[string]string{
+		"x-amz-copy-source":          "/copies/versioned",
+		"x-amz-copy-source-if-match": `"nope"`,
+	})
+	s.mustStatus(resp, body, http.StatusPreconditionFailed)
+	if got := resp.Header.Get("x-amz-copy-source-version-id"); got != "" {
+		t.Errorf("failed copy reports source version %q", got)
+	}
+	resp, body = s.do("PUT", "/copies/dst", "", map[string]string{"x-amz-copy-source": "/copies/versioned"})
+	s.mustStatus(resp, body, http.StatusOK)
+	if got := resp.Header.Get("x-amz-copy-source-version-id"); got != versionID || got == "" {
+		t.Errorf("copy reports source version %q; want %q", got, versionID)
+	}
+}
+
+func TestUploadPartCopyRange(t *testing.T) {
+	s := newTestServer(t)
+	resp, body := s.do("PUT", "/parts", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	resp, body = s.do("PUT", "/parts/src", "0123456789", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+
+	resp, body = s.do("POST", "/parts/dst?uploads", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	uploadID := uploadIDOf(t, body)
+	copyPart := func(rng string) (*http.Response, string) {
+		t.Helper()
+		return s.do("PUT", "/parts/dst?partNumber=1&uploadId="+uploadID, "", map[string]string{
+			"x-amz-copy-source":       "/parts/src",
+			"x-amz-copy-source-range": rng,
+		})
+	}
+
+	for _, rng := range []string{"bytes=5-10", "bytes=10-10", "bytes=3-", "bytes=4-2"} {
+		resp, body := copyPart(rng)
+		s.mustStatus(resp, body, http.StatusBadRequest)
+	}
+	resp, body = copyPart("bytes=2-5")
+	s.mustStatus(resp, body, http.StatusOK)
+	var part copyPartResponse
+	if err := xml.Unmarshal([]byte(body), &part); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+
+	complete := "<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>" + part.ETag + "</ETag></Part></CompleteMultipartUpload>"
+	resp, body = s.do("POST", "/parts/dst?uploadId="+uploadID, complete, nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	resp, body = s.do("GET", "/parts/dst", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if body != "2345" {
+		t.Errorf("ranged part copy = %q; want 2345", body)
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"crypto/md5"
+	"doss/internal/metadata"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+)
+
+const (
+	maxDeleteObjects = 1000
+	// maxDeleteBodySize fits 1000 keys of the longest allowed length.
+	maxDeleteBodySize = 2 << 20
+)
+
+type deleteObjectsRequest struct {
+	XMLName xml.Name `xml:"Delete"`
+	Quiet   bool     `xml:"Quiet"`
+	Objects []struct {
+		Key       string `xml:"Key"`
+		VersionID string `xml:"VersionId"`
+	} `xml:"Object"`
+}
+
+type deleteObjectsResponse struct {
+	XMLName xml.Name            `xml:"DeleteResult"`
+	Xmlns   string              `xml:"xmlns,attr"`
+	Deleted []deletedObjectItem `xml:"Deleted"`
+	Errors  []deleteErrorItem   `xml:"Error"`
+}
+
+type deletedObjectItem struct {
+	Key                   string `xml:"Key"`
+	VersionID             string `xml:"VersionId,omitempty"`
+	DeleteMarker          bool   `xml:"DeleteMarker,omitempty"`
+	DeleteMarkerVersionID string `xml:"DeleteMarkerVersionId,omitempty"`
+}
+
+type deleteErrorItem struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId,omitempty"`
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
+}
+
+// handleDeleteObjects deletes up to 1000 keys in one request. Each key is
+// deleted exactly as a single DELETE would, so a failure on one key, such
+// as an object lock, is reported for that key alone.
+func handleDeleteObjects(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) {
+	defer r.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxDeleteBodySize+1))
+	if err != nil {
+		log.Printf("handleDeleteObjects read error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+	if len(body) > maxDeleteBodySize {
+		writeError(w, http.StatusBadRequest, ErrMalformedXML)
+		return
+	}
+	if v := r.Header.Get("Content-MD5"); v != "" {
+		sum := md5.Sum(body)
+		if v != base64.StdEncoding.EncodeToString(sum[:]) {
+			writeError(w, http.StatusBadRequest, ErrBadDigest)
+			return
+		}
+	}
+
+	var req deleteObjectsRequest
+	if err := xml.Unmarshal(body, &req); err != nil {
+		log.Printf("handleDeleteObjects Decode error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrMalformedXML)
+		return
+	}
+	if len(req.Objects) == 0 || len(req.Objects) > maxDeleteObjects {
+		writeError(w, http.StatusBadRequest, ErrMalformedXML)
+		return
+	}
+
+	if err := metadata.HeadBucket(ownerID, bucketName); err != nil {
+		log.Printf("HeadBucket error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	resp := deleteObjectsResponse{Xmlns: s3XMLNamespace}
+	bypass := bypassGovernance(r)
+	for _, o := range req.Objects {
+		if err := checkObjectKey(o.Key); err != nil {
+			code := "InvalidArgument"
+			if errors.Is(err, ErrKeyTooLong) {
+				code = "KeyTooLongError"
+			}
+			resp.Errors = append(resp.Errors, deleteErrorItem{Key: o.Key, VersionID: o.VersionID, Code: code, Message: err.Error()})
+			continue
+		}
+		res, err := deleteObject(ownerID, bucketName, o.Key, o.VersionID, o.VersionID != "", bypass)
+		if err != nil {
+			log.Printf("DeleteObjects %s error: %v", o.Key, err)
+			code, msg := deleteErrorCode(err)
+			resp.Errors = append(resp.Errors, deleteErrorItem{Key: o.Key, VersionID: o.VersionID, Code: code, Message: msg})
+			continue
+		}
+		if req.Quiet {
+			continue
+		}
+		item := deletedObjectItem{Key: o.Key, VersionID: o.VersionID}
+		if res.DeleteMarker {
+			item.DeleteMarker = true
+			item.DeleteMarkerVersionID = res.VersionID
+		}
+		resp.Deleted = append(resp.Deleted, item)
+	}
+
+	writeXML(w, http.StatusOK, resp)
+}
+
+// deleteObject deletes a key, or one version of it when hasVersion is set,
+// and releases the blobs of any data version that went away. Deleting
+// something that does not exist succeeds, as in S3.
+func deleteObject(ownerID string, bucketName string, key string, versionID string, hasVersion bool, bypassGovernance bool) (*metadata.DeleteObjectResult, error) {
+	var res *metadata.DeleteObjectResult
+	var err error
+	if hasVersion {
+		res, err = metadata.DeleteObjectVersion(ownerID, bucketName, key, versionID, bypassGovernance)
+	} else {
+		res, err = metadata.DeleteObject(ownerID, bucketName, key)
+	}
+	if errors.Is(err, metadata.ErrObjectNotFound) || errors.Is(err, metadata.ErrVersionNotFound) {
+		return &metadata.DeleteObjectResult{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res.Released != nil {
+		releaseObject(res.Released)
+	}
+	return res, nil
+}
+
+// deleteErrorCode maps a failed delete to the S3 error code reported for
+// the key.
+func deleteErrorCode(err error) (string, string) {
+	switch {
+	case errors.Is(err, metadata.ErrObjectLocked):
+		return "AccessDenied", ErrObjectLocked.Error()
+	case errors.Is(err, metadata.ErrNoAccess):
+		return "AccessDenied", ErrForbidden.Error()
+	case errors.Is(err, metadata.ErrBucketNotFound):
+		return "NoSuchBucket", ErrBucketNotFound.Error()
+	case errors.Is(err, metadata.ErrInvalidVersionID):
+		return "InvalidArgument", ErrInvalidVersionID.Error()
+	case errors.Is(err, ErrInvalidArgument):
+		return "InvalidArgument", ErrInvalidArgument.Error()
+	default:
+		return "InternalError", ErrInternal.Error()
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeleteObjects(t *testing.T) {
+	s := newTestServer(t)
+	resp, body := s.do("PUT", "/multi", "", map[string]string{"x-amz-bucket-object-lock-enabled": "true"})
+	s.mustStatus(resp, body, http.StatusOK)
+
+	versions := map[string]string{}
+	for _, key := range []string{"a", "b", "c", "locked"} {
+		var headers map[string]string
+		if key == "locked" {
+			headers = map[string]string{
+				"x-amz-object-lock-mode":              "GOVERNANCE",
+				"x-amz-object-lock-retain-until-date": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			}
+		}
+		resp, body := s.do("PUT", "/multi/"+key, key, headers)
+		s.mustStatus(resp, body, http.StatusOK)
+		versions[key] = resp.Header.Get("x-amz-version-id")
+	}
+
+	deleteObjects := func(quiet bool, objects ...string) deleteObjectsResponse {
+		t.Helper()
+		var req strings.Builder
+		fmt.Fprintf(&req, "<Delete><Quiet>%v</Quiet>", quiet)
+		req.WriteString(strings.Join(objects, ""))
+		req.WriteString("</Delete>")
+		resp, body := s.do("POST", "/multi?delete", req.String(), nil)
+		s.mustStatus(resp, body, http.StatusOK)
+		var res deleteObjectsResponse
+		if err := xml.Unmarshal([]byte(body), &res); err != nil {
+			t.Fatalf("decoding %s: %v", body, err)
+		}
+		return res
+	}
+	object := func(key string, versionID string) string {
+		if versionID == "" {
+			return "<Object><Key>" + key + "</Key></Object>"
+		}
+		return "<Object><Key>" + key + "</Key><VersionId>" + versionID + "</VersionId></Object>"
+	}
+
+	res := deleteObjects(false,
+		object("a", ""),
+		object("b", versions["b"]),
+		object("locked", versions["locked"]),
+		object("c", "not-a-version"),
+		object("missing", ""),
+		object(strings.Repeat("k", maxObjectKeyLen+1), ""),
+	)
+	deleted := map[string]deletedObjectItem{}
+	for _, d := range res.Deleted {
+		deleted[d.Key] = d
+	}
+	if d := deleted["a"]; !d.DeleteMarker || d.DeleteMarkerVersionID == "" {
+		t.Errorf("a: %+v; want a delete marker", d)
+	}
+	if d := deleted["b"]; d.VersionID != versions["b"] || d.DeleteMarker {
+		t.Errorf("b: %+v; want version %s removed", d, versions["b"])
+	}
+	if _, ok := deleted["missing"]; !ok || len(res.Deleted) != 3 {
+		t.Errorf("deleted = %+v; want a, b and the missing key", res.Deleted)
+	}
+	codes := map[string]string{}
+	for _, e := range res.Errors {
+		codes[e.Key] = e.Code
+	}
+	if codes["locked"] != "AccessDenied" || codes["c"] != "InvalidArgument" || len(codes) != 3 {
+		t.Errorf("errors = %+v; want AccessDenied for locked and InvalidArgument for c", res.Errors)
+	}
+	if codes[strings.Repeat("k", maxObjectKeyLen+1)] != "KeyTooLongError" {
+		t.Errorf("errors = %+v; want KeyTooLongError for the long key", res.Errors)
+	}
+
+	resp, body = s.do("GET", "/multi/b?versionId="+versions["b"], "", nil)
+	s.mustStatus(resp, body, http.StatusNotFound)
+	resp, body = s.do("GET", "/multi/locked", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+
+	// Quiet mode only reports failures.
+	res = deleteObjects(true, object("c", ""), object("locked", versions["locked"]))
+	if len(res.Deleted) != 0 || len(res.Errors) != 1 || res.Errors[0].Key != "locked" {
+		t.Errorf("quiet result = %+v; want only the locked key's error", res)
+	}
+
+	var tooMany []string
+	for i := range maxDeleteObjects + 1 {
+		tooMany = append(tooMany, object(fmt.Sprint("k", i), ""))
+	}
+	resp, body = s.do("POST", "/multi?delete", "<Delete>"+strings.Join(tooMany, "")+"</Delete>", nil)
+	s.mustStatus(resp, body, http.StatusBadRequest)
+}
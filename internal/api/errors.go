@@ -13,4 +13,53 @@ var (
 	ErrForbidden               = errors.New("forbidden")
 	ErrUnauthorized            = errors.New("unauthorized")
 	ErrNotificationTargetInUse = errors.New("notification target in use")
+	ErrBucketNotEmpty          = errors.New("bucket not empty")
+	ErrObjectKeyRequired       = errors.New("object key required")
+	ErrKeyTooLong              = errors.New("object key longer than 1024 bytes")
+	ErrInvalidObjectKey        = errors.New("object key contains a NUL byte")
+	ErrObjectNotFound          = errors.New("object not found")
+	ErrVersionNotFound         = errors.New("version not found")
+	ErrInvalidVersionID        = errors.New("invalid version id")
+	ErrMethodNotAllowed        = errors.New("method not allowed")
+	ErrInvalidArgument         = errors.New("invalid argument")
+	ErrMalformedXML            = errors.New("malformed XML")
+	ErrUploadNotFound          = errors.New("upload not found")
+	ErrInvalidPart             = errors.New("invalid part")
+	ErrInvalidPartOrder        = errors.New("invalid part order")
+	ErrEntityTooSmall          = errors.New("entity too small")
+	ErrInvalidRange            = errors.New("requested range not satisfiable")
+	ErrInvalidPartNumber       = errors.New("invalid part number")
+	ErrPreconditionFailed      = errors.New("precondition failed")
+	ErrInvalidCopyRequest      = errors.New("copy source and destination are the same")
+	ErrObjectLocked            = errors.New("object is locked")
+	ErrObjectLockNotEnabled    = errors.New("object lock not enabled")
+	ErrObjectLockNotFound      = errors.New("object lock config not found")
+	ErrInvalidRetention        = errors.New("invalid retention")
+	ErrInvalidBucketState      = errors.New("invalid bucket state")
+	ErrLifecycleNotFound       = errors.New("lifecycle config not found")
+	ErrInvalidEncryption       = errors.New("invalid server-side encryption argument")
+	ErrInvalidCustomerKey      = errors.New("invalid customer key")
+	ErrCustomerKeyRequired     = errors.New("object is encrypted with a customer key; the key is required")
+	ErrCustomerKeyMismatch     = errors.New("customer key does not match the object")
+	ErrInsecureCustomerKey     = errors.New("customer keys must be sent over HTTPS")
+	ErrEncryptionNotFound      = errors.New("encryption config not found")
+	ErrEncryptionKeyNotFound   = errors.New("encryption key not found")
+	ErrEncryptionKeyExists     = errors.New("encryption key already exists")
+	ErrInvalidKeyID            = errors.New("invalid key id")
+	ErrCompressionNotFound     = errors.New("compression config not found")
+	ErrInvalidDigest           = errors.New("invalid Content-MD5")
+	ErrInvalidChecksum         = errors.New("invalid checksum argument")
+	ErrBadDigest               = errors.New("bad digest: the data does not match the checksum sent")
+	ErrDataCorrupted           = errors.New("stored data failed verification")
+	ErrMissingContentLength    = errors.New("x-amz-decoded-content-length required")
+	ErrChunkSignatureRequired  = errors.New("signed streaming uploads require SigV4 authentication")
+	ErrSignatureMismatch       = errors.New("signature does not match")
+	ErrMalformedChunk          = errors.New("malformed aws-chunked payload")
+	ErrIncompleteBody          = errors.New("body length does not match x-amz-decoded-content-length")
+	ErrInvalidTag              = errors.New("invalid tag")
+	ErrMetadataTooLarge        = errors.New("user metadata exceeds 2 KB")
+	ErrHealNotSupported        = errors.New("storage backend keeps no redundancy to heal from")
+	ErrAccessKeyNotFound       = errors.New("access key not found")
+	ErrAccessKeyExists         = errors.New("access key already exists")
+	ErrDocumentTooLarge        = errors.New("request document exceeds 1 MB")
 )
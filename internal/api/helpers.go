@@ -2,26 +2,125 @@ package api
 
 import (
 	"doss/internal/auth"
+	"doss/internal/kms"
 	"doss/internal/metadata"
+	"doss/internal/storage"
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// maxDocumentSize bounds the JSON and XML documents that configure buckets,
+// objects and keys.
+const maxDocumentSize = 1 << 20
+
+// readDocument reads the whole JSON or XML document a request carries. The
+// signed payload hash is only checked once the body has been read to the
+// end, so handlers unmarshal what this returns instead of decoding from
+// r.Body and stopping at the closing tag.
+func readDocument(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	defer r.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxDocumentSize+1))
+	if err != nil {
+		log.Printf("readDocument error: %v", err)
+		writeBodyError(w, err)
+		return nil, false
+	}
+	if len(body) > maxDocumentSize {
+		writeError(w, http.StatusBadRequest, ErrDocumentTooLarge)
+		return nil, false
+	}
+	return body, true
+}
+
 func writeBucketAccessError(w http.ResponseWriter, err error) {
 	switch {
 	case errors.Is(err, metadata.ErrBucketNotFound):
 		writeError(w, http.StatusNotFound, ErrBucketNotFound)
 	case errors.Is(err, metadata.ErrNoAccess):
 		writeError(w, http.StatusForbidden, ErrForbidden)
+	case errors.Is(err, metadata.ErrBucketNotEmpty):
+		writeError(w, http.StatusConflict, ErrBucketNotEmpty)
+	case errors.Is(err, metadata.ErrInvalidBucketState):
+		writeError(w, http.StatusConflict, ErrInvalidBucketState)
+	case errors.Is(err, metadata.ErrObjectLockNotEnabled):
+		writeError(w, http.StatusBadRequest, ErrObjectLockNotEnabled)
+	case errors.Is(err, metadata.ErrObjectLockConfigNotFound):
+		writeError(w, http.StatusNotFound, ErrObjectLockNotFound)
+	case errors.Is(err, metadata.ErrLifecycleNotFound):
+		writeError(w, http.StatusNotFound, ErrLifecycleNotFound)
+	case errors.Is(err, metadata.ErrEncryptionConfigNotFound):
+		writeError(w, http.StatusNotFound, ErrEncryptionNotFound)
+	case errors.Is(err, metadata.ErrCompressionConfigNotFound):
+		writeError(w, http.StatusNotFound, ErrCompressionNotFound)
 	default:
 		writeError(w, http.StatusInternalServerError, ErrInternal)
 	}
 }
 
+func writeObjectAccessError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, metadata.ErrObjectNotFound):
+		writeError(w, http.StatusNotFound, ErrObjectNotFound)
+	case errors.Is(err, metadata.ErrDeleteMarker):
+		w.Header().Set("x-amz-delete-marker", "true")
+		writeError(w, http.StatusNotFound, ErrObjectNotFound)
+	case errors.Is(err, metadata.ErrVersionNotFound):
+		writeError(w, http.StatusNotFound, ErrVersionNotFound)
+	case errors.Is(err, metadata.ErrInvalidVersionID):
+		writeError(w, http.StatusBadRequest, ErrInvalidVersionID)
+	case errors.Is(err, metadata.ErrUploadNotFound):
+		writeError(w, http.StatusNotFound, ErrUploadNotFound)
+	case errors.Is(err, metadata.ErrInvalidPart):
+		writeError(w, http.StatusBadRequest, ErrInvalidPart)
+	case errors.Is(err, metadata.ErrInvalidPartOrder):
+		writeError(w, http.StatusBadRequest, ErrInvalidPartOrder)
+	case errors.Is(err, metadata.ErrEntityTooSmall):
+		writeError(w, http.StatusBadRequest, ErrEntityTooSmall)
+	case errors.Is(err, metadata.ErrObjectLocked):
+		writeError(w, http.StatusForbidden, ErrObjectLocked)
+	case errors.Is(err, metadata.ErrInvalidRetention):
+		writeError(w, http.StatusBadRequest, ErrInvalidRetention)
+	case errors.Is(err, metadata.ErrInvalidTag):
+		writeError(w, http.StatusBadRequest, ErrInvalidTag)
+	default:
+		writeBucketAccessError(w, err)
+	}
+}
+
+// requireAdmin answers the request itself unless it was signed with an
+// admin credential.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if getOwnerID(r) == "" {
+		writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+		return false
+	}
+	if !auth.IsAdmin(r.Context()) {
+		writeError(w, http.StatusForbidden, ErrForbidden)
+		return false
+	}
+	return true
+}
+
+// objectErrorStatus maps the same errors as writeObjectAccessError for
+// responses that must not carry a body, such as HEAD.
+func objectErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, metadata.ErrObjectNotFound), errors.Is(err, metadata.ErrBucketNotFound),
+		errors.Is(err, metadata.ErrVersionNotFound), errors.Is(err, metadata.ErrDeleteMarker):
+		return http.StatusNotFound
+	case errors.Is(err, metadata.ErrNoAccess):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func handleGetBucketMetadata(w http.ResponseWriter, ownerID string, bucketName string) {
 	bucket, err := metadata.GetBucketMetadata(ownerID, bucketName)
 	if err != nil {
@@ -56,9 +155,11 @@ func handleGetBucketCORS(w http.ResponseWriter, ownerID string, bucketName strin
 
 func handlePutBucketCORS(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) {
 	var cors metadata.BucketCORS
-	decoder := json.NewDecoder(r.Body)
-	defer r.Body.Close()
-	if err := decoder.Decode(&cors); err != nil {
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(body, &cors); err != nil {
 		log.Printf("handlePutBucketCORS Decode error: %v", err)
 		writeError(w, http.StatusBadRequest, ErrBadRequest)
 		return
@@ -95,9 +196,11 @@ func handleGetBucketNotification(w http.ResponseWriter, ownerID string, bucketNa
 
 func handlePutBucketNotification(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) {
 	var cfg metadata.BucketNotificationConfig
-	decoder := json.NewDecoder(r.Body)
-	defer r.Body.Close()
-	if err := decoder.Decode(&cfg); err != nil {
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(body, &cfg); err != nil {
 		log.Printf("handlePutBucketNotification error: %v", err)
 		writeError(w, http.StatusBadRequest, ErrBadRequest)
 		return
@@ -116,6 +219,188 @@ func handlePutBucketNotification(w http.ResponseWriter, r *http.Request, ownerID
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func handleGetBucketVersioning(w http.ResponseWriter, ownerID string, bucketName string) {
+	cfg, err := metadata.GetBucketVersioning(ownerID, bucketName)
+	if err != nil {
+		log.Printf("GetBucketVersioning error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+func handlePutBucketVersioning(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) {
+	var cfg metadata.BucketVersioning
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		log.Printf("handlePutBucketVersioning Decode error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+	err := metadata.PutBucketVersioning(ownerID, bucketName, &cfg)
+	if errors.Is(err, metadata.ErrInvalidVersioningConfig) {
+		log.Printf("PutBucketVersioning error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("PutBucketVersioning error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleGetBucketLifecycle(w http.ResponseWriter, ownerID string, bucketName string) {
+	cfg, err := metadata.GetBucketLifecycle(ownerID, bucketName)
+	if err != nil {
+		log.Printf("GetBucketLifecycle error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+func handlePutBucketLifecycle(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) {
+	var cfg metadata.LifecycleConfig
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		log.Printf("handlePutBucketLifecycle Decode error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+	err := metadata.PutBucketLifecycle(ownerID, bucketName, &cfg)
+	if errors.Is(err, metadata.ErrInvalidLifecycleConfig) {
+		log.Printf("PutBucketLifecycle error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("PutBucketLifecycle error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleDeleteBucketLifecycle(w http.ResponseWriter, ownerID string, bucketName string) {
+	if err := metadata.DeleteBucketLifecycle(ownerID, bucketName); err != nil {
+		log.Printf("DeleteBucketLifecycle error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleGetBucketEncryption(w http.ResponseWriter, ownerID string, bucketName string) {
+	cfg, err := metadata.GetBucketEncryption(ownerID, bucketName)
+	if err != nil {
+		log.Printf("GetBucketEncryption error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+func handlePutBucketEncryption(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) {
+	var cfg metadata.BucketEncryption
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		log.Printf("handlePutBucketEncryption Decode error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+	// Refuse a default that no upload could be encrypted with.
+	if cfg.KMSKeyID != "" && metadata.ValidKeyID(cfg.KMSKeyID) {
+		if _, err := kms.Keys.GetKey(cfg.KMSKeyID); err != nil {
+			writeEncryptionError(w, err)
+			return
+		}
+	}
+	err := metadata.PutBucketEncryption(ownerID, bucketName, &cfg)
+	if errors.Is(err, metadata.ErrInvalidEncryptionConfig) {
+		log.Printf("PutBucketEncryption error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrInvalidEncryption)
+		return
+	}
+	if err != nil {
+		log.Printf("PutBucketEncryption error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleDeleteBucketEncryption(w http.ResponseWriter, ownerID string, bucketName string) {
+	if err := metadata.DeleteBucketEncryption(ownerID, bucketName); err != nil {
+		log.Printf("DeleteBucketEncryption error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleGetBucketCompression(w http.ResponseWriter, ownerID string, bucketName string) {
+	cfg, err := metadata.GetBucketCompression(ownerID, bucketName)
+	if err != nil {
+		log.Printf("GetBucketCompression error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+func handlePutBucketCompression(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) {
+	var cfg metadata.BucketCompression
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		log.Printf("handlePutBucketCompression Decode error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+	if !storage.ValidCompression(cfg.Algorithm) {
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+	err := metadata.PutBucketCompression(ownerID, bucketName, &cfg)
+	if errors.Is(err, metadata.ErrInvalidCompressionConfig) {
+		log.Printf("PutBucketCompression error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("PutBucketCompression error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleDeleteBucketCompression(w http.ResponseWriter, ownerID string, bucketName string) {
+	if err := metadata.DeleteBucketCompression(ownerID, bucketName); err != nil {
+		log.Printf("DeleteBucketCompression error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func parseBucketName(w http.ResponseWriter, r *http.Request) (string, bool) {
 	b := chi.URLParam(r, "bucket")
 	if b == "" {
@@ -125,6 +410,33 @@ func parseBucketName(w http.ResponseWriter, r *http.Request) (string, bool) {
 	return b, true
 }
 
+func parseObjectKey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	k := chi.URLParam(r, "*")
+	if err := checkObjectKey(k); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return "", false
+	}
+	return k, true
+}
+
+// maxObjectKeyLen is the longest key S3 accepts, in bytes.
+const maxObjectKeyLen = 1024
+
+// checkObjectKey rejects keys that cannot be stored. Metadata separates a
+// key from its version with a NUL, so a key containing one would read as
+// another key's version.
+func checkObjectKey(k string) error {
+	switch {
+	case k == "":
+		return ErrObjectKeyRequired
+	case len(k) > maxObjectKeyLen:
+		return ErrKeyTooLong
+	case strings.IndexByte(k, 0) >= 0:
+		return ErrInvalidObjectKey
+	}
+	return nil
+}
+
 func parseTargetID(w http.ResponseWriter, r *http.Request) (string, bool) {
 	b := chi.URLParam(r, "targetID")
 	if b == "" {
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// A configuration document must match its signed payload hash, including
+// whatever follows the part a decoder would stop at.
+func TestReadDocumentVerifiesPayload(t *testing.T) {
+	s := newTestServer(t)
+	resp, body := s.do("PUT", "/docs", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+
+	signed := `{"algorithm":"zstd","extensions":[".log"]}` + strings.Repeat(" ", 64<<10)
+	sum := sha256.Sum256([]byte(signed))
+	tampered := `{"algorithm":"s2","extensions":[".log"]}` + strings.Repeat(" ", 64<<10+2)
+	resp, body = s.do("PUT", "/docs?compression", tampered, map[string]string{"x-amz-content-sha256": hex.EncodeToString(sum[:])})
+	s.mustStatus(resp, body, http.StatusBadRequest)
+	resp, body = s.do("GET", "/docs?compression", "", nil)
+	s.mustStatus(resp, body, http.StatusNotFound)
+
+	resp, body = s.do("PUT", "/docs?compression", signed, nil)
+	s.mustStatus(resp, body, http.StatusNoContent)
+
+	resp, body = s.do("PUT", "/docs?compression", `{"algorithm":"zstd","extensions":[".log"]}`+strings.Repeat(" ", maxDocumentSize), nil)
+	s.mustStatus(resp, body, http.StatusBadRequest)
+	if !strings.Contains(body, ErrDocumentTooLarge.Error()) {
+		t.Errorf("oversized document: body %s", body)
+	}
+}
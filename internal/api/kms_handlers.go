@@ -0,0 +1,108 @@
+package api
+
+import (
+	"doss/internal/kms"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func KeyCollectionGetHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	keys, err := kms.Keys.ListKeys()
+	if err != nil {
+		log.Printf("ListKeys error: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func KeyItemGetHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, ok := parseKeyID(w, r)
+	if !ok {
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	info, err := kms.Keys.GetKey(keyID)
+	if err != nil {
+		log.Printf("GetKey error: %v", err)
+		writeKeyError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
+// KeyItemPutHandler creates a key. Key material is generated by the KMS and
+// never leaves it.
+func KeyItemPutHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, ok := parseKeyID(w, r)
+	if !ok {
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	info, err := kms.Keys.CreateKey(keyID)
+	if err != nil {
+		log.Printf("CreateKey error: %v", err)
+		writeKeyError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// KeyRotateHandler adds a new version to a key. New data keys are sealed
+// under it straight away; existing ones are moved by the rewrap job.
+func KeyRotateHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, ok := parseKeyID(w, r)
+	if !ok {
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	info, err := kms.Keys.RotateKey(keyID)
+	if err != nil {
+		log.Printf("RotateKey error: %v", err)
+		writeKeyError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
+func writeKeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, kms.ErrKeyNotFound):
+		writeError(w, http.StatusNotFound, ErrEncryptionKeyNotFound)
+	case errors.Is(err, kms.ErrKeyExists):
+		writeError(w, http.StatusConflict, ErrEncryptionKeyExists)
+	case errors.Is(err, kms.ErrInvalidKeyID):
+		writeError(w, http.StatusBadRequest, ErrInvalidKeyID)
+	default:
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+	}
+}
+
+func parseKeyID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	k := chi.URLParam(r, "keyID")
+	if k == "" {
+		writeError(w, http.StatusBadRequest, ErrInvalidKeyID)
+		return "", false
+	}
+	return k, true
+}
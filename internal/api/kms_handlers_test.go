@@ -0,0 +1,49 @@
+package api
+
+import (
+	"doss/internal/kms"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestKeyHandlers(t *testing.T) {
+	s := newTestServer(t)
+
+	resp, body := s.do("PUT", "/doss/v1/kms/keys/team-a", "", nil)
+	s.mustStatus(resp, body, http.StatusCreated)
+	resp, body = s.do("PUT", "/doss/v1/kms/keys/team-a", "", nil)
+	s.mustStatus(resp, body, http.StatusConflict)
+	resp, body = s.do("PUT", "/doss/v1/kms/keys/bad%20id", "", nil)
+	s.mustStatus(resp, body, http.StatusBadRequest)
+
+	resp, body = s.do("POST", "/doss/v1/kms/keys/team-a/rotate", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	var info kms.KeyInfo
+	if err := json.Unmarshal([]byte(body), &info); err != nil || info.Version != 2 {
+		t.Errorf("rotate = %s, %v; want version 2", body, err)
+	}
+	resp, body = s.do("POST", "/doss/v1/kms/keys/missing/rotate", "", nil)
+	s.mustStatus(resp, body, http.StatusNotFound)
+
+	resp, body = s.do("GET", "/doss/v1/kms/keys/team-a", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	resp, body = s.do("GET", "/doss/v1/kms/keys", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	var keys []kms.KeyInfo
+	if err := json.Unmarshal([]byte(body), &keys); err != nil || len(keys) != 2 {
+		t.Errorf("list = %s, %v; want default and team-a", body, err)
+	}
+
+	// Keys are shared by every tenant, so only admins manage them.
+	tenant := s.as("tenant")
+	for _, req := range []struct{ method, target string }{
+		{"GET", "/doss/v1/kms/keys"},
+		{"GET", "/doss/v1/kms/keys/team-a"},
+		{"PUT", "/doss/v1/kms/keys/team-b"},
+		{"POST", "/doss/v1/kms/keys/default/rotate"},
+	} {
+		resp, body := tenant.do(req.method, req.target, "", nil)
+		tenant.mustStatus(resp, body, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,366 @@
+package api
+
+import (
+	"doss/internal/metadata"
+	"encoding/base64"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	s3XMLNamespace  = "http://s3.amazonaws.com/doc/2006-03-01/"
+	maxListKeys     = 1000
+	defaultListKeys = 1000
+	// S3 timestamps in XML bodies always carry milliseconds and a Z suffix.
+	s3TimeFormat = "2006-01-02T15:04:05.000Z"
+)
+
+type listObjectsV2Response struct {
+	XMLName               xml.Name             `xml:"ListBucketResult"`
+	Xmlns                 string               `xml:"xmlns,attr"`
+	Name                  string               `xml:"Name"`
+	Prefix                string               `xml:"Prefix"`
+	Delimiter             string               `xml:"Delimiter,omitempty"`
+	MaxKeys               int                  `xml:"MaxKeys"`
+	KeyCount              int                  `xml:"KeyCount"`
+	IsTruncated           bool                 `xml:"IsTruncated"`
+	ContinuationToken     string               `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string               `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string               `xml:"StartAfter,omitempty"`
+	EncodingType          string               `xml:"EncodingType,omitempty"`
+	Contents              []listObjectEntry    `xml:"Contents"`
+	CommonPrefixes        []listCommonPrefixes `xml:"CommonPrefixes"`
+}
+
+type listObjectsV1Response struct {
+	XMLName        xml.Name             `xml:"ListBucketResult"`
+	Xmlns          string               `xml:"xmlns,attr"`
+	Name           string               `xml:"Name"`
+	Prefix         string               `xml:"Prefix"`
+	Marker         string               `xml:"Marker"`
+	NextMarker     string               `xml:"NextMarker,omitempty"`
+	MaxKeys        int                  `xml:"MaxKeys"`
+	Delimiter      string               `xml:"Delimiter,omitempty"`
+	IsTruncated    bool                 `xml:"IsTruncated"`
+	EncodingType   string               `xml:"EncodingType,omitempty"`
+	Contents       []listObjectEntry    `xml:"Contents"`
+	CommonPrefixes []listCommonPrefixes `xml:"CommonPrefixes"`
+}
+
+type listObjectEntry struct {
+	Key          string     `xml:"Key"`
+	LastModified string     `xml:"LastModified"`
+	ETag         string     `xml:"ETag"`
+	Size         int64      `xml:"Size"`
+	Owner        *listOwner `xml:"Owner,omitempty"`
+	StorageClass string     `xml:"StorageClass"`
+}
+
+type listVersionsResponse struct {
+	XMLName             xml.Name `xml:"ListVersionsResult"`
+	Xmlns               string   `xml:"xmlns,attr"`
+	Name                string   `xml:"Name"`
+	Prefix              string   `xml:"Prefix"`
+	KeyMarker           string   `xml:"KeyMarker"`
+	VersionIDMarker     string   `xml:"VersionIdMarker"`
+	NextKeyMarker       string   `xml:"NextKeyMarker,omitempty"`
+	NextVersionIDMarker string   `xml:"NextVersionIdMarker,omitempty"`
+	MaxKeys             int      `xml:"MaxKeys"`
+	Delimiter           string   `xml:"Delimiter,omitempty"`
+	IsTruncated         bool     `xml:"IsTruncated"`
+	EncodingType        string   `xml:"EncodingType,omitempty"`
+	// Entries interleaves listVersionEntry and listDeleteMarkerEntry in
+	// listing order, as S3 does.
+	Entries        []any                `xml:",any"`
+	CommonPrefixes []listCommonPrefixes `xml:"CommonPrefixes"`
+}
+
+type listVersionEntry struct {
+	XMLName      xml.Name  `xml:"Version"`
+	Key          string    `xml:"Key"`
+	VersionID    string    `xml:"VersionId"`
+	IsLatest     bool      `xml:"IsLatest"`
+	LastModified string    `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+	Owner        listOwner `xml:"Owner"`
+	StorageClass string    `xml:"StorageClass"`
+}
+
+type listDeleteMarkerEntry struct {
+	XMLName      xml.Name  `xml:"DeleteMarker"`
+	Key          string    `xml:"Key"`
+	VersionID    string    `xml:"VersionId"`
+	IsLatest     bool      `xml:"IsLatest"`
+	LastModified string    `xml:"LastModified"`
+	Owner        listOwner `xml:"Owner"`
+}
+
+type listOwner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type listCommonPrefixes struct {
+	Prefix string `xml:"Prefix"`
+}
+
+func handleListObjectsV2(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) {
+	q := r.URL.Query()
+
+	maxKeys, ok := parseMaxKeys(w, q)
+	if !ok {
+		return
+	}
+	encode, ok := parseEncodingType(w, q)
+	if !ok {
+		return
+	}
+
+	startAfter := q.Get("start-after")
+	token := q.Get("continuation-token")
+	marker := startAfter
+	if q.Has("continuation-token") {
+		decoded, err := decodeContinuationToken(token)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+			return
+		}
+		marker = decoded
+	}
+
+	res, err := metadata.ListObjects(ownerID, bucketName, metadata.ListObjectsParams{
+		Prefix:     q.Get("prefix"),
+		Delimiter:  q.Get("delimiter"),
+		StartAfter: marker,
+		MaxKeys:    maxKeys,
+	})
+	if err != nil {
+		log.Printf("ListObjectsV2 error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	resp := listObjectsV2Response{
+		Xmlns:             s3XMLNamespace,
+		Name:              bucketName,
+		Prefix:            encode(q.Get("prefix")),
+		Delimiter:         encode(q.Get("delimiter")),
+		MaxKeys:           maxKeys,
+		KeyCount:          len(res.Objects) + len(res.CommonPrefixes),
+		IsTruncated:       res.IsTruncated,
+		ContinuationToken: token,
+		StartAfter:        encode(startAfter),
+		EncodingType:      q.Get("encoding-type"),
+		Contents:          listEntries(res.Objects, encode, q.Get("fetch-owner") == "true"),
+		CommonPrefixes:    listPrefixes(res.CommonPrefixes, encode),
+	}
+	if res.IsTruncated {
+		resp.NextContinuationToken = encodeContinuationToken(res.NextMarker)
+	}
+
+	writeXML(w, http.StatusOK, resp)
+}
+
+// handleListObjectsV1 serves the legacy listing API. It shares the engine with
+// V2; only the pagination vocabulary differs.
+func handleListObjectsV1(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) {
+	q := r.URL.Query()
+
+	maxKeys, ok := parseMaxKeys(w, q)
+	if !ok {
+		return
+	}
+	encode, ok := parseEncodingType(w, q)
+	if !ok {
+		return
+	}
+
+	marker := q.Get("marker")
+	delimiter := q.Get("delimiter")
+
+	res, err := metadata.ListObjects(ownerID, bucketName, metadata.ListObjectsParams{
+		Prefix:     q.Get("prefix"),
+		Delimiter:  delimiter,
+		StartAfter: marker,
+		MaxKeys:    maxKeys,
+	})
+	if err != nil {
+		log.Printf("ListObjects error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	resp := listObjectsV1Response{
+		Xmlns:          s3XMLNamespace,
+		Name:           bucketName,
+		Prefix:         encode(q.Get("prefix")),
+		Marker:         encode(marker),
+		MaxKeys:        maxKeys,
+		Delimiter:      encode(delimiter),
+		IsTruncated:    res.IsTruncated,
+		EncodingType:   q.Get("encoding-type"),
+		Contents:       listEntries(res.Objects, encode, true),
+		CommonPrefixes: listPrefixes(res.CommonPrefixes, encode),
+	}
+	// S3 only sends NextMarker for delimited listings; without a delimiter
+	// clients resume from the last key in Contents.
+	if res.IsTruncated && delimiter != "" {
+		resp.NextMarker = encode(res.NextMarker)
+	}
+
+	writeXML(w, http.StatusOK, resp)
+}
+
+func handleListObjectVersions(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) {
+	q := r.URL.Query()
+
+	maxKeys, ok := parseMaxKeys(w, q)
+	if !ok {
+		return
+	}
+	encode, ok := parseEncodingType(w, q)
+	if !ok {
+		return
+	}
+
+	res, err := metadata.ListObjectVersions(ownerID, bucketName, metadata.ListVersionsParams{
+		Prefix:          q.Get("prefix"),
+		Delimiter:       q.Get("delimiter"),
+		KeyMarker:       q.Get("key-marker"),
+		VersionIDMarker: q.Get("version-id-marker"),
+		MaxKeys:         maxKeys,
+	})
+	if err != nil {
+		log.Printf("ListObjectVersions error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	resp := listVersionsResponse{
+		Xmlns:           s3XMLNamespace,
+		Name:            bucketName,
+		Prefix:          encode(q.Get("prefix")),
+		KeyMarker:       encode(q.Get("key-marker")),
+		VersionIDMarker: q.Get("version-id-marker"),
+		MaxKeys:         maxKeys,
+		Delimiter:       encode(q.Get("delimiter")),
+		IsTruncated:     res.IsTruncated,
+		EncodingType:    q.Get("encoding-type"),
+		Entries:         make([]any, 0, len(res.Versions)),
+		CommonPrefixes:  listPrefixes(res.CommonPrefixes, encode),
+	}
+	if res.IsTruncated {
+		resp.NextKeyMarker = encode(res.NextKeyMarker)
+		resp.NextVersionIDMarker = res.NextVersionIDMarker
+	}
+	for _, v := range res.Versions {
+		owner := listOwner{ID: v.OwnerID, DisplayName: v.OwnerID}
+		lastModified := v.LastModified.UTC().Format(s3TimeFormat)
+		if v.IsDeleteMarker {
+			resp.Entries = append(resp.Entries, listDeleteMarkerEntry{
+				Key:          encode(v.Key),
+				VersionID:    displayVersionID(v.VersionID),
+				IsLatest:     v.IsLatest,
+				LastModified: lastModified,
+				Owner:        owner,
+			})
+			continue
+		}
+		resp.Entries = append(resp.Entries, listVersionEntry{
+			Key:          encode(v.Key),
+			VersionID:    displayVersionID(v.VersionID),
+			IsLatest:     v.IsLatest,
+			LastModified: lastModified,
+			ETag:         quoteETag(v.ETag),
+			Size:         v.Size,
+			Owner:        owner,
+			StorageClass: "STANDARD",
+		})
+	}
+
+	writeXML(w, http.StatusOK, resp)
+}
+
+// displayVersionID renders the version of an object written before the
+// bucket had versioning, which is stored without an ID, as S3's "null".
+func displayVersionID(id string) string {
+	if id == "" {
+		return metadata.NullVersionID
+	}
+	return id
+}
+
+func listEntries(objects []metadata.ObjectMeta, encode func(string) string, withOwner bool) []listObjectEntry {
+	entries := make([]listObjectEntry, 0, len(objects))
+	for _, o := range objects {
+		entry := listObjectEntry{
+			Key:          encode(o.Key),
+			LastModified: o.LastModified.UTC().Format(s3TimeFormat),
+			ETag:         quoteETag(o.ETag),
+			Size:         o.Size,
+			StorageClass: "STANDARD",
+		}
+		if withOwner {
+			entry.Owner = &listOwner{ID: o.OwnerID, DisplayName: o.OwnerID}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func listPrefixes(prefixes []string, encode func(string) string) []listCommonPrefixes {
+	out := make([]listCommonPrefixes, 0, len(prefixes))
+	for _, p := range prefixes {
+		out = append(out, listCommonPrefixes{Prefix: encode(p)})
+	}
+	return out
+}
+
+func parseMaxKeys(w http.ResponseWriter, q url.Values) (int, bool) {
+	if !q.Has("max-keys") {
+		return defaultListKeys, true
+	}
+	n, err := strconv.Atoi(q.Get("max-keys"))
+	if err != nil || n < 0 {
+		writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+		return 0, false
+	}
+	return min(n, maxListKeys), true
+}
+
+// parseEncodingType returns the function used to encode keys and prefixes in
+// the response. Only "url" is defined by S3.
+func parseEncodingType(w http.ResponseWriter, q url.Values) (func(string) string, bool) {
+	switch q.Get("encoding-type") {
+	case "":
+		return func(s string) string { return s }, true
+	case "url":
+		return s3URLEncode, true
+	default:
+		writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+		return nil, false
+	}
+}
+
+func s3URLEncode(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	return strings.ReplaceAll(s, "%2F", "/")
+}
+
+func encodeContinuationToken(marker string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(marker))
+}
+
+func decodeContinuationToken(token string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
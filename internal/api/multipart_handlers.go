@@ -0,0 +1,410 @@
+package api
+
+import (
+	"doss/internal/metadata"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	maxListParts   = 1000
+	maxListUploads = 1000
+)
+
+type initiateMultipartUploadResponse struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completeMultipartUploadRequest struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+		xmlChecksum
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResponse struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+	xmlChecksum
+}
+
+type listPartsResponse struct {
+	XMLName              xml.Name       `xml:"ListPartsResult"`
+	Xmlns                string         `xml:"xmlns,attr"`
+	Bucket               string         `xml:"Bucket"`
+	Key                  string         `xml:"Key"`
+	UploadID             string         `xml:"UploadId"`
+	Initiator            listOwner      `xml:"Initiator"`
+	Owner                listOwner      `xml:"Owner"`
+	StorageClass         string         `xml:"StorageClass"`
+	PartNumberMarker     int            `xml:"PartNumberMarker"`
+	NextPartNumberMarker int            `xml:"NextPartNumberMarker"`
+	MaxParts             int            `xml:"MaxParts"`
+	IsTruncated          bool           `xml:"IsTruncated"`
+	Parts                []listPartItem `xml:"Part"`
+}
+
+type listPartItem struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	xmlChecksum
+}
+
+type listMultipartUploadsResponse struct {
+	XMLName            xml.Name             `xml:"ListMultipartUploadsResult"`
+	Xmlns              string               `xml:"xmlns,attr"`
+	Bucket             string               `xml:"Bucket"`
+	KeyMarker          string               `xml:"KeyMarker"`
+	UploadIDMarker     string               `xml:"UploadIdMarker"`
+	NextKeyMarker      string               `xml:"NextKeyMarker"`
+	NextUploadIDMarker string               `xml:"NextUploadIdMarker"`
+	Prefix             string               `xml:"Prefix"`
+	Delimiter          string               `xml:"Delimiter,omitempty"`
+	MaxUploads         int                  `xml:"MaxUploads"`
+	IsTruncated        bool                 `xml:"IsTruncated"`
+	EncodingType       string               `xml:"EncodingType,omitempty"`
+	Uploads            []listUploadItem     `xml:"Upload"`
+	CommonPrefixes     []listCommonPrefixes `xml:"CommonPrefixes"`
+}
+
+type listUploadItem struct {
+	Key          string    `xml:"Key"`
+	UploadID     string    `xml:"UploadId"`
+	Initiator    listOwner `xml:"Initiator"`
+	Owner        listOwner `xml:"Owner"`
+	StorageClass string    `xml:"StorageClass"`
+	Initiated    string    `xml:"Initiated"`
+}
+
+func handleCreateMultipartUpload(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+
+	checksumAlgorithm, err := requestedChecksumAlgorithm(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	retention, legalHold, ok := parseObjectLockHeaders(w, r)
+	if !ok {
+		return
+	}
+	tags, ok := parseTaggingHeader(w, r)
+	if !ok {
+		return
+	}
+	headers, ok := parseObjectHeaders(w, r)
+	if !ok {
+		return
+	}
+	encryption, _, ok := newObjectEncryption(w, r, ownerID, bucketName)
+	if !ok {
+		return
+	}
+	compression, err := objectCompression(ownerID, bucketName, key, contentType)
+	if err != nil {
+		log.Printf("GetBucketCompression error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	upload := metadata.MultipartUpload{
+		Bucket:            bucketName,
+		Key:               key,
+		ContentType:       contentType,
+		Encryption:        encryption,
+		Compression:       compression,
+		ChecksumAlgorithm: checksumAlgorithm,
+		Tags:              tags,
+		ObjectHeaders:     headers,
+		Retention:         retention,
+		LegalHold:         legalHold,
+	}
+	if err := metadata.CreateMultipartUpload(ownerID, &upload); err != nil {
+		log.Printf("CreateMultipartUpload error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	setEncryptionHeaders(w, r, upload.Encryption)
+	if upload.ChecksumAlgorithm != "" {
+		w.Header().Set("x-amz-checksum-algorithm", upload.ChecksumAlgorithm)
+	}
+	writeXML(w, http.StatusOK, initiateMultipartUploadResponse{
+		Xmlns:    s3XMLNamespace,
+		Bucket:   bucketName,
+		Key:      key,
+		UploadID: upload.UploadID,
+	})
+}
+
+func handleUploadPart(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	uploadID := r.URL.Query().Get("uploadId")
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > metadata.MaxPartNumber {
+		writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+		return
+	}
+
+	if err := decodeStreamingBody(r); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	checksum, err := parseUploadChecksum(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Make sure the upload exists before accepting the part's bytes.
+	upload, err := metadata.GetMultipartUpload(ownerID, bucketName, key, uploadID)
+	if err != nil {
+		log.Printf("GetMultipartUpload error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+	dataKey, err := objectDataKey(r, upload.Encryption, sseCustomerPrefix)
+	if err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+	// Parts of an upload started with a checksum algorithm all get a
+	// checksum in it, whether or not the client sent one.
+	if err := checksum.compute(upload.ChecksumAlgorithm); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	defer r.Body.Close()
+	blob, err := storeBlob(checksum.wrap(r.Body), dataKey, upload.Compression)
+	if err != nil {
+		log.Printf("UploadPart storage error: %v", err)
+		writeBodyError(w, err)
+		return
+	}
+	partChecksum, err := checksum.verify(blob)
+	if err != nil {
+		releaseBlob(blob.id)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	part := metadata.PartMeta{
+		Number:       partNumber,
+		BlobID:       blob.id,
+		Size:         blob.size,
+		ETag:         blob.objectETag(upload.Encryption, dataKey),
+		LastModified: time.Now().UTC(),
+		FrameIndex:   blob.frameIndex,
+		Checksum:     partChecksum,
+	}
+
+	prev, err := metadata.PutPart(ownerID, bucketName, key, uploadID, &part)
+	if err != nil {
+		log.Printf("PutPart error: %v", err)
+		releaseBlob(blob.id)
+		writeObjectAccessError(w, err)
+		return
+	}
+	if prev != nil {
+		releaseBlob(prev.BlobID)
+	}
+
+	setEncryptionHeaders(w, r, upload.Encryption)
+	setChecksumHeader(w, part.Checksum)
+	w.Header().Set("ETag", quoteETag(part.ETag))
+	w.WriteHeader(http.StatusOK)
+}
+
+func handleCompleteMultipartUpload(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	var req completeMultipartUploadRequest
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		log.Printf("handleCompleteMultipartUpload Decode error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrMalformedXML)
+		return
+	}
+
+	completed := make([]metadata.CompletedPart, 0, len(req.Parts))
+	for _, p := range req.Parts {
+		completed = append(completed, metadata.CompletedPart{Number: p.PartNumber, ETag: p.ETag, Checksum: p.value()})
+	}
+
+	res, err := metadata.CompleteMultipartUpload(ownerID, bucketName, key, r.URL.Query().Get("uploadId"), completed)
+	if err != nil {
+		log.Printf("CompleteMultipartUpload error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+	for _, p := range res.Unused {
+		releaseBlob(p.BlobID)
+	}
+	if res.Replaced != nil {
+		releaseObject(res.Replaced)
+	}
+
+	if res.Object.VersionID != "" {
+		w.Header().Set("x-amz-version-id", res.Object.VersionID)
+	}
+	setEncryptionHeaders(w, r, res.Object.Encryption)
+	writeXML(w, http.StatusOK, completeMultipartUploadResponse{
+		Xmlns:       s3XMLNamespace,
+		Location:    "/" + bucketName + "/" + key,
+		Bucket:      bucketName,
+		Key:         key,
+		ETag:        quoteETag(res.Object.ETag),
+		xmlChecksum: newXMLChecksum(res.Object.Checksum),
+	})
+}
+
+func handleAbortMultipartUpload(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	parts, err := metadata.AbortMultipartUpload(ownerID, bucketName, key, r.URL.Query().Get("uploadId"))
+	if err != nil {
+		log.Printf("AbortMultipartUpload error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+	for _, p := range parts {
+		releaseBlob(p.BlobID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleListParts(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	q := r.URL.Query()
+	uploadID := q.Get("uploadId")
+
+	maxParts := maxListParts
+	if q.Has("max-parts") {
+		n, err := strconv.Atoi(q.Get("max-parts"))
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+			return
+		}
+		maxParts = min(n, maxListParts)
+	}
+	marker := 0
+	if q.Has("part-number-marker") {
+		n, err := strconv.Atoi(q.Get("part-number-marker"))
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+			return
+		}
+		marker = n
+	}
+
+	res, err := metadata.ListParts(ownerID, bucketName, key, uploadID, marker, maxParts)
+	if err != nil {
+		log.Printf("ListParts error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+
+	owner := listOwner{ID: ownerID, DisplayName: ownerID}
+	resp := listPartsResponse{
+		Xmlns:                s3XMLNamespace,
+		Bucket:               bucketName,
+		Key:                  key,
+		UploadID:             uploadID,
+		Initiator:            owner,
+		Owner:                owner,
+		StorageClass:         "STANDARD",
+		PartNumberMarker:     marker,
+		NextPartNumberMarker: res.NextPartNumberMarker,
+		MaxParts:             maxParts,
+		IsTruncated:          res.IsTruncated,
+		Parts:                make([]listPartItem, 0, len(res.Parts)),
+	}
+	for _, p := range res.Parts {
+		resp.Parts = append(resp.Parts, listPartItem{
+			PartNumber:   p.Number,
+			LastModified: p.LastModified.UTC().Format(s3TimeFormat),
+			ETag:         quoteETag(p.ETag),
+			Size:         p.Size,
+			xmlChecksum:  newXMLChecksum(p.Checksum),
+		})
+	}
+
+	writeXML(w, http.StatusOK, resp)
+}
+
+func handleListMultipartUploads(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) {
+	q := r.URL.Query()
+
+	encode, ok := parseEncodingType(w, q)
+	if !ok {
+		return
+	}
+	maxUploads := maxListUploads
+	if q.Has("max-uploads") {
+		n, err := strconv.Atoi(q.Get("max-uploads"))
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+			return
+		}
+		maxUploads = min(n, maxListUploads)
+	}
+
+	res, err := metadata.ListMultipartUploads(ownerID, bucketName, metadata.ListUploadsParams{
+		Prefix:         q.Get("prefix"),
+		Delimiter:      q.Get("delimiter"),
+		KeyMarker:      q.Get("key-marker"),
+		UploadIDMarker: q.Get("upload-id-marker"),
+		MaxUploads:     maxUploads,
+	})
+	if err != nil {
+		log.Printf("ListMultipartUploads error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	resp := listMultipartUploadsResponse{
+		Xmlns:              s3XMLNamespace,
+		Bucket:             bucketName,
+		KeyMarker:          encode(q.Get("key-marker")),
+		UploadIDMarker:     q.Get("upload-id-marker"),
+		NextKeyMarker:      encode(res.NextKeyMarker),
+		NextUploadIDMarker: res.NextUploadIDMarker,
+		Prefix:             encode(q.Get("prefix")),
+		Delimiter:          encode(q.Get("delimiter")),
+		MaxUploads:         maxUploads,
+		IsTruncated:        res.IsTruncated,
+		EncodingType:       q.Get("encoding-type"),
+		Uploads:            make([]listUploadItem, 0, len(res.Uploads)),
+		CommonPrefixes:     listPrefixes(res.CommonPrefixes, encode),
+	}
+	for _, u := range res.Uploads {
+		owner := listOwner{ID: u.OwnerID, DisplayName: u.OwnerID}
+		resp.Uploads = append(resp.Uploads, listUploadItem{
+			Key:          encode(u.Key),
+			UploadID:     u.UploadID,
+			Initiator:    owner,
+			Owner:        owner,
+			StorageClass: "STANDARD",
+			Initiated:    u.Initiated.UTC().Format(s3TimeFormat),
+		})
+	}
+
+	writeXML(w, http.StatusOK, resp)
+}
@@ -0,0 +1,514 @@
+package api
+
+import (
+	"crypto/md5"
+	"doss/internal/metadata"
+	"doss/internal/storage"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultContentType = "application/octet-stream"
+
+func ObjectPutHandler(w http.ResponseWriter, r *http.Request) {
+	bucketName, ok := parseBucketName(w, r)
+	if !ok {
+		return
+	}
+	key, ok := parseObjectKey(w, r)
+	if !ok {
+		return
+	}
+
+	ownerID := getOwnerID(r)
+	if ownerID == "" {
+		writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+		return
+	}
+
+	if r.URL.Query().Has("retention") {
+		handlePutObjectRetention(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	if r.URL.Query().Has("legal-hold") {
+		handlePutObjectLegalHold(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	if r.URL.Query().Has("tagging") {
+		handlePutObjectTagging(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	if r.URL.Query().Has("uploadId") {
+		if r.Header.Get("x-amz-copy-source") != "" {
+			handleUploadPartCopy(w, r, ownerID, bucketName, key)
+			return
+		}
+		handleUploadPart(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	if r.Header.Get("x-amz-copy-source") != "" {
+		handleCopyObject(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	retention, legalHold, ok := parseObjectLockHeaders(w, r)
+	if !ok {
+		return
+	}
+	tags, ok := parseTaggingHeader(w, r)
+	if !ok {
+		return
+	}
+	if err := decodeStreamingBody(r); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	// Parsed after the body, whose aws-chunked framing is not part of the
+	// stored Content-Encoding.
+	headers, ok := parseObjectHeaders(w, r)
+	if !ok {
+		return
+	}
+	checksum, err := parseUploadChecksum(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	encryption, dataKey, ok := newObjectEncryption(w, r, ownerID, bucketName)
+	if !ok {
+		return
+	}
+
+	// Check access before accepting any bytes so a bad bucket never costs
+	// a full upload.
+	if err := metadata.HeadBucket(ownerID, bucketName); err != nil {
+		log.Printf("HeadBucket error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	compression, err := objectCompression(ownerID, bucketName, key, contentType)
+	if err != nil {
+		log.Printf("GetBucketCompression error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	defer r.Body.Close()
+	blob, err := storeBlob(checksum.wrap(r.Body), dataKey, compression)
+	if err != nil {
+		log.Printf("PutObject storage error: %v", err)
+		writeBodyError(w, err)
+		return
+	}
+	objectChecksum, err := checksum.verify(blob)
+	if err != nil {
+		releaseBlob(blob.id)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	meta := metadata.ObjectMeta{
+		Bucket:        bucketName,
+		Key:           key,
+		Size:          blob.size,
+		ETag:          blob.objectETag(encryption, dataKey),
+		ContentType:   contentType,
+		LastModified:  time.Now().UTC(),
+		OwnerID:       ownerID,
+		BlobID:        blob.id,
+		FrameIndex:    blob.frameIndex,
+		Retention:     retention,
+		LegalHold:     legalHold,
+		Encryption:    encryption,
+		Compression:   compression,
+		Checksum:      objectChecksum,
+		Tags:          tags,
+		ObjectHeaders: headers,
+	}
+
+	prev, err := metadata.PutObject(ownerID, &meta)
+	if err != nil {
+		log.Printf("PutObject error: %v", err)
+		releaseBlob(blob.id)
+		writeObjectAccessError(w, err)
+		return
+	}
+	if prev != nil {
+		releaseObject(prev)
+	}
+
+	if meta.VersionID != "" {
+		w.Header().Set("x-amz-version-id", meta.VersionID)
+	}
+	setEncryptionHeaders(w, r, meta.Encryption)
+	setChecksumHeader(w, meta.Checksum)
+	w.Header().Set("ETag", quoteETag(meta.ETag))
+	w.WriteHeader(http.StatusOK)
+}
+
+func ObjectGetHandler(w http.ResponseWriter, r *http.Request) {
+	bucketName, ok := parseBucketName(w, r)
+	if !ok {
+		return
+	}
+	key, ok := parseObjectKey(w, r)
+	if !ok {
+		return
+	}
+
+	ownerID := getOwnerID(r)
+	if ownerID == "" {
+		writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+		return
+	}
+
+	if r.URL.Query().Has("retention") {
+		handleGetObjectRetention(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	if r.URL.Query().Has("legal-hold") {
+		handleGetObjectLegalHold(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	if r.URL.Query().Has("tagging") {
+		handleGetObjectTagging(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	if r.URL.Query().Has("uploadId") {
+		handleListParts(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	meta, err := getRequestedObject(r, ownerID, bucketName, key)
+	if err != nil {
+		log.Printf("GetObject error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+	if meta.IsDeleteMarker {
+		setDeleteMarkerHeaders(w, meta)
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	if status := checkPreconditions(r, meta.ETag, meta.LastModified); status != 0 {
+		writePreconditionStatus(w, status, meta)
+		return
+	}
+
+	rng, err := resolveObjectRange(r, meta)
+	if err != nil {
+		writeRangeError(w, err, meta)
+		return
+	}
+	offset, length := int64(0), meta.Size
+	if rng != nil {
+		offset, length = rng.start, rng.length
+	}
+
+	dataKey, err := objectDataKey(r, meta.Encryption, sseCustomerPrefix)
+	if err != nil {
+		writeEncryptionError(w, err)
+		return
+	}
+	rc, err := openObject(meta, dataKey, offset, length)
+	if err != nil {
+		log.Printf("GetObject storage error: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+	defer rc.Close()
+
+	setObjectHeaders(w, meta)
+	setResponseOverrides(w, r)
+	setEncryptionHeaders(w, r, meta.Encryption)
+	if rng == nil && checksumModeEnabled(r) {
+		setChecksumHeader(w, meta.Checksum)
+	}
+	status := writeRangeHeaders(w, rng, meta)
+	w.WriteHeader(status)
+	if _, err := io.Copy(w, rc); err != nil {
+		log.Printf("GetObject copy error: %v", err)
+	}
+}
+
+func ObjectHeadHandler(w http.ResponseWriter, r *http.Request) {
+	bucketName, ok := parseBucketName(w, r)
+	if !ok {
+		return
+	}
+	key, ok := parseObjectKey(w, r)
+	if !ok {
+		return
+	}
+
+	ownerID := getOwnerID(r)
+	if ownerID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	meta, err := getRequestedObject(r, ownerID, bucketName, key)
+	if err != nil {
+		log.Printf("HeadObject error: %v", err)
+		if errors.Is(err, metadata.ErrDeleteMarker) {
+			w.Header().Set("x-amz-delete-marker", "true")
+		}
+		w.WriteHeader(objectErrorStatus(err))
+		return
+	}
+	if meta.IsDeleteMarker {
+		setDeleteMarkerHeaders(w, meta)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// Like GET, HEAD of an SSE-C object needs the customer's key.
+	if _, err := objectDataKey(r, meta.Encryption, sseCustomerPrefix); err != nil {
+		w.WriteHeader(encryptionErrorStatus(err))
+		return
+	}
+
+	if status := checkPreconditions(r, meta.ETag, meta.LastModified); status != 0 {
+		writePreconditionStatus(w, status, meta)
+		return
+	}
+
+	rng, err := resolveObjectRange(r, meta)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRange) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", meta.Size))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	setObjectHeaders(w, meta)
+	setResponseOverrides(w, r)
+	setEncryptionHeaders(w, r, meta.Encryption)
+	if rng == nil && checksumModeEnabled(r) {
+		setChecksumHeader(w, meta.Checksum)
+	}
+	w.WriteHeader(writeRangeHeaders(w, rng, meta))
+}
+
+func ObjectDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	bucketName, ok := parseBucketName(w, r)
+	if !ok {
+		return
+	}
+	key, ok := parseObjectKey(w, r)
+	if !ok {
+		return
+	}
+
+	ownerID := getOwnerID(r)
+	if ownerID == "" {
+		writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+		return
+	}
+
+	if r.URL.Query().Has("uploadId") {
+		handleAbortMultipartUpload(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	if r.URL.Query().Has("tagging") {
+		handleDeleteObjectTagging(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	q := r.URL.Query()
+	res, err := deleteObject(ownerID, bucketName, key, q.Get("versionId"), q.Has("versionId"), bypassGovernance(r))
+	if err != nil {
+		log.Printf("DeleteObject error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+
+	if res.VersionID != "" {
+		w.Header().Set("x-amz-version-id", res.VersionID)
+	}
+	if res.DeleteMarker {
+		w.Header().Set("x-amz-delete-marker", "true")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func ObjectPostHandler(w http.ResponseWriter, r *http.Request) {
+	bucketName, ok := parseBucketName(w, r)
+	if !ok {
+		return
+	}
+	key, ok := parseObjectKey(w, r)
+	if !ok {
+		return
+	}
+
+	ownerID := getOwnerID(r)
+	if ownerID == "" {
+		writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+		return
+	}
+
+	if r.URL.Query().Has("uploads") {
+		handleCreateMultipartUpload(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	if r.URL.Query().Has("uploadId") {
+		handleCompleteMultipartUpload(w, r, ownerID, bucketName, key)
+		return
+	}
+
+	writeError(w, http.StatusBadRequest, ErrBadRequest)
+}
+
+func setObjectHeaders(w http.ResponseWriter, meta *metadata.ObjectMeta) {
+	h := w.Header()
+	h.Set("Content-Type", meta.ContentType)
+	setStoredHeaders(h, &meta.ObjectHeaders)
+	h.Set("Content-Length", strconv.FormatInt(meta.Size, 10))
+	h.Set("ETag", quoteETag(meta.ETag))
+	h.Set("Last-Modified", meta.LastModified.UTC().Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	if len(meta.Parts) > 0 {
+		h.Set("x-amz-mp-parts-count", strconv.Itoa(len(meta.Parts)))
+	}
+	if meta.VersionID != "" {
+		h.Set("x-amz-version-id", meta.VersionID)
+	}
+	setObjectLockHeaders(h, meta)
+	setTaggingCountHeader(h, meta)
+}
+
+func setDeleteMarkerHeaders(w http.ResponseWriter, meta *metadata.ObjectMeta) {
+	w.Header().Set("x-amz-delete-marker", "true")
+	w.Header().Set("x-amz-version-id", meta.VersionID)
+	w.Header().Set("Last-Modified", meta.LastModified.UTC().Format(http.TimeFormat))
+}
+
+// getRequestedObject resolves the version a GET or HEAD asked for: a
+// specific one with ?versionId=, otherwise the newest.
+func getRequestedObject(r *http.Request, ownerID string, bucketName string, key string) (*metadata.ObjectMeta, error) {
+	if r.URL.Query().Has("versionId") {
+		return metadata.GetObjectVersion(ownerID, bucketName, key, r.URL.Query().Get("versionId"))
+	}
+	return metadata.GetObject(ownerID, bucketName, key)
+}
+
+// writeRangeHeaders adjusts the length headers for a partial response and
+// returns the status code to send.
+func writeRangeHeaders(w http.ResponseWriter, rng *byteRange, meta *metadata.ObjectMeta) int {
+	if rng == nil {
+		return http.StatusOK
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(rng.length, 10))
+	w.Header().Set("Content-Range", rng.contentRange(meta.Size))
+	return http.StatusPartialContent
+}
+
+func writeRangeError(w http.ResponseWriter, err error, meta *metadata.ObjectMeta) {
+	if errors.Is(err, ErrInvalidRange) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", meta.Size))
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, ErrInvalidRange)
+		return
+	}
+	writeError(w, http.StatusBadRequest, err)
+}
+
+type storedBlob struct {
+	id         string
+	size       int64
+	etag       string
+	frameIndex []int64
+}
+
+// storeBlob streams r into a new blob and computes its MD5 ETag on the way.
+// The blob is compressed with the named codec, if any, and then encrypted
+// when there is a data key; the size and ETag still describe the bytes
+// that were uploaded.
+func storeBlob(r io.Reader, dataKey []byte, compression string) (*storedBlob, error) {
+	id := storage.NewBlobID()
+	hash := md5.New()
+	src := io.TeeReader(r, hash)
+
+	var cr *storage.CompressReader
+	if compression != "" {
+		var err error
+		cr, err = storage.NewCompressReader(src, compression)
+		if err != nil {
+			return nil, err
+		}
+		src = cr
+	}
+
+	var size int64
+	var err error
+	if dataKey != nil {
+		size, err = storage.PutEncrypted(storage.Blobs, id, src, dataKey)
+	} else {
+		size, err = storage.Blobs.Put(id, src)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	blob := &storedBlob{
+		id:   id,
+		size: size,
+		etag: hex.EncodeToString(hash.Sum(nil)),
+	}
+	if cr != nil {
+		blob.size = cr.Size()
+		blob.frameIndex = cr.Index()
+	}
+	return blob, nil
+}
+
+// objectETag is the ETag to record the blob with: its MD5, or for SSE-C
+// the customerKeyETag of it.
+func (b *storedBlob) objectETag(enc *metadata.ObjectEncryption, dataKey []byte) string {
+	if enc == nil || !enc.IsCustomerKey() {
+		return b.etag
+	}
+	sum, err := hex.DecodeString(b.etag)
+	if err != nil {
+		return b.etag
+	}
+	return hex.EncodeToString(customerKeyETag(dataKey, sum))
+}
+
+// releaseBlob deletes a blob that is no longer referenced by any metadata.
+// Failures only leak disk space, so they are logged rather than surfaced.
+func releaseBlob(blobID string) {
+	if blobID == "" {
+		return
+	}
+	if err := storage.Blobs.Delete(blobID); err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+		log.Printf("release blob %s error: %v", blobID, err)
+	}
+}
+
+func quoteETag(etag string) string {
+	return `"` + etag + `"`
+}
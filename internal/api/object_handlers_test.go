@@ -0,0 +1,76 @@
+package api
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestObjectCRUD(t *testing.T) {
+	s := newTestServer(t)
+	resp, body := s.do("PUT", "/crud", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+
+	const key = "/crud/dir/a%20b.txt"
+	data := "hello, object"
+	sum := md5.Sum([]byte(data))
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	resp, body = s.do("PUT", "/missing/obj", data, nil)
+	s.mustStatus(resp, body, http.StatusNotFound)
+	resp, body = s.do("PUT", "/crud/a%00b", data, nil)
+	s.mustStatus(resp, body, http.StatusBadRequest)
+	resp, body = s.do("PUT", "/crud/"+strings.Repeat("k", maxObjectKeyLen+1), data, nil)
+	s.mustStatus(resp, body, http.StatusBadRequest)
+	resp, body = s.do("PUT", key, data, map[string]string{"Content-Type": "text/plain"})
+	s.mustStatus(resp, body, http.StatusOK)
+	if got := resp.Header.Get("ETag"); got != etag {
+		t.Errorf("PUT ETag = %s; want %s", got, etag)
+	}
+
+	resp, body = s.do("GET", key, "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if body != data || resp.Header.Get("ETag") != etag || resp.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("GET = %q, ETag %s, Content-Type %s", body, resp.Header.Get("ETag"), resp.Header.Get("Content-Type"))
+	}
+	resp, body = s.do("HEAD", key, "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if got := resp.Header.Get("Content-Length"); got != strconv.Itoa(len(data)) || body != "" {
+		t.Errorf("HEAD Content-Length = %s, body %q", got, body)
+	}
+	resp, body = s.do("GET", key+"?partNumber=1", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if body != data || resp.Header.Get("x-amz-mp-parts-count") != "" {
+		t.Errorf("GET part 1 = %q, parts count %q; want the whole object and no count", body, resp.Header.Get("x-amz-mp-parts-count"))
+	}
+
+	// Another owner can neither read nor delete the object.
+	other := s.as("someone-else")
+	resp, body = other.do("GET", key, "", nil)
+	other.mustStatus(resp, body, http.StatusForbidden)
+	resp, body = other.do("DELETE", key, "", nil)
+	other.mustStatus(resp, body, http.StatusForbidden)
+
+	resp, body = s.do("PUT", key, "replaced", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	resp, body = s.do("GET", key, "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if body != "replaced" {
+		t.Errorf("GET after overwrite = %q", body)
+	}
+
+	resp, body = s.do("DELETE", key, "", nil)
+	s.mustStatus(resp, body, http.StatusNoContent)
+	resp, body = s.do("GET", key, "", nil)
+	s.mustStatus(resp, body, http.StatusNotFound)
+	resp, body = s.do("HEAD", key, "", nil)
+	s.mustStatus(resp, body, http.StatusNotFound)
+	// Deleting what is not there succeeds, as in S3.
+	resp, body = s.do("DELETE", key, "", nil)
+	s.mustStatus(resp, body, http.StatusNoContent)
+	resp, body = s.do("DELETE", "/crud", "", nil)
+	s.mustStatus(resp, body, http.StatusNoContent)
+}
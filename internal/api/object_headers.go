@@ -0,0 +1,86 @@
+package api
+
+import (
+	"doss/internal/metadata"
+	"net/http"
+	"strings"
+)
+
+const (
+	userMetadataPrefix = "x-amz-meta-"
+
+	// maxUserMetadataSize is S3's limit on the x-amz-meta-* headers of an
+	// object, names and values together.
+	maxUserMetadataSize = 2 << 10
+)
+
+// responseOverrides are the query parameters a GET may use to replace
+// stored headers in its response, such as to force a download filename.
+var responseOverrides = map[string]string{
+	"response-content-type":        "Content-Type",
+	"response-content-language":    "Content-Language",
+	"response-expires":             "Expires",
+	"response-cache-control":       "Cache-Control",
+	"response-content-disposition": "Content-Disposition",
+	"response-content-encoding":    "Content-Encoding",
+}
+
+// parseObjectHeaders reads the headers a PUT, copy or CreateMultipartUpload
+// stores with the object it creates.
+func parseObjectHeaders(w http.ResponseWriter, r *http.Request) (metadata.ObjectHeaders, bool) {
+	h := metadata.ObjectHeaders{
+		ContentEncoding:    r.Header.Get("Content-Encoding"),
+		ContentDisposition: r.Header.Get("Content-Disposition"),
+		ContentLanguage:    r.Header.Get("Content-Language"),
+		CacheControl:       r.Header.Get("Cache-Control"),
+		Expires:            r.Header.Get("Expires"),
+	}
+
+	size := 0
+	for name, values := range r.Header {
+		name = strings.ToLower(name)
+		key, ok := strings.CutPrefix(name, userMetadataPrefix)
+		if !ok || key == "" {
+			continue
+		}
+		if h.UserMetadata == nil {
+			h.UserMetadata = make(map[string]string)
+		}
+		value := strings.Join(values, ",")
+		h.UserMetadata[key] = value
+		size += len(key) + len(value)
+	}
+	if size > maxUserMetadataSize {
+		writeError(w, http.StatusBadRequest, ErrMetadataTooLarge)
+		return metadata.ObjectHeaders{}, false
+	}
+	return h, true
+}
+
+func setStoredHeaders(h http.Header, stored *metadata.ObjectHeaders) {
+	for name, value := range map[string]string{
+		"Content-Encoding":    stored.ContentEncoding,
+		"Content-Disposition": stored.ContentDisposition,
+		"Content-Language":    stored.ContentLanguage,
+		"Cache-Control":       stored.CacheControl,
+		"Expires":             stored.Expires,
+	} {
+		if value != "" {
+			h.Set(name, value)
+		}
+	}
+	for k, v := range stored.UserMetadata {
+		h.Set(userMetadataPrefix+k, v)
+	}
+}
+
+// setResponseOverrides applies the response-* query parameters of a GET
+// or HEAD on top of the stored headers.
+func setResponseOverrides(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	for param, header := range responseOverrides {
+		if q.Has(param) {
+			w.Header().Set(header, q.Get(param))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestObjectHeaders(t *testing.T) {
+	s := newTestServer(t)
+	resp, body := s.do("PUT", "/headers", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+
+	stored := map[string]string{
+		"Content-Type":        "text/plain",
+		"Content-Encoding":    "br",
+		"Content-Disposition": `attachment; filename="a.txt"`,
+		"Content-Language":    "en",
+		"Cache-Control":       "max-age=60",
+		"Expires":             "Wed, 21 Oct 2026 07:28:00 GMT",
+		"x-amz-meta-Color":    "blue",
+	}
+	check := func(target string, want map[string]string, query string) {
+		t.Helper()
+		resp, body := s.do("HEAD", target+query, "", nil)
+		s.mustStatus(resp, body, http.StatusOK)
+		for name, value := range want {
+			if got := resp.Header.Get(name); got != value {
+				t.Errorf("%s%s: %s = %q; want %q", target, query, name, got, value)
+			}
+		}
+	}
+	wantStored := map[string]string{}
+	for k, v := range stored {
+		wantStored[k] = v
+	}
+	wantStored["x-amz-meta-color"] = "blue"
+
+	resp, body = s.do("PUT", "/headers/put", "data", stored)
+	s.mustStatus(resp, body, http.StatusOK)
+	check("/headers/put", wantStored, "")
+
+	resp, body = s.multipart("/headers/multipart", stored, "data")
+	s.mustStatus(resp, body, http.StatusOK)
+	check("/headers/multipart", wantStored, "")
+
+	// A copy keeps the source's headers unless told to replace them.
+	resp, body = s.do("PUT", "/headers/copied", "", map[string]string{
+		"x-amz-copy-source": "/headers/put",
+		"x-amz-meta-color":  "ignored",
+	})
+	s.mustStatus(resp, body, http.StatusOK)
+	check("/headers/copied", wantStored, "")
+
+	resp, body = s.do("PUT", "/headers/replaced", "", map[string]string{
+		"x-amz-copy-source":        "/headers/put",
+		"x-amz-metadata-directive": "REPLACE",
+		"Content-Type":             "application/json",
+		"x-amz-meta-shape":         "round",
+	})
+	s.mustStatus(resp, body, http.StatusOK)
+	check("/headers/replaced", map[string]string{
+		"Content-Type":     "application/json",
+		"Cache-Control":    "",
+		"x-amz-meta-color": "",
+		"x-amz-meta-shape": "round",
+	}, "")
+
+	// response-* parameters override what is stored, for GET and HEAD.
+	query := "?response-content-type=image%2Fpng&response-cache-control=no-cache&response-content-disposition=inline"
+	check("/headers/put", map[string]string{
+		"Content-Type":        "image/png",
+		"Cache-Control":       "no-cache",
+		"Content-Disposition": "inline",
+		"Content-Language":    "en",
+	}, query)
+	resp, body = s.do("GET", "/headers/put"+query, "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if got := resp.Header.Get("Content-Type"); got != "image/png" || body != "data" {
+		t.Errorf("GET with overrides: Content-Type %q, body %q", got, body)
+	}
+
+	// User metadata is limited to 2 KB, names and values together.
+	big := map[string]string{"x-amz-meta-big": strings.Repeat("x", maxUserMetadataSize-len("big"))}
+	resp, body = s.do("PUT", "/headers/big", "data", big)
+	s.mustStatus(resp, body, http.StatusOK)
+	big["x-amz-meta-more"] = "x"
+	resp, body = s.do("PUT", "/headers/big", "data", big)
+	s.mustStatus(resp, body, http.StatusBadRequest)
+	if !strings.Contains(body, ErrMetadataTooLarge.Error()) {
+		t.Errorf("PUT over the limit: body %s", body)
+	}
+	replace := map[string]string{"x-amz-copy-source": "/headers/put", "x-amz-metadata-directive": "REPLACE"}
+	for k, v := range big {
+		replace[k] = v
+	}
+	resp, body = s.do("PUT", "/headers/big-copy", "", replace)
+	s.mustStatus(resp, body, http.StatusBadRequest)
+	resp, body = s.do("POST", "/headers/big-upload?uploads", "", big)
+	s.mustStatus(resp, body, http.StatusBadRequest)
+}
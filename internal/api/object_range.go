@@ -0,0 +1,112 @@
+package api
+
+import (
+	"doss/internal/metadata"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.start+br.length-1, size)
+}
+
+// resolveObjectRange works out which bytes of the object a GET or HEAD
+// asked for, via either a Range header or ?partNumber=. A nil range means
+// the whole object.
+func resolveObjectRange(r *http.Request, meta *metadata.ObjectMeta) (*byteRange, error) {
+	rangeHeader := r.Header.Get("Range")
+	partNumber := r.URL.Query().Get("partNumber")
+
+	if partNumber != "" {
+		if rangeHeader != "" {
+			return nil, ErrInvalidPartNumber
+		}
+		n, err := strconv.Atoi(partNumber)
+		if err != nil || n < 1 {
+			return nil, ErrInvalidPartNumber
+		}
+		return partRange(meta, n)
+	}
+
+	if rangeHeader == "" {
+		return nil, nil
+	}
+	return parseRange(rangeHeader, meta.Size)
+}
+
+func partRange(meta *metadata.ObjectMeta, number int) (*byteRange, error) {
+	segments := meta.Segments()
+	if number > len(segments) {
+		return nil, ErrInvalidRange
+	}
+	// An object not uploaded in parts is its own part 1, served whole as a
+	// plain GET would serve it.
+	if len(meta.Parts) == 0 {
+		return nil, nil
+	}
+	start := int64(0)
+	for _, seg := range segments[:number-1] {
+		start += seg.Size
+	}
+	size := segments[number-1].Size
+	// An empty part has no byte range to report. An empty object is served
+	// whole.
+	if size == 0 {
+		if meta.Size == 0 {
+			return nil, nil
+		}
+		return nil, ErrInvalidRange
+	}
+	return &byteRange{start: start, length: size}, nil
+}
+
+// parseRange understands a single "bytes=" range. Syntactically invalid or
+// multi-range headers are ignored, as RFC 9110 allows, and the full object is
+// served instead.
+func parseRange(header string, size int64) (*byteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, nil
+	}
+
+	if first == "" {
+		// Suffix range: the last N bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil
+		}
+		if n == 0 || size == 0 {
+			return nil, ErrInvalidRange
+		}
+		n = min(n, size)
+		return &byteRange{start: size - n, length: n}, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return nil, nil
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return nil, ErrInvalidRange
+	}
+	return &byteRange{start: start, length: end - start + 1}, nil
+}
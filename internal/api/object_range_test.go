@@ -0,0 +1,73 @@
+package api
+
+import (
+	"doss/internal/metadata"
+	"errors"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		size   int64
+		want   *byteRange
+		err    error
+	}{
+		{"bytes=0-9", 100, &byteRange{0, 10}, nil},
+		{"bytes=10-", 100, &byteRange{10, 90}, nil},
+		{"bytes=90-200", 100, &byteRange{90, 10}, nil},
+		{"bytes=-10", 100, &byteRange{90, 10}, nil},
+		{"bytes=-200", 100, &byteRange{0, 100}, nil},
+		{"bytes=99-99", 100, &byteRange{99, 1}, nil},
+		{"bytes=100-", 100, nil, ErrInvalidRange},
+		{"bytes=100-200", 100, nil, ErrInvalidRange},
+		{"bytes=-0", 100, nil, ErrInvalidRange},
+		{"bytes=-10", 0, nil, ErrInvalidRange},
+		{"bytes=0-", 0, nil, ErrInvalidRange},
+		// Headers that cannot be parsed, and multiple ranges, are ignored
+		// and the whole object is served.
+		{"bytes=0-9,20-29", 100, nil, nil},
+		{"bytes=9-0", 100, nil, nil},
+		{"bytes=a-b", 100, nil, nil},
+		{"bytes=10", 100, nil, nil},
+		{"items=0-9", 100, nil, nil},
+	}
+	for _, tt := range tests {
+		got, err := parseRange(tt.header, tt.size)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("parseRange(%q, %d) error = %v; want %v", tt.header, tt.size, err, tt.err)
+			continue
+		}
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("parseRange(%q, %d) = %+v; want %+v", tt.header, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestPartRange(t *testing.T) {
+	multipart := &metadata.ObjectMeta{
+		Size:  15,
+		Parts: []metadata.ObjectPart{{Number: 1, Size: 10}, {Number: 2, Size: 5}},
+	}
+	if got, err := partRange(multipart, 2); err != nil || *got != (byteRange{10, 5}) {
+		t.Errorf("part 2 = %+v, %v; want bytes 10-14", got, err)
+	}
+	if _, err := partRange(multipart, 3); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("part 3 of 2: got %v; want ErrInvalidRange", err)
+	}
+
+	// An object not uploaded in parts is served whole as its part 1.
+	single := &metadata.ObjectMeta{Size: 10}
+	if got, err := partRange(single, 1); err != nil || got != nil {
+		t.Errorf("part 1 of a single-part object = %+v, %v; want the whole object", got, err)
+	}
+	if _, err := partRange(single, 2); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("part 2 of a single-part object: got %v; want ErrInvalidRange", err)
+	}
+
+	// An empty object has a part 1 with nothing in it.
+	empty := &metadata.ObjectMeta{}
+	if got, err := partRange(empty, 1); err != nil || got != nil {
+		t.Errorf("part 1 of an empty object = %+v, %v; want the whole object", got, err)
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"doss/internal/metadata"
+	"doss/internal/storage"
+	"io"
+)
+
+type segmentRange struct {
+	blobID     string
+	size       int64
+	etag       string
+	etagKey    []byte
+	frameIndex []int64
+	offset     int64
+	length     int64
+}
+
+// storedSize is the size of the byte stream that gets encrypted: the blob
+// itself, or its compressed frames.
+func (s segmentRange) storedSize() int64 {
+	if n := len(s.frameIndex); n > 0 {
+		return s.frameIndex[n-1]
+	}
+	return s.size
+}
+
+// segmentReader streams a byte range that may span several blobs, opening
+// each blob only once the previous one has been drained.
+type segmentReader struct {
+	ranges      []segmentRange
+	dataKey     []byte
+	compression string
+	cur         io.ReadCloser
+}
+
+// openObject returns a reader over length bytes of the object starting at
+// offset, decrypting with dataKey when it is set and decompressing when the
+// object is compressed. Blobs read in full are checked against their MD5. A
+// range covering only part of a blob goes unchecked, since the MD5 and
+// checksum describe the whole blob, except that the frames of an encrypted
+// blob are still authenticated as they are opened. The first blob is opened
+// eagerly so a missing blob is reported before any response headers are
+// written.
+func openObject(meta *metadata.ObjectMeta, dataKey []byte, offset int64, length int64) (io.ReadCloser, error) {
+	var etagKey []byte
+	if meta.Encryption != nil && meta.Encryption.IsCustomerKey() {
+		etagKey = dataKey
+	}
+	var ranges []segmentRange
+	pos := int64(0)
+	end := offset + length
+	for _, seg := range meta.Segments() {
+		segStart, segEnd := pos, pos+seg.Size
+		pos = segEnd
+		if segEnd <= offset || segStart >= end {
+			continue
+		}
+		from := max(offset, segStart) - segStart
+		to := min(end, segEnd) - segStart
+		ranges = append(ranges, segmentRange{
+			blobID:     seg.BlobID,
+			size:       seg.Size,
+			etag:       seg.ETag,
+			etagKey:    etagKey,
+			frameIndex: seg.FrameIndex,
+			offset:     from,
+			length:     to - from,
+		})
+	}
+
+	r := &segmentReader{ranges: ranges, dataKey: dataKey, compression: meta.Compression}
+	if err := r.next(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *segmentReader) next() error {
+	if len(r.ranges) == 0 {
+		return nil
+	}
+	seg := r.ranges[0]
+	r.ranges = r.ranges[1:]
+	open := func(offset int64, length int64) (io.ReadCloser, error) {
+		if r.dataKey != nil {
+			return storage.GetEncrypted(storage.Blobs, seg.blobID, r.dataKey, seg.storedSize(), offset, length)
+		}
+		return storage.Blobs.Get(seg.blobID, offset, length)
+	}
+	var rc io.ReadCloser
+	var err error
+	if r.compression != "" {
+		rc, err = storage.OpenCompressed(open, r.compression, seg.frameIndex, seg.size, seg.offset, seg.length)
+	} else {
+		rc, err = open(seg.offset, seg.length)
+	}
+	if err != nil {
+		return err
+	}
+	if seg.offset == 0 && seg.length == seg.size {
+		rc = newVerifyReader(rc, seg.blobID, seg.etag, seg.etagKey, seg.size)
+	}
+	r.cur = rc
+	return nil
+}
+
+func (r *segmentReader) Read(p []byte) (int, error) {
+	for r.cur != nil {
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if err := r.next(); err != nil {
+				return n, err
+			}
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+	return 0, io.EOF
+}
+
+func (r *segmentReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
+
+// releaseObject deletes every blob that backs meta.
+func releaseObject(meta *metadata.ObjectMeta) {
+	for _, seg := range meta.Segments() {
+		releaseBlob(seg.BlobID)
+	}
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"doss/internal/auth"
+	"doss/internal/metadata"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	legalHoldOn  = "ON"
+	legalHoldOff = "OFF"
+)
+
+type objectRetentionXML struct {
+	XMLName         xml.Name `xml:"Retention"`
+	Xmlns           string   `xml:"xmlns,attr,omitempty"`
+	Mode            string   `xml:"Mode,omitempty"`
+	RetainUntilDate string   `xml:"RetainUntilDate,omitempty"`
+}
+
+type objectLegalHoldXML struct {
+	XMLName xml.Name `xml:"LegalHold"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Status  string   `xml:"Status"`
+}
+
+func handleGetObjectLockConfig(w http.ResponseWriter, ownerID string, bucketName string) {
+	cfg, err := metadata.GetObjectLockConfig(ownerID, bucketName)
+	if err != nil {
+		log.Printf("GetObjectLockConfig error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+func handlePutObjectLockConfig(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) {
+	var cfg metadata.ObjectLockConfig
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		log.Printf("handlePutObjectLockConfig Decode error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+	err := metadata.PutObjectLockConfig(ownerID, bucketName, &cfg)
+	if errors.Is(err, metadata.ErrInvalidObjectLockConfig) {
+		log.Printf("PutObjectLockConfig error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("PutObjectLockConfig error: %v", err)
+		writeBucketAccessError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleGetObjectRetention(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	ret, err := metadata.GetObjectRetention(ownerID, bucketName, key, r.URL.Query().Get("versionId"))
+	if err != nil {
+		log.Printf("GetObjectRetention error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+
+	writeXML(w, http.StatusOK, objectRetentionXML{
+		Xmlns:           s3XMLNamespace,
+		Mode:            ret.Mode,
+		RetainUntilDate: ret.RetainUntil.UTC().Format(s3TimeFormat),
+	})
+}
+
+// handlePutObjectRetention sets a version's retention. An empty Retention
+// element removes it, which for governance mode needs the bypass header.
+func handlePutObjectRetention(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	var req objectRetentionXML
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		log.Printf("handlePutObjectRetention Decode error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrMalformedXML)
+		return
+	}
+
+	var ret *metadata.ObjectRetention
+	if req.Mode != "" || req.RetainUntilDate != "" {
+		until, err := time.Parse(time.RFC3339, req.RetainUntilDate)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrMalformedXML)
+			return
+		}
+		ret = &metadata.ObjectRetention{Mode: req.Mode, RetainUntil: until.UTC()}
+	}
+
+	err := metadata.PutObjectRetention(ownerID, bucketName, key, r.URL.Query().Get("versionId"), ret, bypassGovernance(r))
+	if err != nil {
+		log.Printf("PutObjectRetention error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func handleGetObjectLegalHold(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	on, err := metadata.GetObjectLegalHold(ownerID, bucketName, key, r.URL.Query().Get("versionId"))
+	if err != nil {
+		log.Printf("GetObjectLegalHold error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+
+	status := legalHoldOff
+	if on {
+		status = legalHoldOn
+	}
+	writeXML(w, http.StatusOK, objectLegalHoldXML{Xmlns: s3XMLNamespace, Status: status})
+}
+
+func handlePutObjectLegalHold(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	var req objectLegalHoldXML
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		log.Printf("handlePutObjectLegalHold Decode error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrMalformedXML)
+		return
+	}
+	if req.Status != legalHoldOn && req.Status != legalHoldOff {
+		writeError(w, http.StatusBadRequest, ErrMalformedXML)
+		return
+	}
+
+	err := metadata.PutObjectLegalHold(ownerID, bucketName, key, r.URL.Query().Get("versionId"), req.Status == legalHoldOn)
+	if err != nil {
+		log.Printf("PutObjectLegalHold error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// parseObjectLockHeaders reads the retention and legal hold a PUT or copy
+// may set on the version it creates. Mode and date must come together.
+func parseObjectLockHeaders(w http.ResponseWriter, r *http.Request) (*metadata.ObjectRetention, bool, bool) {
+	mode := r.Header.Get("x-amz-object-lock-mode")
+	until := r.Header.Get("x-amz-object-lock-retain-until-date")
+	hold := r.Header.Get("x-amz-object-lock-legal-hold")
+
+	var ret *metadata.ObjectRetention
+	if mode != "" || until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+			return nil, false, false
+		}
+		ret = &metadata.ObjectRetention{Mode: mode, RetainUntil: t.UTC()}
+		if err := metadata.ValidateRetention(ret); err != nil {
+			writeError(w, http.StatusBadRequest, ErrInvalidRetention)
+			return nil, false, false
+		}
+	}
+	if hold != "" && hold != legalHoldOn && hold != legalHoldOff {
+		writeError(w, http.StatusBadRequest, ErrInvalidArgument)
+		return nil, false, false
+	}
+	return ret, hold == legalHoldOn, true
+}
+
+func setObjectLockHeaders(h http.Header, meta *metadata.ObjectMeta) {
+	if meta.Retention != nil {
+		h.Set("x-amz-object-lock-mode", meta.Retention.Mode)
+		h.Set("x-amz-object-lock-retain-until-date", meta.Retention.RetainUntil.UTC().Format(s3TimeFormat))
+	}
+	if meta.LegalHold {
+		h.Set("x-amz-object-lock-legal-hold", legalHoldOn)
+	}
+}
+
+// bypassGovernance reports whether the request may override governance
+// retention: it has to ask for it and be signed by an admin.
+func bypassGovernance(r *http.Request) bool {
+	return r.Header.Get("x-amz-bypass-governance-retention") == "true" && auth.IsAdmin(r.Context())
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObjectLockHandlers(t *testing.T) {
+	s := newTestServer(t)
+	resp, body := s.do("PUT", "/locked", "", map[string]string{"x-amz-bucket-object-lock-enabled": "true"})
+	s.mustStatus(resp, body, http.StatusOK)
+
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	governance := map[string]string{
+		"x-amz-object-lock-mode":              "GOVERNANCE",
+		"x-amz-object-lock-retain-until-date": until,
+	}
+	resp, body = s.do("PUT", "/locked/doc", "data", governance)
+	s.mustStatus(resp, body, http.StatusOK)
+	versionID := resp.Header.Get("x-amz-version-id")
+
+	// Bypassing governance retention takes an admin credential; a tenant
+	// key of the same owner asking for it is still refused.
+	bypass := map[string]string{"x-amz-bypass-governance-retention": "true"}
+	tenant := s.as(testOwnerID)
+	resp, body = tenant.do("DELETE", "/locked/doc?versionId="+versionID, "", bypass)
+	tenant.mustStatus(resp, body, http.StatusForbidden)
+	resp, body = s.do("DELETE", "/locked/doc?versionId="+versionID, "", nil)
+	s.mustStatus(resp, body, http.StatusForbidden)
+	resp, body = s.do("DELETE", "/locked/doc?versionId="+versionID, "", bypass)
+	s.mustStatus(resp, body, http.StatusNoContent)
+
+	// Multipart uploads take their lock from the request that starts them.
+	compliance := map[string]string{
+		"x-amz-object-lock-mode":              "COMPLIANCE",
+		"x-amz-object-lock-retain-until-date": until,
+		"x-amz-object-lock-legal-hold":        "ON",
+	}
+	resp, body = s.multipart("/locked/big", compliance, "part")
+	s.mustStatus(resp, body, http.StatusOK)
+	resp, body = s.do("HEAD", "/locked/big", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if got := resp.Header.Get("x-amz-object-lock-mode"); got != "COMPLIANCE" {
+		t.Errorf("multipart lock mode = %q; want COMPLIANCE", got)
+	}
+	if got := resp.Header.Get("x-amz-object-lock-legal-hold"); got != "ON" {
+		t.Errorf("multipart legal hold = %q; want ON", got)
+	}
+
+	resp, body = s.do("PUT", "/plain", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	resp, body = s.do("POST", "/plain/big?uploads", "", compliance)
+	s.mustStatus(resp, body, http.StatusBadRequest)
+	if !strings.Contains(body, ErrObjectLockNotEnabled.Error()) {
+		t.Errorf("lock headers on a plain bucket: body %s", body)
+	}
+}
@@ -2,8 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"encoding/xml"
+	"io"
 	"log"
 	"net/http"
+	"strings"
 )
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -20,3 +23,24 @@ func writeError(w http.ResponseWriter, status int, msg error) {
 		"error": msg.Error(),
 	})
 }
+
+// xmlEntities rewrites encoding/xml's numeric escapes into the named entities
+// S3 itself emits, so quoted ETags come out byte-for-byte like AWS.
+var xmlEntities = strings.NewReplacer("&#34;", "&quot;", "&#39;", "&apos;")
+
+// writeXML is used for the S3 wire protocol, where clients parse XML bodies.
+func writeXML(w http.ResponseWriter, status int, v any) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		log.Printf("failed to encode XML response: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+
+	if _, err := io.WriteString(w, xml.Header+xmlEntities.Replace(string(body))); err != nil {
+		log.Printf("failed to write XML response: %v", err)
+	}
+}
@@ -14,8 +14,9 @@ func RegisterRoutes() http.Handler {
 	r.Use(middleware.Logger)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "X-Amz-Date", "X-Amz-Content-Sha256", "X-Amz-Security-Token"},
+		ExposedHeaders:   []string{"ETag", "Content-Range", "Accept-Ranges", "x-amz-version-id", "x-amz-delete-marker"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -27,15 +28,36 @@ func RegisterRoutes() http.Handler {
 
 		r.Get("/", BucketListHandler)
 		r.Put("/{bucket}", BucketPutHandler)
-		r.Get("/{bucket}", BucketGetHandler) // TODO: Change to ListObjects/ListObjectsV2
+		r.Get("/{bucket}", BucketGetHandler)
 		r.Delete("/{bucket}", BucketDeleteHandler)
+		r.Post("/{bucket}", BucketPostHandler)
 		r.Head("/{bucket}", BucketHeadHandler)
 
+		r.Put("/{bucket}/*", ObjectPutHandler)
+		r.Get("/{bucket}/*", ObjectGetHandler)
+		r.Head("/{bucket}/*", ObjectHeadHandler)
+		r.Delete("/{bucket}/*", ObjectDeleteHandler)
+		r.Post("/{bucket}/*", ObjectPostHandler)
+
 		r.Get("/doss/v1/targets", TargetCollectionGetHandler)
 		r.Get("/doss/v1/targets/{targetID}", TargetItemGetHandler)
 		r.Put("/doss/v1/targets/{targetID}", TargetItemPutHandler)
 		r.Delete("/doss/v1/targets/{targetID}", TargetItemDeleteHandler)
 
+		r.Get("/doss/v1/kms/keys", KeyCollectionGetHandler)
+		r.Get("/doss/v1/kms/keys/{keyID}", KeyItemGetHandler)
+		r.Put("/doss/v1/kms/keys/{keyID}", KeyItemPutHandler)
+		r.Post("/doss/v1/kms/keys/{keyID}/rotate", KeyRotateHandler)
+
+		r.Post("/doss/v1/storage/heal", StorageHealHandler)
+
+		r.Get("/doss/v1/admin/access-keys", AccessKeyCollectionGetHandler)
+		r.Post("/doss/v1/admin/access-keys", AccessKeyCollectionPostHandler)
+		r.Get("/doss/v1/admin/access-keys/{accessKeyID}", AccessKeyItemGetHandler)
+		r.Delete("/doss/v1/admin/access-keys/{accessKeyID}", AccessKeyItemDeleteHandler)
+		r.Put("/doss/v1/admin/access-keys/{accessKeyID}/status", AccessKeyStatusPutHandler)
+		r.Post("/doss/v1/admin/access-keys/{accessKeyID}/rotate", AccessKeyRotateHandler)
+
 	})
 
 	return r
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"doss/internal/auth"
+	"doss/internal/kms"
+	"doss/internal/metadata"
+	"doss/internal/storage"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testRootAccessKey = "root"
+	testRootSecretKey = "root-secret"
+	// testOwnerID is the owner the root key acts for.
+	testOwnerID = "local-dev-user"
+)
+
+// testServer runs the full router over fresh metadata, blob and key stores
+// and signs every request with SigV4, as an S3 client would.
+type testServer struct {
+	t      *testing.T
+	url    string
+	client *http.Client
+
+	accessKey string
+	secretKey string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	dir := t.TempDir()
+	metadata.InitDB(filepath.Join(dir, "db"))
+	t.Cleanup(metadata.CloseDB)
+	blobs, err := storage.NewFSBackend(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatalf("NewFSBackend: %v", err)
+	}
+	storage.Blobs = blobs
+	keys, err := kms.OpenLocal(filepath.Join(dir, "keystore"), filepath.Join(dir, "master.key"))
+	if err != nil {
+		t.Fatalf("OpenLocal: %v", err)
+	}
+	kms.Keys = keys
+	auth.InitKeyStore(testRootAccessKey, testRootSecretKey)
+
+	srv := httptest.NewServer(RegisterRoutes())
+	t.Cleanup(srv.Close)
+	return &testServer{t: t, url: srv.URL, client: srv.Client(), accessKey: testRootAccessKey, secretKey: testRootSecretKey}
+}
+
+// as returns a server handle that signs with a new, non-admin access key of
+// ownerID.
+func (s *testServer) as(ownerID string) *testServer {
+	s.t.Helper()
+	k, secret, err := auth.CreateAccessKey(ownerID)
+	if err != nil {
+		s.t.Fatalf("CreateAccessKey: %v", err)
+	}
+	c := *s
+	c.accessKey, c.secretKey = k.AccessKeyID, secret
+	return &c
+}
+
+// do sends a signed request and returns the response with its body read.
+// target is a path with an optional query string.
+func (s *testServer) do(method string, target string, body string, headers map[string]string) (*http.Response, string) {
+	s.t.Helper()
+	req, err := http.NewRequest(method, s.url+target, strings.NewReader(body))
+	if err != nil {
+		s.t.Fatalf("NewRequest: %v", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	s.sign(req, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, target, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatalf("%s %s: reading body: %v", method, target, err)
+	}
+	return resp, string(data)
+}
+
+// sign adds a SigV4 Authorization header covering every header set so far.
+func (s *testServer) sign(req *http.Request, body string) {
+	amzDate := time.Now().UTC().Format("20060102T150405Z")
+	sum := sha256.Sum256([]byte(body))
+	if req.Header.Get("x-amz-content-sha256") == "" {
+		req.Header.Set("x-amz-content-sha256", hex.EncodeToString(sum[:]))
+	}
+	req.Header.Set("x-amz-date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k := range req.Header {
+		headers[strings.ToLower(k)] = req.Header.Get(k)
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, n := range names {
+		canonicalHeaders.WriteString(n + ":" + strings.TrimSpace(headers[n]) + "\n")
+	}
+
+	var pairs []string
+	for k, vs := range req.URL.Query() {
+		for _, v := range vs {
+			pairs = append(pairs, sigEscape(k)+"="+sigEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+
+	segments := strings.Split(req.URL.Path, "/")
+	for i, seg := range segments {
+		segments[i] = sigEscape(seg)
+	}
+
+	scope := amzDate[:8] + "/us-east-1/s3/aws4_request"
+	canonical := strings.Join([]string{
+		req.Method,
+		strings.Join(segments, "/"),
+		strings.Join(pairs, "&"),
+		canonicalHeaders.String(),
+		strings.Join(names, ";"),
+		req.Header.Get("x-amz-content-sha256"),
+	}, "\n")
+	hashed := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{amzDate[:8], "us-east-1", "s3", "aws4_request"} {
+		key = hmacSum(key, part)
+	}
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+
+		",SignedHeaders="+strings.Join(names, ";")+",Signature="+hex.EncodeToString(hmacSum(key, stringToSign)))
+}
+
+func hmacSum(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sigEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// mustStatus fails the test unless resp has the wanted status.
+func (s *testServer) mustStatus(resp *http.Response, body string, want int) {
+	s.t.Helper()
+	if resp.StatusCode != want {
+		s.t.Fatalf("%s %s: status %d; want %d; body %s", resp.Request.Method, resp.Request.URL.RequestURI(), resp.StatusCode, want, body)
+	}
+}
+
+// multipart uploads parts as one object at target, sending headers with the
+// request that starts the upload, and returns the completion response.
+func (s *testServer) multipart(target string, headers map[string]string, parts ...string) (*http.Response, string) {
+	s.t.Helper()
+	resp, body := s.do("POST", target+"?uploads", "", headers)
+	s.mustStatus(resp, body, http.StatusOK)
+	uploadID := uploadIDOf(s.t, body)
+
+	var complete strings.Builder
+	complete.WriteString("<CompleteMultipartUpload>")
+	for i, part := range parts {
+		resp, body := s.do("PUT", fmt.Sprintf("%s?partNumber=%d&uploadId=%s", target, i+1, uploadID), part, nil)
+		s.mustStatus(resp, body, http.StatusOK)
+		fmt.Fprintf(&complete, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", i+1, resp.Header.Get("ETag"))
+	}
+	complete.WriteString("</CompleteMultipartUpload>")
+	return s.do("POST", target+"?uploadId="+uploadID, complete.String(), nil)
+}
+
+// uploadIDOf returns the query-escaped upload ID of a
+// CreateMultipartUpload response body.
+func uploadIDOf(t *testing.T, body string) string {
+	t.Helper()
+	var initiated initiateMultipartUploadResponse
+	if err := xml.Unmarshal([]byte(body), &initiated); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	return url.QueryEscape(initiated.UploadID)
+}
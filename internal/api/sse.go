@@ -0,0 +1,214 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"doss/internal/config"
+	"doss/internal/kms"
+	"doss/internal/metadata"
+	"doss/internal/storage"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	sseKMSKeyIDHeader = "x-amz-server-side-encryption-aws-kms-key-id"
+
+	// Prefixes of the SSE-C header triple (algorithm, key, key-MD5) for
+	// the object a request writes or reads, and for a copy source.
+	sseCustomerPrefix     = "x-amz-server-side-encryption-customer-"
+	sseCopyCustomerPrefix = "x-amz-copy-source-server-side-encryption-customer-"
+)
+
+// newObjectEncryption reads the encryption a write asked for, falling back
+// to the bucket's default encryption when the request names none. It
+// returns the record to keep with the object and the data key to encrypt
+// its blobs with, or two nils for a plaintext write.
+func newObjectEncryption(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string) (*metadata.ObjectEncryption, []byte, bool) {
+	ck, err := parseCustomerKey(r, sseCustomerPrefix)
+	if err != nil {
+		writeEncryptionError(w, err)
+		return nil, nil, false
+	}
+	sse := r.Header.Get("x-amz-server-side-encryption")
+	keyID := r.Header.Get(sseKMSKeyIDHeader)
+
+	if ck != nil {
+		if sse != "" || keyID != "" {
+			writeError(w, http.StatusBadRequest, ErrInvalidEncryption)
+			return nil, nil, false
+		}
+		salt := storage.NewCustomerKeySalt()
+		enc := &metadata.ObjectEncryption{
+			Algorithm:              metadata.SSEAlgorithmAES256,
+			CustomerKeySalt:        salt,
+			CustomerKeyFingerprint: storage.CustomerKeyFingerprint(ck, salt),
+		}
+		return enc, storage.CustomerDataKey(ck, salt), true
+	}
+
+	if sse == "" && keyID == "" {
+		def, err := metadata.GetBucketEncryption(ownerID, bucketName)
+		if errors.Is(err, metadata.ErrEncryptionConfigNotFound) {
+			return nil, nil, true
+		}
+		if err != nil {
+			log.Printf("GetBucketEncryption error: %v", err)
+			writeBucketAccessError(w, err)
+			return nil, nil, false
+		}
+		sse, keyID = def.SSEAlgorithm, def.KMSKeyID
+	}
+
+	// SSE-S3 is SSE-KMS under the server's default key.
+	switch {
+	case sse == metadata.SSEAlgorithmAES256 && keyID == "":
+		keyID = kms.DefaultKeyID
+	case sse == metadata.SSEAlgorithmKMS && metadata.ValidKeyID(keyID):
+	default:
+		writeError(w, http.StatusBadRequest, ErrInvalidEncryption)
+		return nil, nil, false
+	}
+
+	dataKey := storage.NewDataKey()
+	sealed, version, err := kms.Keys.Encrypt(keyID, dataKey)
+	if err != nil {
+		writeEncryptionError(w, err)
+		return nil, nil, false
+	}
+	enc := &metadata.ObjectEncryption{
+		Algorithm:  sse,
+		SealedKey:  sealed,
+		KeyID:      keyID,
+		KeyVersion: version,
+	}
+	return enc, dataKey, true
+}
+
+// objectDataKey returns the key that decrypts blobs written under enc, or
+// nil if they are stored in plaintext. For SSE-C the request must carry the
+// customer key under prefix, and it must be the key the object was written
+// with.
+func objectDataKey(r *http.Request, enc *metadata.ObjectEncryption, prefix string) ([]byte, error) {
+	ck, err := parseCustomerKey(r, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if enc == nil || !enc.IsCustomerKey() {
+		if ck != nil {
+			return nil, ErrInvalidEncryption
+		}
+		if enc == nil {
+			return nil, nil
+		}
+		return kms.Keys.Decrypt(enc.KeyID, enc.KeyVersion, enc.SealedKey)
+	}
+
+	if ck == nil {
+		return nil, ErrCustomerKeyRequired
+	}
+	if !storage.CustomerKeyMatches(ck, enc.CustomerKeySalt, enc.CustomerKeyFingerprint) {
+		return nil, ErrCustomerKeyMismatch
+	}
+	return storage.CustomerDataKey(ck, enc.CustomerKeySalt), nil
+}
+
+// parseCustomerKey reads an SSE-C header triple. It returns nil when none
+// of the headers is present.
+func parseCustomerKey(r *http.Request, prefix string) ([]byte, error) {
+	algorithm := r.Header.Get(prefix + "algorithm")
+	encoded := r.Header.Get(prefix + "key")
+	keyMD5 := r.Header.Get(prefix + "key-MD5")
+	if algorithm == "" && encoded == "" && keyMD5 == "" {
+		return nil, nil
+	}
+
+	if !secureRequest(r) && !config.AllowInsecureSSEC() {
+		return nil, ErrInsecureCustomerKey
+	}
+	if algorithm != metadata.SSEAlgorithmAES256 {
+		return nil, ErrInvalidEncryption
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != storage.DataKeySize {
+		return nil, ErrInvalidCustomerKey
+	}
+	sum := md5.Sum(key)
+	want := base64.StdEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(keyMD5), []byte(want)) != 1 {
+		return nil, ErrInvalidCustomerKey
+	}
+	return key, nil
+}
+
+// secureRequest reports whether r reached the server over TLS, either
+// directly or through a proxy trusted to say so in X-Forwarded-Proto.
+func secureRequest(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return config.TrustForwardedProto() && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// customerKeyETag hides the MD5 of an SSE-C object's plaintext, which
+// would let anyone who can read its ETag confirm a guess at the content,
+// behind a MAC keyed with the object's data key. The result is still 16
+// bytes, so multipart ETags and read verification work unchanged.
+func customerKeyETag(dataKey []byte, sum []byte) []byte {
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write(sum)
+	return mac.Sum(nil)[:md5.Size]
+}
+
+// setEncryptionHeaders reports how an object is encrypted. For SSE-C it
+// echoes the MD5 of the key the request supplied, which has already been
+// checked against the object.
+func setEncryptionHeaders(w http.ResponseWriter, r *http.Request, enc *metadata.ObjectEncryption) {
+	if enc == nil {
+		return
+	}
+	h := w.Header()
+	if enc.IsCustomerKey() {
+		h.Set(sseCustomerPrefix+"algorithm", enc.Algorithm)
+		if keyMD5 := r.Header.Get(sseCustomerPrefix + "key-MD5"); keyMD5 != "" {
+			h.Set(sseCustomerPrefix+"key-MD5", keyMD5)
+		}
+		return
+	}
+	h.Set("x-amz-server-side-encryption", enc.Algorithm)
+	if enc.Algorithm == metadata.SSEAlgorithmKMS {
+		h.Set(sseKMSKeyIDHeader, enc.KeyID)
+	}
+}
+
+func writeEncryptionError(w http.ResponseWriter, err error) {
+	status := encryptionErrorStatus(err)
+	if errors.Is(err, kms.ErrKeyNotFound) {
+		err = ErrEncryptionKeyNotFound
+	}
+	if status == http.StatusInternalServerError {
+		log.Printf("encryption error: %v", err)
+		err = ErrInternal
+	}
+	writeError(w, status, err)
+}
+
+func encryptionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrCustomerKeyMismatch):
+		return http.StatusForbidden
+	case errors.Is(err, kms.ErrKeyNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrInvalidEncryption), errors.Is(err, ErrInvalidCustomerKey),
+		errors.Is(err, ErrCustomerKeyRequired), errors.Is(err, ErrInsecureCustomerKey):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"crypto/md5"
+	"doss/internal/metadata"
+	"doss/internal/storage"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCustomerKeyHandlers(t *testing.T) {
+	s := newTestServer(t)
+	resp, body := s.do("PUT", "/ssec", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+
+	key := customerKeyHeaders(bytes.Repeat([]byte{1}, 32))
+	data := "customer encrypted"
+	sum := md5.Sum([]byte(data))
+	plainMD5 := hex.EncodeToString(sum[:])
+
+	// Customer keys may not cross plain HTTP, which is what the test
+	// server speaks, unless a trusted proxy vouches for TLS.
+	resp, body = s.do("PUT", "/ssec/doc", data, key)
+	s.mustStatus(resp, body, http.StatusBadRequest)
+	t.Setenv("TRUST_FORWARDED_PROTO", "true")
+	key["X-Forwarded-Proto"] = "https"
+
+	resp, body = s.do("PUT", "/ssec/doc", data, key)
+	s.mustStatus(resp, body, http.StatusOK)
+	etag := resp.Header.Get("ETag")
+	if etag == "" || strings.Contains(etag, plainMD5) {
+		t.Errorf("PUT ETag = %s; want one that is not the MD5 of the data", etag)
+	}
+
+	resp, body = s.do("GET", "/ssec/doc", "", map[string]string{"X-Forwarded-Proto": "https"})
+	s.mustStatus(resp, body, http.StatusBadRequest)
+
+	wrong := customerKeyHeaders(bytes.Repeat([]byte{2}, 32))
+	wrong["X-Forwarded-Proto"] = "https"
+	resp, body = s.do("GET", "/ssec/doc", "", wrong)
+	s.mustStatus(resp, body, http.StatusForbidden)
+
+	resp, body = s.do("GET", "/ssec/doc", "", key)
+	s.mustStatus(resp, body, http.StatusOK)
+	if body != data {
+		t.Errorf("GET body = %q; want %q", body, data)
+	}
+	if got := resp.Header.Get("ETag"); got != etag {
+		t.Errorf("GET ETag = %s; want %s", got, etag)
+	}
+	resp, body = s.do("HEAD", "/ssec/doc", "", key)
+	s.mustStatus(resp, body, http.StatusOK)
+	if got := resp.Header.Get("ETag"); got != etag {
+		t.Errorf("HEAD ETag = %s; want %s", got, etag)
+	}
+
+	resp, body = s.do("GET", "/ssec?list-type=2", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if strings.Contains(body, plainMD5) {
+		t.Errorf("listing shows the MD5 of the data: %s", body)
+	}
+}
+
+func TestBucketDefaultEncryption(t *testing.T) {
+	s := newTestServer(t)
+	resp, body := s.do("PUT", "/enc", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+
+	resp, body = s.do("PUT", "/enc?encryption", `{"sse_algorithm":"aws:kms","kms_key_id":"team"}`, nil)
+	s.mustStatus(resp, body, http.StatusBadRequest)
+	resp, body = s.do("PUT", "/doss/v1/kms/keys/team", "", nil)
+	s.mustStatus(resp, body, http.StatusCreated)
+	resp, body = s.do("PUT", "/enc?encryption", `{"sse_algorithm":"aws:kms","kms_key_id":"team"}`, nil)
+	s.mustStatus(resp, body, http.StatusNoContent)
+
+	// An upload that names no encryption gets the bucket's default.
+	const data = "encrypted by default"
+	resp, body = s.do("PUT", "/enc/default", data, nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if got := resp.Header.Get("x-amz-server-side-encryption"); got != metadata.SSEAlgorithmKMS {
+		t.Errorf("default upload: encryption %q; want %s", got, metadata.SSEAlgorithmKMS)
+	}
+	if got := resp.Header.Get(sseKMSKeyIDHeader); got != "team" {
+		t.Errorf("default upload: key %q; want team", got)
+	}
+	meta, err := metadata.GetObject(testOwnerID, "enc", "default")
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	rc, err := storage.Blobs.Get(meta.BlobID, 0, -1)
+	if err != nil {
+		t.Fatalf("reading blob: %v", err)
+	}
+	stored, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || strings.Contains(string(stored), data) {
+		t.Errorf("blob holds the plaintext (%v)", err)
+	}
+	resp, body = s.do("GET", "/enc/default", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if body != data {
+		t.Errorf("GET = %q; want %q", body, data)
+	}
+
+	// An upload that names its own encryption keeps it.
+	resp, body = s.do("PUT", "/enc/own", data, map[string]string{"x-amz-server-side-encryption": metadata.SSEAlgorithmAES256})
+	s.mustStatus(resp, body, http.StatusOK)
+	if got := resp.Header.Get("x-amz-server-side-encryption"); got != metadata.SSEAlgorithmAES256 {
+		t.Errorf("explicit upload: encryption %q; want %s", got, metadata.SSEAlgorithmAES256)
+	}
+
+	resp, body = s.do("DELETE", "/enc?encryption", "", nil)
+	s.mustStatus(resp, body, http.StatusNoContent)
+	resp, body = s.do("PUT", "/enc/plain", data, nil)
+	s.mustStatus(resp, body, http.StatusOK)
+	if got := resp.Header.Get("x-amz-server-side-encryption"); got != "" {
+		t.Errorf("upload after removing the default: encryption %q", got)
+	}
+}
+
+func customerKeyHeaders(key []byte) map[string]string {
+	sum := md5.Sum(key)
+	return map[string]string{
+		sseCustomerPrefix + "algorithm": metadata.SSEAlgorithmAES256,
+		sseCustomerPrefix + "key":       base64.StdEncoding.EncodeToString(key),
+		sseCustomerPrefix + "key-MD5":   base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"doss/internal/storage"
+	"log"
+	"net/http"
+)
+
+// StorageHealHandler rebuilds lost or damaged blob shards. It scans every
+// blob, so it is meant to be run after a drive is replaced rather than on
+// a schedule, and only by an admin.
+func StorageHealHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	healer, ok := storage.Blobs.(storage.Healer)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, ErrHealNotSupported)
+		return
+	}
+
+	res, err := healer.HealAll()
+	if err != nil {
+		log.Printf("HealAll error: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrInternal)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"doss/internal/storage"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorageHealHandler(t *testing.T) {
+	s := newTestServer(t)
+
+	// A full heal walks every drive, so tenants may not start one.
+	tenant := s.as("tenant")
+	resp, body := tenant.do("POST", "/doss/v1/storage/heal", "", nil)
+	tenant.mustStatus(resp, body, http.StatusForbidden)
+
+	resp, body = s.do("POST", "/doss/v1/storage/heal", "", nil)
+	s.mustStatus(resp, body, http.StatusNotImplemented)
+
+	dir := t.TempDir()
+	drives := []string{filepath.Join(dir, "1"), filepath.Join(dir, "2"), filepath.Join(dir, "3")}
+	b, err := storage.NewErasureBackend(drives, 1)
+	if err != nil {
+		t.Fatalf("NewErasureBackend: %v", err)
+	}
+	storage.Blobs = b
+	resp, body = s.do("POST", "/doss/v1/storage/heal", "", nil)
+	s.mustStatus(resp, body, http.StatusOK)
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"doss/internal/metadata"
+	"encoding/xml"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+type taggingXML struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	TagSet  []tagXML `xml:"TagSet>Tag"`
+}
+
+type tagXML struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+func handleGetObjectTagging(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	tags, versionID, err := metadata.GetObjectTagging(ownerID, bucketName, key, r.URL.Query().Get("versionId"))
+	if err != nil {
+		log.Printf("GetObjectTagging error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+
+	resp := taggingXML{Xmlns: s3XMLNamespace, TagSet: []tagXML{}}
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		resp.TagSet = append(resp.TagSet, tagXML{Key: k, Value: tags[k]})
+	}
+	if versionID != "" {
+		w.Header().Set("x-amz-version-id", versionID)
+	}
+	writeXML(w, http.StatusOK, resp)
+}
+
+func handlePutObjectTagging(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	var req taggingXML
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		log.Printf("handlePutObjectTagging Decode error: %v", err)
+		writeError(w, http.StatusBadRequest, ErrMalformedXML)
+		return
+	}
+
+	tags := make(map[string]string, len(req.TagSet))
+	for _, t := range req.TagSet {
+		if _, dup := tags[t.Key]; dup {
+			writeError(w, http.StatusBadRequest, ErrInvalidTag)
+			return
+		}
+		tags[t.Key] = t.Value
+	}
+
+	versionID, err := metadata.PutObjectTagging(ownerID, bucketName, key, r.URL.Query().Get("versionId"), tags)
+	if err != nil {
+		log.Printf("PutObjectTagging error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+	if versionID != "" {
+		w.Header().Set("x-amz-version-id", versionID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func handleDeleteObjectTagging(w http.ResponseWriter, r *http.Request, ownerID string, bucketName string, key string) {
+	versionID, err := metadata.PutObjectTagging(ownerID, bucketName, key, r.URL.Query().Get("versionId"), nil)
+	if err != nil {
+		log.Printf("DeleteObjectTagging error: %v", err)
+		writeObjectAccessError(w, err)
+		return
+	}
+	if versionID != "" {
+		w.Header().Set("x-amz-version-id", versionID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseTaggingHeader reads x-amz-tagging, a URL-encoded query string of
+// tags that PUT, copy and CreateMultipartUpload may set on the new object.
+func parseTaggingHeader(w http.ResponseWriter, r *http.Request) (map[string]string, bool) {
+	header := r.Header.Get("x-amz-tagging")
+	if header == "" {
+		return nil, true
+	}
+	values, err := url.ParseQuery(header)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidTag)
+		return nil, false
+	}
+	tags := make(map[string]string, len(values))
+	for k, v := range values {
+		if len(v) != 1 {
+			writeError(w, http.StatusBadRequest, ErrInvalidTag)
+			return nil, false
+		}
+		tags[k] = v[0]
+	}
+	if err := metadata.ValidateTags(tags); err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidTag)
+		return nil, false
+	}
+	return tags, true
+}
+
+func setTaggingCountHeader(h http.Header, meta *metadata.ObjectMeta) {
+	if len(meta.Tags) > 0 {
+		h.Set("x-amz-tagging-count", strconv.Itoa(len(meta.Tags)))
+	}
+}
@@ -58,9 +58,11 @@ func TargetItemPutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req putTargetRequest
-	decoder := json.NewDecoder(r.Body)
-	defer r.Body.Close()
-	if err := decoder.Decode(&req); err != nil {
+	body, ok := readDocument(w, r)
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
 		log.Printf("TargetItemPutHandler error: %v", err)
 		writeError(w, http.StatusBadRequest, ErrBadRequest)
 		return
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"strings"
+)
+
+// ChunkSigner checks the signatures of an aws-chunked upload. Every chunk
+// is signed over the signature before it, starting from the seed signature
+// of the request itself, so chunks can be neither dropped nor reordered.
+type ChunkSigner struct {
+	key     []byte
+	amzDate string
+	scope   string
+	prev    string
+}
+
+func newChunkSigner(key []byte, amzDate string, scope string, seed string) *ChunkSigner {
+	return &ChunkSigner{key: key, amzDate: amzDate, scope: scope, prev: seed}
+}
+
+// VerifyChunk checks the signature of the next chunk, given the SHA-256 of
+// its data.
+func (s *ChunkSigner) VerifyChunk(signature string, dataHash []byte) bool {
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm + "-PAYLOAD",
+		s.amzDate,
+		s.scope,
+		s.prev,
+		emptySHA256,
+		hex.EncodeToString(dataHash),
+	}, "\n")
+	return s.verify(signature, stringToSign)
+}
+
+// VerifyTrailer checks the signature of the trailing headers, given in
+// their canonical "name:value\n" form.
+func (s *ChunkSigner) VerifyTrailer(signature string, trailer []byte) bool {
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm + "-TRAILER",
+		s.amzDate,
+		s.scope,
+		s.prev,
+		sha256Hex(trailer),
+	}, "\n")
+	return s.verify(signature, stringToSign)
+}
+
+func (s *ChunkSigner) verify(signature string, stringToSign string) bool {
+	want := hex.EncodeToString(hmacSHA256(s.key, stringToSign))
+	if !hmac.Equal([]byte(signature), []byte(want)) {
+		return false
+	}
+	s.prev = want
+	return true
+}
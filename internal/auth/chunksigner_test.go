@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+// The example from the S3 documentation on signing chunked uploads.
+func TestChunkSigner(t *testing.T) {
+	key := signingKey("wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", "20130524", "us-east-1", sigV4Service)
+	newSigner := func() *ChunkSigner {
+		return newChunkSigner(key, "20130524T000000Z", "20130524/us-east-1/s3/aws4_request",
+			"4f232c4386841ef735655705268965c44a0e4690baa4adea153f7db9fa80a0a9")
+	}
+	chunks := []struct {
+		size      int
+		signature string
+	}{
+		{65536, "ad80c730a21e5b8d04586a2213dd63b9a0e99e0e2307b0ade35a65485a288648"},
+		{1024, "0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497"},
+		{0, "b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9"},
+	}
+
+	s := newSigner()
+	for i, c := range chunks {
+		sum := sha256.Sum256(bytes.Repeat([]byte("a"), c.size))
+		if !s.VerifyChunk(c.signature, sum[:]) {
+			t.Fatalf("chunk %d: signature rejected", i)
+		}
+	}
+
+	// Chunks only verify in order.
+	s = newSigner()
+	sum := sha256.Sum256(bytes.Repeat([]byte("a"), chunks[1].size))
+	if s.VerifyChunk(chunks[1].signature, sum[:]) {
+		t.Error("second chunk verified in first position")
+	}
+}
@@ -4,7 +4,11 @@ import "context"
 
 type contextKey string
 
-const ownerIDKey contextKey = "owner_id"
+const (
+	ownerIDKey     contextKey = "owner_id"
+	chunkSignerKey contextKey = "chunk_signer"
+	adminKey       contextKey = "admin"
+)
 
 func OwnerIDFromContext(ctx context.Context) (string, bool) {
 	v := ctx.Value(ownerIDKey)
@@ -19,3 +23,25 @@ func withOwnerID(ctx context.Context, ownerID string) context.Context {
 	ctx = context.WithValue(ctx, ownerIDKey, ownerID)
 	return ctx
 }
+
+// ChunkSignerFromContext returns the signer for a request whose payload is
+// sent as signed aws-chunked data. Only SigV4-authenticated requests have
+// one.
+func ChunkSignerFromContext(ctx context.Context) (*ChunkSigner, bool) {
+	s, ok := ctx.Value(chunkSignerKey).(*ChunkSigner)
+	return s, ok && s != nil
+}
+
+func withChunkSigner(ctx context.Context, s *ChunkSigner) context.Context {
+	return context.WithValue(ctx, chunkSignerKey, s)
+}
+
+// IsAdmin reports whether the request was signed with an admin credential.
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey).(bool)
+	return admin
+}
+
+func withAdmin(ctx context.Context, admin bool) context.Context {
+	return context.WithValue(ctx, adminKey, admin)
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+)
+
+var ErrInvalidAccessKey = errors.New("invalid access key")
+
+// Credential is an access key pair and the owner it acts for. Admin
+// credentials may also manage access keys.
+type Credential struct {
+	AccessKeyID string
+	SecretKey   string
+	OwnerID     string
+	Admin       bool
+
+	// stored is set for keys from the metadata store, whose last use is
+	// recorded.
+	stored   bool
+	lastUsed time.Time
+}
+
+// CredentialStore resolves the access key a request was signed with.
+type CredentialStore interface {
+	LookupCredential(accessKeyID string) (*Credential, error)
+}
+
+// Credentials is the store requests are authenticated against.
+var Credentials CredentialStore
+
+// devOwnerID is the owner of the root credential.
+const devOwnerID = "local-dev-user"
+
+type staticCredentials map[string]Credential
+
+func (s staticCredentials) LookupCredential(accessKeyID string) (*Credential, error) {
+	for id, c := range s {
+		if subtle.ConstantTimeCompare([]byte(id), []byte(accessKeyID)) == 1 {
+			return &c, nil
+		}
+	}
+	return nil, ErrInvalidAccessKey
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/rand"
+	"doss/internal/kms"
+	"doss/internal/metadata"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"log"
+	"time"
+)
+
+// lastUsedResolution is how stale an access key's last-used time may get,
+// so that not every request costs a metadata write.
+const lastUsedResolution = time.Minute
+
+// secretKeyID names the KMS key access key secrets are sealed under.
+const secretKeyID = kms.DefaultKeyID
+
+// keyStore resolves access keys kept in the metadata store. The root key
+// pair is not stored anywhere; it acts for devOwnerID and is the only
+// credential allowed to manage keys.
+type keyStore struct {
+	root staticCredentials
+}
+
+// InitKeyStore authenticates requests against stored access keys and the
+// root key pair.
+func InitKeyStore(rootAccessKey string, rootSecretKey string) {
+	Credentials = keyStore{
+		root: staticCredentials{
+			rootAccessKey: {AccessKeyID: rootAccessKey, SecretKey: rootSecretKey, OwnerID: devOwnerID, Admin: true},
+		},
+	}
+}
+
+func (s keyStore) LookupCredential(accessKeyID string) (*Credential, error) {
+	if c, err := s.root.LookupCredential(accessKeyID); err == nil {
+		return c, nil
+	}
+
+	k, err := metadata.GetAccessKey(accessKeyID)
+	if errors.Is(err, metadata.ErrAccessKeyNotFound) {
+		return nil, ErrInvalidAccessKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if k.Status != metadata.AccessKeyActive {
+		return nil, ErrInvalidAccessKey
+	}
+	secret, err := kms.Keys.Decrypt(k.SecretKeyID, k.SecretKeyVersion, k.SealedSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		AccessKeyID: k.AccessKeyID,
+		SecretKey:   string(secret),
+		OwnerID:     k.OwnerID,
+		stored:      true,
+		lastUsed:    k.LastUsed,
+	}, nil
+}
+
+// recordUse updates the last-used time of a stored key. It must only run
+// once the request's signature has been verified, so that knowing a key ID
+// is not enough to touch its record.
+func recordUse(cred *Credential) {
+	if !cred.stored {
+		return
+	}
+	t := now()
+	if t.Sub(cred.lastUsed) <= lastUsedResolution {
+		return
+	}
+	if _, err := metadata.UpdateAccessKey(cred.AccessKeyID, func(k *metadata.AccessKey) error {
+		k.LastUsed = t
+		return nil
+	}); err != nil {
+		log.Printf("auth: last-used update of %s failed: %v", cred.AccessKeyID, err)
+	}
+}
+
+// CreateAccessKey generates an active key pair for ownerID. The secret is
+// returned here and never again.
+func CreateAccessKey(ownerID string) (*metadata.AccessKey, string, error) {
+	secret := newSecretKey()
+	sealed, version, err := kms.Keys.Encrypt(secretKeyID, []byte(secret))
+	if err != nil {
+		return nil, "", err
+	}
+	k := &metadata.AccessKey{
+		AccessKeyID:      newAccessKeyID(),
+		OwnerID:          ownerID,
+		Status:           metadata.AccessKeyActive,
+		Created:          now().UTC(),
+		SealedSecret:     sealed,
+		SecretKeyID:      secretKeyID,
+		SecretKeyVersion: version,
+	}
+	if err := metadata.CreateAccessKey(k); err != nil {
+		return nil, "", err
+	}
+	return k, secret, nil
+}
+
+// RotateAccessKey replaces the secret of a key. Requests signed with the
+// old secret fail from then on.
+func RotateAccessKey(accessKeyID string) (*metadata.AccessKey, string, error) {
+	secret := newSecretKey()
+	sealed, version, err := kms.Keys.Encrypt(secretKeyID, []byte(secret))
+	if err != nil {
+		return nil, "", err
+	}
+	k, err := metadata.UpdateAccessKey(accessKeyID, func(k *metadata.AccessKey) error {
+		k.SealedSecret = sealed
+		k.SecretKeyID = secretKeyID
+		k.SecretKeyVersion = version
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return k, secret, nil
+}
+
+// newAccessKeyID returns an ID in the style of AWS access keys: upper-case
+// letters and digits.
+func newAccessKeyID() string {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "DK" + base32.StdEncoding.EncodeToString(b)
+}
+
+func newSecretKey() string {
+	b := make([]byte, 30)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
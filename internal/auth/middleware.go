@@ -1,33 +1,55 @@
 package auth
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"strings"
 )
 
-const validToken = "test-token"
-
+// Middleware authenticates a request by its SigV4 Authorization header or
+// presigned query string, and puts the owner of the signing key in the
+// context.
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
+		var cred *Credential
+		var signer *ChunkSigner
+		var err error
+		switch {
+		case isPresigned(r):
+			cred, err = verifyPresigned(r)
+		case r.Header.Get("Authorization") == "":
 			http.Error(w, "missing authorization", http.StatusUnauthorized)
 			return
-		}
-
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		case isSigned(r):
+			cred, signer, err = verifySigned(r)
+		default:
 			http.Error(w, "invalid authorization format", http.StatusUnauthorized)
 			return
 		}
-
-		token := parts[1]
-		if token != validToken {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+		if err != nil {
+			writeAuthError(w, err)
 			return
 		}
-		ownerID := "local-dev-user"
-		ctx := withOwnerID(r.Context(), ownerID)
+		recordUse(cred)
+
+		ctx := withOwnerID(r.Context(), cred.OwnerID)
+		ctx = withAdmin(ctx, cred.Admin)
+		if signer != nil {
+			ctx = withChunkSigner(ctx, signer)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+func writeAuthError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrMalformedAuth), errors.Is(err, ErrInvalidContentSHA256):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidAccessKey), errors.Is(err, ErrSignatureMismatch),
+		errors.Is(err, ErrRequestExpired), errors.Is(err, ErrRequestTimeSkewed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		log.Printf("auth error: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Values of x-amz-content-sha256 that stand for a payload which is not
+// signed as a whole.
+const (
+	StreamingSignedPayload        = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	StreamingSignedPayloadTrailer = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	StreamingUnsignedTrailer      = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+)
+
+// isSigned reports whether r carries SigV4 header authentication.
+func isSigned(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), sigV4Algorithm+" ")
+}
+
+// verifySigned checks the SigV4 Authorization header of r and returns the
+// credential that signed it. When the payload is signed chunk by chunk it
+// also returns the signer for the chunks; when it is signed as a whole the
+// body is replaced by one that fails at its end if the hash is wrong.
+func verifySigned(r *http.Request) (*Credential, *ChunkSigner, error) {
+	fields := map[string]string{}
+	for _, f := range strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), sigV4Algorithm+" "), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(f), "=")
+		if !ok {
+			return nil, nil, ErrMalformedAuth
+		}
+		fields[k] = v
+	}
+	scope, err := parseCredential(fields["Credential"])
+	if err != nil {
+		return nil, nil, err
+	}
+	signedHeaders, err := parseSignedHeaders(fields["SignedHeaders"])
+	if err != nil {
+		return nil, nil, err
+	}
+	signature := fields["Signature"]
+
+	// Every x-amz-* header has to be signed, x-amz-content-sha256 always
+	// being one of them.
+	payloadHash := r.Header.Get("x-amz-content-sha256")
+	if !validPayloadHash(payloadHash) {
+		return nil, nil, ErrInvalidContentSHA256
+	}
+	for name := range r.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") && !slices.Contains(signedHeaders, name) {
+			return nil, nil, ErrMalformedAuth
+		}
+	}
+
+	signedAt, amzDate, err := requestTime(r, signedHeaders)
+	if err != nil {
+		return nil, nil, err
+	}
+	if amzDate[:len(sigV4DateFormat)] != scope.date {
+		return nil, nil, ErrMalformedAuth
+	}
+	if skew := now().Sub(signedAt); skew > maxClockSkew || skew < -maxClockSkew {
+		return nil, nil, ErrRequestTimeSkewed
+	}
+
+	cred, err := Credentials.LookupCredential(scope.accessKeyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	canonical := canonicalRequest(r, r.URL.Query(), signedHeaders, payloadHash)
+	key := signingKey(cred.SecretKey, scope.date, scope.region, scope.service)
+	want := hex.EncodeToString(hmacSHA256(key, stringToSign(amzDate, scope, canonical)))
+	if !hmac.Equal([]byte(signature), []byte(want)) {
+		return nil, nil, ErrSignatureMismatch
+	}
+
+	switch payloadHash {
+	case StreamingSignedPayload, StreamingSignedPayloadTrailer:
+		return cred, newChunkSigner(key, amzDate, scope.String(), want), nil
+	case unsignedPayload, StreamingUnsignedTrailer:
+	default:
+		r.Body = &payloadVerifier{src: r.Body, hash: sha256.New(), want: payloadHash}
+	}
+	return cred, nil, nil
+}
+
+func validPayloadHash(v string) bool {
+	switch v {
+	case unsignedPayload, StreamingSignedPayload, StreamingSignedPayloadTrailer, StreamingUnsignedTrailer:
+		return true
+	}
+	b, err := hex.DecodeString(v)
+	return err == nil && len(b) == sha256.Size && v == strings.ToLower(v)
+}
+
+// requestTime returns the signing time from x-amz-date, or from Date when
+// there is none, along with its form in the string to sign. The header it
+// came from must be signed.
+func requestTime(r *http.Request, signedHeaders []string) (time.Time, string, error) {
+	if v := r.Header.Get("x-amz-date"); v != "" {
+		t, err := time.Parse(amzDateFormat, v)
+		if err != nil {
+			return time.Time{}, "", ErrMalformedAuth
+		}
+		return t, v, nil
+	}
+	v := r.Header.Get("Date")
+	if v == "" || !slices.Contains(signedHeaders, "date") {
+		return time.Time{}, "", ErrMalformedAuth
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return time.Time{}, "", ErrMalformedAuth
+	}
+	return t, t.UTC().Format(amzDateFormat), nil
+}
+
+// payloadVerifier fails the read that reaches the end of a body whose
+// SHA-256 is not the one that was signed, so a tampered upload is never
+// stored.
+type payloadVerifier struct {
+	src  io.ReadCloser
+	hash hash.Hash
+	want string
+}
+
+func (p *payloadVerifier) Read(b []byte) (int, error) {
+	n, err := p.src.Read(b)
+	p.hash.Write(b[:n])
+	if err == io.EOF && hex.EncodeToString(p.hash.Sum(nil)) != p.want {
+		return n, ErrContentSHA256Mismatch
+	}
+	return n, err
+}
+
+func (p *payloadVerifier) Close() error {
+	return p.src.Close()
+}
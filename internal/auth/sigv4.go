@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+	sigV4Service   = "s3"
+	sigV4Request   = "aws4_request"
+
+	// emptySHA256 is the hex SHA-256 of no bytes.
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+
+	sigV4DateFormat = "20060102"
+	amzDateFormat   = "20060102T150405Z"
+)
+
+var (
+	ErrMalformedAuth     = errors.New("malformed authorization")
+	ErrSignatureMismatch = errors.New("signature does not match")
+	ErrRequestExpired    = errors.New("request has expired")
+	ErrRequestTimeSkewed = errors.New("request time too skewed")
+
+	ErrInvalidContentSHA256  = errors.New("invalid x-amz-content-sha256")
+	ErrContentSHA256Mismatch = errors.New("payload does not match x-amz-content-sha256")
+)
+
+// now is replaced in tests.
+var now = time.Now
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// signingKey derives the SigV4 key for one day, region and service from a
+// secret access key.
+func signingKey(secret string, date string, region string, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, sigV4Request)
+}
+
+// sigV4Scope is the credential scope of a signature: the day, region and
+// service its signing key is good for.
+type sigV4Scope struct {
+	accessKeyID string
+	date        string
+	region      string
+	service     string
+}
+
+// parseCredential splits "AKID/20130524/us-east-1/s3/aws4_request".
+func parseCredential(v string) (sigV4Scope, error) {
+	parts := strings.Split(v, "/")
+	if len(parts) != 5 || parts[0] == "" || parts[2] == "" ||
+		parts[3] != sigV4Service || parts[4] != sigV4Request {
+		return sigV4Scope{}, ErrMalformedAuth
+	}
+	if _, err := time.Parse(sigV4DateFormat, parts[1]); err != nil {
+		return sigV4Scope{}, ErrMalformedAuth
+	}
+	return sigV4Scope{accessKeyID: parts[0], date: parts[1], region: parts[2], service: parts[3]}, nil
+}
+
+func (s sigV4Scope) String() string {
+	return strings.Join([]string{s.date, s.region, s.service, sigV4Request}, "/")
+}
+
+// canonicalRequest builds the SigV4 canonical request of r. query is the
+// query string as signed, which for a presigned URL leaves out the
+// signature itself.
+func canonicalRequest(r *http.Request, query url.Values, signedHeaders []string, payloadHash string) string {
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		var v string
+		if name == "host" {
+			v = r.Host
+		} else {
+			var values []string
+			for _, s := range r.Header.Values(name) {
+				values = append(values, strings.Join(strings.Fields(s), " "))
+			}
+			v = strings.Join(values, ",")
+		}
+		headers.WriteString(name + ":" + v + "\n")
+	}
+	return strings.Join([]string{
+		r.Method,
+		canonicalURI(r.URL.Path),
+		canonicalQuery(query),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// canonicalURI encodes each path segment once; S3 does not normalize or
+// double-encode paths.
+func canonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = uriEncode(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for k, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters, as
+// SigV4 requires.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func stringToSign(amzDate string, scope sigV4Scope, canonical string) string {
+	return strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		scope.String(),
+		sha256Hex([]byte(canonical)),
+	}, "\n")
+}
+
+// parseSignedHeaders reads the lower-case, sorted, semicolon-separated
+// header list. host must always be signed.
+func parseSignedHeaders(v string) ([]string, error) {
+	names := strings.Split(v, ";")
+	if !sort.StringsAreSorted(names) || !slices.Contains(names, "host") {
+		return nil, ErrMalformedAuth
+	}
+	for _, name := range names {
+		if name == "" || name != strings.ToLower(name) {
+			return nil, ErrMalformedAuth
+		}
+	}
+	return names, nil
+}
@@ -1 +1,88 @@
 package config
+
+import (
+	"os"
+	"strings"
+)
+
+// MasterKeyFile is the local file holding the master key that encrypts
+// the KMS keystore. It is created on first start.
+func MasterKeyFile() string {
+	return getEnv("MASTER_KEY_FILE", "./keys/master.key")
+}
+
+// KeystoreFile is the local KMS keystore holding every version of every
+// named key.
+func KeystoreFile() string {
+	return getEnv("KMS_KEYSTORE_FILE", "./keys/keystore")
+}
+
+// StorageBackend selects where blobs are kept: "fs" stores each blob in its
+// own file, "dedup" splits blobs into chunks and stores each distinct
+// chunk once, "erasure" stripes blobs over StorageDrives.
+func StorageBackend() string {
+	return getEnv("STORAGE_BACKEND", "fs")
+}
+
+// StorageDrives lists the drives the erasure backend stripes blobs over,
+// comma-separated. Their order must stay the same across restarts. There
+// is no default: drives that share a disk would protect nothing.
+func StorageDrives() []string {
+	var drives []string
+	for _, d := range strings.Split(os.Getenv("STORAGE_DRIVES"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			drives = append(drives, d)
+		}
+	}
+	return drives
+}
+
+// RootAccessKey and RootSecretKey are the admin key pair, which acts for
+// the local owner and manages every other access key.
+func RootAccessKey() string {
+	return getEnv("ROOT_ACCESS_KEY", "doss-dev-access-key")
+}
+
+// RootSecretKey is empty when ROOT_SECRET_KEY is unset, except in local
+// development: a built-in default would be a published admin secret.
+func RootSecretKey() string {
+	if IsLocal() {
+		return getEnv("ROOT_SECRET_KEY", "doss-dev-secret-key")
+	}
+	return os.Getenv("ROOT_SECRET_KEY")
+}
+
+// IsLocal reports whether the server runs for local development.
+func IsLocal() bool {
+	return os.Getenv("APP_ENV") == "local"
+}
+
+// TLSCertFile and TLSKeyFile, when both set, make the server listen for
+// HTTPS instead of plain HTTP.
+func TLSCertFile() string {
+	return os.Getenv("TLS_CERT_FILE")
+}
+
+func TLSKeyFile() string {
+	return os.Getenv("TLS_KEY_FILE")
+}
+
+// TrustForwardedProto treats a request with "X-Forwarded-Proto: https" as
+// having arrived over TLS. Only set it behind a proxy that terminates TLS
+// and overwrites the header, as clients can send anything.
+func TrustForwardedProto() bool {
+	return os.Getenv("TRUST_FORWARDED_PROTO") == "true"
+}
+
+// AllowInsecureSSEC permits SSE-C requests over plain HTTP. Customer keys
+// travel in request headers, so this is only meant for local development.
+func AllowInsecureSSEC() bool {
+	return os.Getenv("ALLOW_INSECURE_SSEC") == "true"
+}
+
+func getEnv(name string, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
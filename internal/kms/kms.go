@@ -0,0 +1,51 @@
+package kms
+
+import (
+	"doss/internal/metadata"
+	"errors"
+	"time"
+)
+
+// DefaultKeyID names the key that seals SSE-S3 data keys. It is created
+// with the keystore.
+const DefaultKeyID = "default"
+
+var (
+	ErrKeyNotFound     = errors.New("key not found")
+	ErrKeyExists       = errors.New("key already exists")
+	ErrInvalidKeyID    = errors.New("invalid key id")
+	ErrVersionNotFound = errors.New("key version not found")
+	ErrDecrypt         = errors.New("data key decryption failed")
+)
+
+// Provider seals and unseals data keys under named master keys. Rotating a
+// key adds a version: new data keys are sealed under the newest one, and
+// every older version stays available to unseal what it sealed.
+type Provider interface {
+	CreateKey(id string) (KeyInfo, error)
+	RotateKey(id string) (KeyInfo, error)
+	GetKey(id string) (KeyInfo, error)
+	ListKeys() ([]KeyInfo, error)
+
+	// Encrypt seals plaintext under the newest version of key id and
+	// returns the version it used.
+	Encrypt(id string, plaintext []byte) ([]byte, int, error)
+	Decrypt(id string, version int, ciphertext []byte) ([]byte, error)
+}
+
+type KeyInfo struct {
+	ID      string    `json:"id"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Rotated time.Time `json:"rotated,omitzero"`
+}
+
+// Keys is the provider the server seals data keys with.
+var Keys Provider
+
+func validKeyID(id string) error {
+	if !metadata.ValidKeyID(id) {
+		return ErrInvalidKeyID
+	}
+	return nil
+}
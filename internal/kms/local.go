@@ -0,0 +1,247 @@
+package kms
+
+import (
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var keystoreAAD = []byte("doss keystore")
+
+// Local is a Provider that keeps every key version in one keystore file,
+// encrypted with a master key read from a separate key file.
+type Local struct {
+	path      string
+	masterKey cipher.AEAD
+
+	mu   sync.RWMutex
+	keys map[string]*localKey
+}
+
+type localKey struct {
+	Created time.Time
+	// Version n is Versions[n-1].
+	Versions []localKeyVersion
+}
+
+type localKeyVersion struct {
+	Material []byte
+	Created  time.Time
+}
+
+// InitLocal opens the keystore at path and makes it the server's Provider.
+func InitLocal(path string, masterKeyPath string) {
+	l, err := OpenLocal(path, masterKeyPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	Keys = l
+}
+
+// OpenLocal opens the keystore at path, creating it along with the default
+// key on first start.
+func OpenLocal(path string, masterKeyPath string) (*Local, error) {
+	masterKey, err := loadMasterKey(masterKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	l := &Local{path: path, masterKey: masterKey, keys: make(map[string]*localKey)}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		plain, err := open(masterKey, data, keystoreAAD)
+		if err != nil {
+			return nil, fmt.Errorf("keystore %s: %w", path, err)
+		}
+		if err := json.Unmarshal(plain, &l.keys); err != nil {
+			return nil, fmt.Errorf("keystore %s: %w", path, err)
+		}
+	}
+
+	if _, ok := l.keys[DefaultKeyID]; !ok {
+		if _, err := l.CreateKey(DefaultKeyID); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (l *Local) CreateKey(id string) (KeyInfo, error) {
+	if err := validKeyID(id); err != nil {
+		return KeyInfo{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.keys[id]; ok {
+		return KeyInfo{}, ErrKeyExists
+	}
+	now := time.Now().UTC()
+	key := &localKey{
+		Created:  now,
+		Versions: []localKeyVersion{{Material: newKeyMaterial(), Created: now}},
+	}
+	l.keys[id] = key
+	if err := l.save(); err != nil {
+		delete(l.keys, id)
+		return KeyInfo{}, err
+	}
+	return key.info(id), nil
+}
+
+func (l *Local) RotateKey(id string) (KeyInfo, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key, ok := l.keys[id]
+	if !ok {
+		return KeyInfo{}, ErrKeyNotFound
+	}
+	key.Versions = append(key.Versions, localKeyVersion{
+		Material: newKeyMaterial(),
+		Created:  time.Now().UTC(),
+	})
+	if err := l.save(); err != nil {
+		key.Versions = key.Versions[:len(key.Versions)-1]
+		return KeyInfo{}, err
+	}
+	return key.info(id), nil
+}
+
+func (l *Local) GetKey(id string) (KeyInfo, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	key, ok := l.keys[id]
+	if !ok {
+		return KeyInfo{}, ErrKeyNotFound
+	}
+	return key.info(id), nil
+}
+
+func (l *Local) ListKeys() ([]KeyInfo, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	res := make([]KeyInfo, 0, len(l.keys))
+	for id, key := range l.keys {
+		res = append(res, key.info(id))
+	}
+	slices.SortFunc(res, func(a, b KeyInfo) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return res, nil
+}
+
+func (l *Local) Encrypt(id string, plaintext []byte) ([]byte, int, error) {
+	l.mu.RLock()
+	key, ok := l.keys[id]
+	var version int
+	var material []byte
+	if ok {
+		version = len(key.Versions)
+		material = key.Versions[version-1].Material
+	}
+	l.mu.RUnlock()
+	if !ok {
+		return nil, 0, ErrKeyNotFound
+	}
+
+	aead, err := newAEAD(material)
+	if err != nil {
+		return nil, 0, err
+	}
+	sealed, err := seal(aead, plaintext, versionAAD(id, version))
+	if err != nil {
+		return nil, 0, err
+	}
+	return sealed, version, nil
+}
+
+func (l *Local) Decrypt(id string, version int, ciphertext []byte) ([]byte, error) {
+	l.mu.RLock()
+	key, ok := l.keys[id]
+	var material []byte
+	if ok && version >= 1 && version <= len(key.Versions) {
+		material = key.Versions[version-1].Material
+	}
+	l.mu.RUnlock()
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	if material == nil {
+		return nil, ErrVersionNotFound
+	}
+
+	aead, err := newAEAD(material)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, ciphertext, versionAAD(id, version))
+}
+
+// versionAAD binds a sealed data key to the key version that sealed it.
+func versionAAD(id string, version int) []byte {
+	return []byte(id + "\x00" + strconv.Itoa(version))
+}
+
+func (k *localKey) info(id string) KeyInfo {
+	info := KeyInfo{ID: id, Version: len(k.Versions), Created: k.Created}
+	if len(k.Versions) > 1 {
+		info.Rotated = k.Versions[len(k.Versions)-1].Created
+	}
+	return info
+}
+
+// save writes the keystore to a temporary file and renames it into place,
+// so a crash never leaves a torn keystore behind. Callers hold l.mu.
+func (l *Local) save() error {
+	plain, err := json.Marshal(l.keys)
+	if err != nil {
+		return err
+	}
+	data, err := seal(l.masterKey, plain, keystoreAAD)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(l.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".keystore-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
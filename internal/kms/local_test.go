@@ -0,0 +1,72 @@
+package kms
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalKeystore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keystore")
+	masterKeyPath := filepath.Join(dir, "master.key")
+
+	l, err := OpenLocal(path, masterKeyPath)
+	if err != nil {
+		t.Fatalf("OpenLocal: %v", err)
+	}
+	if _, err := l.GetKey(DefaultKeyID); err != nil {
+		t.Fatalf("default key: %v", err)
+	}
+	if _, err := l.CreateKey("team-a"); err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	if _, err := l.CreateKey("team-a"); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("second CreateKey: got %v; want ErrKeyExists", err)
+	}
+	if _, err := l.CreateKey("../escape"); !errors.Is(err, ErrInvalidKeyID) {
+		t.Errorf("CreateKey with bad id: got %v; want ErrInvalidKeyID", err)
+	}
+
+	dataKey := []byte("0123456789abcdef0123456789abcdef")
+	sealed1, v1, err := l.Encrypt("team-a", dataKey)
+	if err != nil || v1 != 1 {
+		t.Fatalf("Encrypt: version %d, %v", v1, err)
+	}
+	info, err := l.RotateKey("team-a")
+	if err != nil || info.Version != 2 {
+		t.Fatalf("RotateKey: %+v, %v", info, err)
+	}
+	sealed2, v2, err := l.Encrypt("team-a", dataKey)
+	if err != nil || v2 != 2 {
+		t.Fatalf("Encrypt after rotation: version %d, %v", v2, err)
+	}
+
+	// The keystore must survive a restart, old versions included.
+	l, err = OpenLocal(path, masterKeyPath)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	for v, sealed := range map[int][]byte{1: sealed1, 2: sealed2} {
+		got, err := l.Decrypt("team-a", v, sealed)
+		if err != nil || !bytes.Equal(got, dataKey) {
+			t.Errorf("Decrypt version %d: %v", v, err)
+		}
+	}
+	if _, err := l.Decrypt("team-a", 2, sealed1); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Decrypt under the wrong version: got %v; want ErrDecrypt", err)
+	}
+	if _, err := l.Decrypt("team-a", 3, sealed1); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Decrypt unknown version: got %v; want ErrVersionNotFound", err)
+	}
+
+	keys, err := l.ListKeys()
+	if err != nil || len(keys) != 2 || keys[0].ID != DefaultKeyID || keys[1].ID != "team-a" {
+		t.Errorf("ListKeys = %+v, %v", keys, err)
+	}
+
+	if _, err := OpenLocal(path, filepath.Join(dir, "other.key")); err == nil {
+		t.Error("keystore opened with a different master key")
+	}
+}
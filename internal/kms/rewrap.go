@@ -0,0 +1,94 @@
+package kms
+
+import (
+	"doss/internal/metadata"
+	"log"
+	"time"
+)
+
+// Rewrapper periodically moves data keys sealed under an old version of
+// their key to the newest version. Object bytes are never rewritten; only
+// the sealed data key in metadata changes.
+type Rewrapper struct {
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewRewrapper(interval time.Duration) *Rewrapper {
+	return &Rewrapper{
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs a first pass right away and then one per interval.
+func (w *Rewrapper) Start() {
+	go w.run()
+}
+
+// Stop asks the rewrapper to finish and waits until the current pass, if
+// any, has stopped.
+func (w *Rewrapper) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *Rewrapper) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.pass()
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Rewrapper) pass() {
+	n, err := Rewrap(Keys)
+	if err != nil {
+		log.Printf("kms: rewrap error: %v", err)
+	}
+	if n > 0 {
+		log.Printf("kms: rewrapped %d data keys", n)
+	}
+}
+
+// Rewrap re-seals every data key that is not under the newest version of
+// its key and returns how many it moved.
+func Rewrap(p Provider) (int, error) {
+	keys, err := p.ListKeys()
+	if err != nil {
+		return 0, err
+	}
+	latest := make(map[string]int, len(keys))
+	for _, k := range keys {
+		latest[k.ID] = k.Version
+	}
+
+	stale := func(enc *metadata.ObjectEncryption) bool {
+		return enc.KeyID != "" && enc.KeyVersion < latest[enc.KeyID]
+	}
+	rewrap := func(enc *metadata.ObjectEncryption) (*metadata.ObjectEncryption, error) {
+		dataKey, err := p.Decrypt(enc.KeyID, enc.KeyVersion, enc.SealedKey)
+		if err != nil {
+			return nil, err
+		}
+		sealed, version, err := p.Encrypt(enc.KeyID, dataKey)
+		if err != nil {
+			return nil, err
+		}
+		next := *enc
+		next.SealedKey = sealed
+		next.KeyVersion = version
+		return &next, nil
+	}
+	return metadata.RewrapEncryption(stale, rewrap)
+}
@@ -0,0 +1,114 @@
+package kms
+
+import (
+	"bytes"
+	"doss/internal/metadata"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRewrap(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenLocal(filepath.Join(dir, "keystore"), filepath.Join(dir, "master.key"))
+	if err != nil {
+		t.Fatalf("OpenLocal: %v", err)
+	}
+	metadata.InitDB(filepath.Join(dir, "db"))
+	defer metadata.CloseDB()
+
+	const owner = "owner"
+	const bucket = "sealed"
+	if err := metadata.CreateBucket(owner, bucket, false); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+
+	dataKey := []byte("0123456789abcdef0123456789abcdef")
+	sealed, version, err := l.Encrypt(DefaultKeyID, dataKey)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	meta := &metadata.ObjectMeta{
+		Bucket:       bucket,
+		Key:          "a",
+		LastModified: time.Now().UTC(),
+		Encryption: &metadata.ObjectEncryption{
+			Algorithm:  metadata.SSEAlgorithmAES256,
+			SealedKey:  sealed,
+			KeyID:      DefaultKeyID,
+			KeyVersion: version,
+		},
+	}
+	if _, err := metadata.PutObject(owner, meta); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+
+	// A record whose sealed key cannot be opened fails on its own, and
+	// sorts first so the others are rewrapped after it.
+	broken := *meta
+	broken.Key = "0-broken"
+	brokenEnc := *meta.Encryption
+	brokenEnc.SealedKey = []byte("not a sealed key")
+	broken.Encryption = &brokenEnc
+	if _, err := metadata.PutObject(owner, &broken); err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+
+	// Access key secrets are sealed under the default key too.
+	secret := []byte("access key secret")
+	sealedSecret, version, err := l.Encrypt(DefaultKeyID, secret)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if err := metadata.CreateAccessKey(&metadata.AccessKey{
+		AccessKeyID:      "DKTEST",
+		OwnerID:          owner,
+		Status:           metadata.AccessKeyActive,
+		SealedSecret:     sealedSecret,
+		SecretKeyID:      DefaultKeyID,
+		SecretKeyVersion: version,
+	}); err != nil {
+		t.Fatalf("CreateAccessKey: %v", err)
+	}
+
+	if n, err := Rewrap(l); err != nil || n != 0 {
+		t.Fatalf("Rewrap before rotation = %d, %v; want 0", n, err)
+	}
+	if _, err := l.RotateKey(DefaultKeyID); err != nil {
+		t.Fatalf("RotateKey: %v", err)
+	}
+	// The object is recorded both as the current version and in the
+	// version list; each record carries its own sealed key. The access
+	// key is the third record.
+	if n, err := Rewrap(l); err == nil || n != 3 {
+		t.Fatalf("Rewrap = %d, %v; want 3 and the broken records' error", n, err)
+	}
+	if n, err := Rewrap(l); err == nil || n != 0 {
+		t.Fatalf("second Rewrap = %d, %v; want 0 and the broken records' error", n, err)
+	}
+
+	got, err := metadata.GetObject(owner, bucket, "a")
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	enc := got.Encryption
+	if enc.KeyVersion != 2 {
+		t.Errorf("KeyVersion = %d; want 2", enc.KeyVersion)
+	}
+	key, err := l.Decrypt(enc.KeyID, enc.KeyVersion, enc.SealedKey)
+	if err != nil || !bytes.Equal(key, dataKey) {
+		t.Errorf("rewrapped key does not unseal to the original: %v", err)
+	}
+
+	ak, err := metadata.GetAccessKey("DKTEST")
+	if err != nil {
+		t.Fatalf("GetAccessKey: %v", err)
+	}
+	if ak.SecretKeyVersion != 2 {
+		t.Errorf("SecretKeyVersion = %d; want 2", ak.SecretKeyVersion)
+	}
+	plain, err := l.Decrypt(ak.SecretKeyID, ak.SecretKeyVersion, ak.SealedSecret)
+	if err != nil || !bytes.Equal(plain, secret) {
+		t.Errorf("rewrapped secret does not unseal to the original: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package lifecycle
+
+import (
+	"doss/internal/metadata"
+	"doss/internal/storage"
+	"errors"
+	"log"
+	"time"
+)
+
+// Worker periodically applies every bucket's lifecycle rules and frees the
+// blobs of whatever they expired.
+type Worker struct {
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewWorker(interval time.Duration) *Worker {
+	return &Worker{
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs a first pass right away and then one per interval.
+func (w *Worker) Start() {
+	go w.run()
+}
+
+// Stop asks the worker to finish and waits until the current pass, if any,
+// has stopped.
+func (w *Worker) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *Worker) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.scan(time.Now().UTC())
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) scan(now time.Time) {
+	buckets, err := metadata.ListLifecycleBuckets()
+	if err != nil {
+		log.Printf("lifecycle: list buckets error: %v", err)
+		return
+	}
+
+	for name, cfg := range buckets {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		res, err := metadata.ApplyLifecycle(name, cfg, now)
+		if err != nil {
+			log.Printf("lifecycle: bucket %s error: %v", name, err)
+			continue
+		}
+		for i := range res.Released {
+			for _, seg := range res.Released[i].Segments() {
+				release(seg.BlobID)
+			}
+		}
+		for _, p := range res.AbortedParts {
+			release(p.BlobID)
+		}
+		if len(res.Released) > 0 || res.DeleteMarkers > 0 || res.Aborted > 0 {
+			log.Printf("lifecycle: bucket %s: removed %d versions, %d delete markers, %d uploads",
+				name, len(res.Released), res.DeleteMarkers, res.Aborted)
+		}
+	}
+}
+
+func release(blobID string) {
+	if blobID == "" {
+		return
+	}
+	if err := storage.Blobs.Delete(blobID); err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+		log.Printf("lifecycle: release blob %s error: %v", blobID, err)
+	}
+}
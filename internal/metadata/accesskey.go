@@ -0,0 +1,152 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	AccessKeyActive   = "active"
+	AccessKeyInactive = "inactive"
+)
+
+// AccessKey is a SigV4 key pair of an owner. The secret is kept only in
+// sealed form, under version SecretKeyVersion of KMS key SecretKeyID.
+type AccessKey struct {
+	AccessKeyID      string    `json:"access_key_id"`
+	OwnerID          string    `json:"owner_id"`
+	Status           string    `json:"status"`
+	Created          time.Time `json:"created"`
+	LastUsed         time.Time `json:"last_used,omitzero"`
+	SealedSecret     []byte    `json:"sealed_secret"`
+	SecretKeyID      string    `json:"secret_key_id"`
+	SecretKeyVersion int       `json:"secret_key_version"`
+}
+
+func accessKeyKey(id string) []byte {
+	return []byte("accesskey/" + id)
+}
+
+func validAccessKeyStatus(status string) bool {
+	return status == AccessKeyActive || status == AccessKeyInactive
+}
+
+// CreateAccessKey stores a new key. Access key IDs are global, since a
+// request names nothing else to look its key up by.
+func CreateAccessKey(k *AccessKey) error {
+	if k == nil || k.AccessKeyID == "" || k.OwnerID == "" || !validAccessKeyStatus(k.Status) {
+		return ErrInvalidAccessKey
+	}
+	return DB.Update(func(txn *badger.Txn) error {
+		_, err := txn.Get(accessKeyKey(k.AccessKeyID))
+		if err == nil {
+			return ErrAccessKeyExists
+		}
+		if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+		return setAccessKey(txn, k)
+	})
+}
+
+func GetAccessKey(id string) (*AccessKey, error) {
+	var k *AccessKey
+	err := DB.View(func(txn *badger.Txn) error {
+		var err error
+		k, err = getAccessKey(txn, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// ListAccessKeys returns the keys of ownerID, or every key when ownerID is
+// empty.
+func ListAccessKeys(ownerID string) ([]AccessKey, error) {
+	res := []AccessKey{}
+	err := DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("accesskey/")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var k AccessKey
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &k)
+			}); err != nil {
+				return err
+			}
+			if ownerID == "" || k.OwnerID == ownerID {
+				res = append(res, k)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UpdateAccessKey applies update to a stored key. The access key ID and
+// owner cannot change.
+func UpdateAccessKey(id string, update func(k *AccessKey) error) (*AccessKey, error) {
+	var k *AccessKey
+	err := DB.Update(func(txn *badger.Txn) error {
+		var err error
+		if k, err = getAccessKey(txn, id); err != nil {
+			return err
+		}
+		ownerID := k.OwnerID
+		if err := update(k); err != nil {
+			return err
+		}
+		if k.AccessKeyID != id || k.OwnerID != ownerID || !validAccessKeyStatus(k.Status) {
+			return ErrInvalidAccessKey
+		}
+		return setAccessKey(txn, k)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func DeleteAccessKey(id string) error {
+	return DB.Update(func(txn *badger.Txn) error {
+		if _, err := getAccessKey(txn, id); err != nil {
+			return err
+		}
+		return txn.Delete(accessKeyKey(id))
+	})
+}
+
+func getAccessKey(txn *badger.Txn, id string) (*AccessKey, error) {
+	item, err := txn.Get(accessKeyKey(id))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrAccessKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var k AccessKey
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &k)
+	}); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func setAccessKey(txn *badger.Txn, k *AccessKey) error {
+	data, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+	return txn.Set(accessKeyKey(k.AccessKeyID), data)
+}
@@ -15,7 +15,10 @@ type BucketMeta struct {
 	CreatedAt time.Time
 }
 
-func CreateBucket(ownerID string, name string) error {
+// CreateBucket creates an empty bucket. With objectLock the bucket is
+// created with object lock enabled, which also turns versioning on for
+// good.
+func CreateBucket(ownerID string, name string, objectLock bool) error {
 	key := []byte("bucket/" + name)
 
 	return DB.Update(func(txn *badger.Txn) error {
@@ -33,12 +36,33 @@ func CreateBucket(ownerID string, name string) error {
 			if err != nil {
 				return err
 			}
-			return txn.Set(key, data)
+			if err := txn.Set(key, data); err != nil {
+				return err
+			}
+			if objectLock {
+				return enableObjectLock(txn, name)
+			}
+			return nil
 		}
 		return err
 	})
 }
 
+func enableObjectLock(txn *badger.Txn, name string) error {
+	lock, err := json.Marshal(ObjectLockConfig{Enabled: true})
+	if err != nil {
+		return err
+	}
+	if err := txn.Set(objectLockKey(name), lock); err != nil {
+		return err
+	}
+	versioning, err := json.Marshal(BucketVersioning{Status: VersioningEnabled})
+	if err != nil {
+		return err
+	}
+	return txn.Set([]byte("bucket/"+name+"/versioning"), versioning)
+}
+
 func GetBucketMetadata(ownerID string, name string) (*BucketMeta, error) {
 	key := []byte("bucket/" + name)
 
@@ -127,6 +151,9 @@ func DeleteBucket(ownerID string, name string) error {
 				if data.OwnerID != ownerID {
 					return ErrNoAccess
 				}
+				if bucketHasObjects(txn, name) || bucketHasUploads(txn, name) {
+					return ErrBucketNotEmpty
+				}
 				if err := txn.Delete(key); err != nil {
 					return err
 				}
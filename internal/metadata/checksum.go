@@ -0,0 +1,70 @@
+package metadata
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+)
+
+const (
+	ChecksumCRC32  = "CRC32"
+	ChecksumCRC32C = "CRC32C"
+	ChecksumSHA1   = "SHA1"
+	ChecksumSHA256 = "SHA256"
+)
+
+// ObjectChecksum is a checksum of an object's data in one of the S3
+// additional checksum algorithms. Value is base64, as on the wire. The
+// checksum of a multipart object is taken over the checksums of its parts
+// and carries a "-N" suffix, like its ETag.
+type ObjectChecksum struct {
+	Algorithm string
+	Value     string
+}
+
+// NewChecksumHash returns a hash for the named algorithm, or nil if it is
+// not supported.
+func NewChecksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case ChecksumCRC32:
+		return crc32.NewIEEE()
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case ChecksumSHA1:
+		return sha1.New()
+	case ChecksumSHA256:
+		return sha256.New()
+	default:
+		return nil
+	}
+}
+
+func ValidChecksumAlgorithm(algorithm string) bool {
+	return NewChecksumHash(algorithm) != nil
+}
+
+// compositeChecksum derives the checksum of a multipart object from those
+// of its parts. It returns nil unless every part has one.
+func compositeChecksum(algorithm string, parts []ObjectPart) (*ObjectChecksum, error) {
+	h := NewChecksumHash(algorithm)
+	if h == nil {
+		return nil, nil
+	}
+	for _, p := range parts {
+		if p.Checksum == nil || p.Checksum.Algorithm != algorithm {
+			return nil, nil
+		}
+		raw, err := base64.StdEncoding.DecodeString(p.Checksum.Value)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(raw)
+	}
+	return &ObjectChecksum{
+		Algorithm: algorithm,
+		Value:     fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), len(parts)),
+	}, nil
+}
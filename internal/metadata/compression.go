@@ -0,0 +1,124 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const maxCompressionPatterns = 100
+
+// BucketCompression opts a bucket into transparent compression. An object
+// is compressed when its content type matches one of ContentTypes, where
+// "text/*" matches a whole family, or its key ends in one of Extensions.
+type BucketCompression struct {
+	Algorithm    string   `json:"algorithm"` // zstd or s2
+	ContentTypes []string `json:"content_types,omitempty"`
+	Extensions   []string `json:"extensions,omitempty"`
+}
+
+// Matches reports whether an object with this key and content type should
+// be compressed.
+func (c *BucketCompression) Matches(key string, contentType string) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		for _, pattern := range c.ContentTypes {
+			pattern = strings.ToLower(pattern)
+			if family, ok := strings.CutSuffix(pattern, "/*"); ok {
+				if strings.HasPrefix(mediaType, family+"/") {
+					return true
+				}
+			} else if mediaType == pattern {
+				return true
+			}
+		}
+	}
+
+	ext := strings.ToLower(path.Ext(key))
+	if ext == "" {
+		return false
+	}
+	for _, e := range c.Extensions {
+		if strings.ToLower(e) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func compressionKey(bucket string) []byte {
+	return []byte("bucket/" + bucket + "/compression")
+}
+
+func GetBucketCompression(ownerID string, name string) (*BucketCompression, error) {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return nil, err
+	}
+
+	var cfg BucketCompression
+
+	err := DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(compressionKey(name))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrCompressionConfigNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &cfg)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// PutBucketCompression stores cfg. Which algorithms exist is up to the
+// storage layer, so the caller checks cfg.Algorithm.
+func PutBucketCompression(ownerID string, name string, cfg *BucketCompression) error {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return err
+	}
+
+	patterns := len(cfg.ContentTypes) + len(cfg.Extensions)
+	if patterns == 0 || patterns > maxCompressionPatterns {
+		return ErrInvalidCompressionConfig
+	}
+	for _, e := range cfg.Extensions {
+		if !strings.HasPrefix(e, ".") || len(e) < 2 {
+			return ErrInvalidCompressionConfig
+		}
+	}
+	for _, t := range cfg.ContentTypes {
+		if !strings.Contains(t, "/") {
+			return ErrInvalidCompressionConfig
+		}
+	}
+
+	return DB.Update(func(txn *badger.Txn) error {
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		return txn.Set(compressionKey(name), data)
+	})
+}
+
+func DeleteBucketCompression(ownerID string, name string) error {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return err
+	}
+
+	return DB.Update(func(txn *badger.Txn) error {
+		err := txn.Delete(compressionKey(name))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	})
+}
@@ -0,0 +1,101 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	SSEAlgorithmAES256 = "AES256"
+	SSEAlgorithmKMS    = "aws:kms"
+)
+
+// keyIDPattern keeps KMS key names short and safe to put in headers and
+// URL paths.
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// BucketEncryption is the encryption applied to new objects in a bucket
+// whose upload does not ask for any. AES256 seals data keys with the KMS
+// default key; aws:kms seals them with the KMS key KMSKeyID.
+type BucketEncryption struct {
+	SSEAlgorithm string `json:"sse_algorithm"`
+	KMSKeyID     string `json:"kms_key_id,omitempty"`
+}
+
+func encryptionKey(bucket string) []byte {
+	return []byte("bucket/" + bucket + "/encryption")
+}
+
+// ValidKeyID reports whether id can name an encryption key.
+func ValidKeyID(id string) bool {
+	return keyIDPattern.MatchString(id)
+}
+
+func GetBucketEncryption(ownerID string, name string) (*BucketEncryption, error) {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return nil, err
+	}
+
+	var cfg BucketEncryption
+
+	err := DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(encryptionKey(name))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrEncryptionConfigNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &cfg)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func PutBucketEncryption(ownerID string, name string, cfg *BucketEncryption) error {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return err
+	}
+
+	switch cfg.SSEAlgorithm {
+	case SSEAlgorithmAES256:
+		if cfg.KMSKeyID != "" {
+			return ErrInvalidEncryptionConfig
+		}
+	case SSEAlgorithmKMS:
+		if !ValidKeyID(cfg.KMSKeyID) {
+			return ErrInvalidEncryptionConfig
+		}
+	default:
+		return ErrInvalidEncryptionConfig
+	}
+
+	return DB.Update(func(txn *badger.Txn) error {
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		return txn.Set(encryptionKey(name), data)
+	})
+}
+
+func DeleteBucketEncryption(ownerID string, name string) error {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return err
+	}
+
+	return DB.Update(func(txn *badger.Txn) error {
+		err := txn.Delete(encryptionKey(name))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	})
+}
@@ -5,9 +5,35 @@ import "errors"
 var (
 	ErrBucketNotFound                  = errors.New("bucket not found")
 	ErrBucketAlreadyExists             = errors.New("bucket already exists")
+	ErrBucketNotEmpty                  = errors.New("bucket not empty")
 	ErrInvalidNotificationConfig       = errors.New("invalid notification config")
 	ErrInvalidNotificationTargetConfig = errors.New("invalid notification target config")
 	ErrNoAccess                        = errors.New("no access")
 	ErrNotificationTargetNotFound      = errors.New("notification target not found")
 	ErrNotificationTargetInUse         = errors.New("notification target in use")
+	ErrObjectNotFound                  = errors.New("object not found")
+	ErrVersionNotFound                 = errors.New("version not found")
+	ErrInvalidVersionID                = errors.New("invalid version id")
+	ErrDeleteMarker                    = errors.New("object is a delete marker")
+	ErrInvalidVersioningConfig         = errors.New("invalid versioning config")
+	ErrUploadNotFound                  = errors.New("upload not found")
+	ErrInvalidPart                     = errors.New("invalid part")
+	ErrInvalidPartOrder                = errors.New("invalid part order")
+	ErrEntityTooSmall                  = errors.New("entity too small")
+	ErrObjectLocked                    = errors.New("object is locked")
+	ErrObjectLockNotEnabled            = errors.New("object lock not enabled")
+	ErrObjectLockConfigNotFound        = errors.New("object lock config not found")
+	ErrInvalidObjectLockConfig         = errors.New("invalid object lock config")
+	ErrInvalidRetention                = errors.New("invalid retention")
+	ErrInvalidBucketState              = errors.New("invalid bucket state")
+	ErrLifecycleNotFound               = errors.New("lifecycle config not found")
+	ErrInvalidLifecycleConfig          = errors.New("invalid lifecycle config")
+	ErrEncryptionConfigNotFound        = errors.New("encryption config not found")
+	ErrInvalidEncryptionConfig         = errors.New("invalid encryption config")
+	ErrCompressionConfigNotFound       = errors.New("compression config not found")
+	ErrInvalidCompressionConfig        = errors.New("invalid compression config")
+	ErrInvalidTag                      = errors.New("invalid tag")
+	ErrAccessKeyNotFound               = errors.New("access key not found")
+	ErrAccessKeyExists                 = errors.New("access key already exists")
+	ErrInvalidAccessKey                = errors.New("invalid access key")
 )
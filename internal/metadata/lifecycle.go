@@ -0,0 +1,472 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	LifecycleEnabled  = "Enabled"
+	LifecycleDisabled = "Disabled"
+
+	maxLifecycleRules = 1000
+	maxRuleIDLength   = 255
+)
+
+type LifecycleConfig struct {
+	Rules []LifecycleRule `json:"rules"`
+}
+
+type LifecycleRule struct {
+	ID                             string                 `json:"id"`
+	Status                         string                 `json:"status"` // Enabled or Disabled
+	Filter                         LifecycleFilter        `json:"filter"`
+	Expiration                     *LifecycleExpiration   `json:"expiration,omitempty"`
+	NoncurrentVersionExpiration    *NoncurrentExpiration  `json:"noncurrent_version_expiration,omitempty"`
+	AbortIncompleteMultipartUpload *AbortIncompleteUpload `json:"abort_incomplete_multipart_upload,omitempty"`
+}
+
+// LifecycleFilter selects the objects a rule applies to. A version matches
+// when its key starts with Prefix and it carries every tag in Tags.
+type LifecycleFilter struct {
+	Prefix string            `json:"prefix"`
+	Tags   map[string]string `json:"tags,omitempty"`
+}
+
+// LifecycleExpiration expires the current version Days after it was written
+// or on Date. ExpiredObjectDeleteMarker removes delete markers that have no
+// versions left behind them.
+type LifecycleExpiration struct {
+	Days                      int        `json:"days,omitempty"`
+	Date                      *time.Time `json:"date,omitempty"`
+	ExpiredObjectDeleteMarker bool       `json:"expired_object_delete_marker,omitempty"`
+}
+
+type NoncurrentExpiration struct {
+	NoncurrentDays int `json:"noncurrent_days"`
+}
+
+type AbortIncompleteUpload struct {
+	DaysAfterInitiation int `json:"days_after_initiation"`
+}
+
+// LifecycleResult lists what a lifecycle pass removed; the caller owns
+// releasing the blobs.
+type LifecycleResult struct {
+	Released      []ObjectMeta
+	DeleteMarkers int
+	AbortedParts  []PartMeta
+	Aborted       int
+}
+
+func lifecycleKey(bucket string) []byte {
+	return []byte("bucket/" + bucket + "/lifecycle")
+}
+
+func GetBucketLifecycle(ownerID string, name string) (*LifecycleConfig, error) {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return nil, err
+	}
+
+	var cfg LifecycleConfig
+
+	err := DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(lifecycleKey(name))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrLifecycleNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &cfg)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func PutBucketLifecycle(ownerID string, name string, cfg *LifecycleConfig) error {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return err
+	}
+
+	if err := validateLifecycle(cfg); err != nil {
+		return err
+	}
+
+	return DB.Update(func(txn *badger.Txn) error {
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		return txn.Set(lifecycleKey(name), data)
+	})
+}
+
+func DeleteBucketLifecycle(ownerID string, name string) error {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return err
+	}
+
+	return DB.Update(func(txn *badger.Txn) error {
+		err := txn.Delete(lifecycleKey(name))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	})
+}
+
+func validateLifecycle(cfg *LifecycleConfig) error {
+	if cfg == nil || len(cfg.Rules) == 0 || len(cfg.Rules) > maxLifecycleRules {
+		return ErrInvalidLifecycleConfig
+	}
+
+	ids := make(map[string]bool, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		if len(rule.ID) > maxRuleIDLength || (rule.ID != "" && ids[rule.ID]) {
+			return ErrInvalidLifecycleConfig
+		}
+		ids[rule.ID] = true
+
+		if rule.Status != LifecycleEnabled && rule.Status != LifecycleDisabled {
+			return ErrInvalidLifecycleConfig
+		}
+		if rule.Expiration == nil && rule.NoncurrentVersionExpiration == nil && rule.AbortIncompleteMultipartUpload == nil {
+			return ErrInvalidLifecycleConfig
+		}
+		if exp := rule.Expiration; exp != nil {
+			set := 0
+			if exp.Days > 0 {
+				set++
+			}
+			if exp.Date != nil {
+				set++
+			}
+			if exp.ExpiredObjectDeleteMarker {
+				set++
+			}
+			if set != 1 || exp.Days < 0 {
+				return ErrInvalidLifecycleConfig
+			}
+		}
+		if nc := rule.NoncurrentVersionExpiration; nc != nil && nc.NoncurrentDays <= 0 {
+			return ErrInvalidLifecycleConfig
+		}
+		if abort := rule.AbortIncompleteMultipartUpload; abort != nil {
+			// Uploads carry no tags, so S3 refuses tag filters here.
+			if abort.DaysAfterInitiation <= 0 || len(rule.Filter.Tags) > 0 {
+				return ErrInvalidLifecycleConfig
+			}
+		}
+	}
+	return nil
+}
+
+func (f *LifecycleFilter) matches(key string, tags map[string]string) bool {
+	if !strings.HasPrefix(key, f.Prefix) {
+		return false
+	}
+	for k, v := range f.Tags {
+		if got, ok := tags[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// lifecycleDue reports whether an action scheduled days after t is due at
+// now. Like S3, the deadline is rounded up to the next midnight UTC.
+func lifecycleDue(t time.Time, days int, now time.Time) bool {
+	deadline := t.UTC().AddDate(0, 0, days)
+	if midnight := deadline.Truncate(24 * time.Hour); midnight.Before(deadline) {
+		deadline = midnight.Add(24 * time.Hour)
+	}
+	return !now.Before(deadline)
+}
+
+// ListLifecycleBuckets returns the lifecycle configuration of every bucket
+// that has one, keyed by bucket name. It is meant for the background
+// worker and ignores ownership.
+func ListLifecycleBuckets() (map[string]*LifecycleConfig, error) {
+	res := make(map[string]*LifecycleConfig)
+
+	err := DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte("bucket/")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); {
+			name := string(it.Item().Key()[len(prefix):])
+			if i := strings.IndexByte(name, '/'); i >= 0 {
+				// Skip the rest of this bucket's objects and sub-resources
+				// in one seek.
+				next := prefixSuccessor([]byte("bucket/" + name[:i+1]))
+				if next == nil {
+					return nil
+				}
+				it.Seek(next)
+				continue
+			}
+
+			item, err := txn.Get(lifecycleKey(name))
+			if err == nil {
+				var cfg LifecycleConfig
+				if err := item.Value(func(val []byte) error {
+					return json.Unmarshal(val, &cfg)
+				}); err != nil {
+					return err
+				}
+				res[name] = &cfg
+			} else if !errors.Is(err, badger.ErrKeyNotFound) {
+				return err
+			}
+			it.Next()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ApplyLifecycle runs one lifecycle pass over a bucket at now. Each key is
+// handled in its own transaction so a large bucket never builds one huge
+// write; versions under object lock are left alone.
+func ApplyLifecycle(bucket string, cfg *LifecycleConfig, now time.Time) (*LifecycleResult, error) {
+	res := &LifecycleResult{}
+
+	var rules []LifecycleRule
+	for _, rule := range cfg.Rules {
+		if rule.Status == LifecycleEnabled {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return res, nil
+	}
+
+	keys, err := lifecycleCandidates(bucket, rules)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		err := DB.Update(func(txn *badger.Txn) error {
+			return expireKey(txn, bucket, key, rules, now, res)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := abortStaleUploads(bucket, rules, now, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// lifecycleCandidates lists the distinct keys under any rule's prefix.
+func lifecycleCandidates(bucket string, rules []LifecycleRule) ([]string, error) {
+	var keys []string
+
+	err := DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		base := versionsPrefix(bucket)
+		for it.Seek(base); it.ValidForPrefix(base); it.Next() {
+			key, _, ok := splitVersionKey(string(it.Item().Key()[len(base):]))
+			if !ok || (len(keys) > 0 && keys[len(keys)-1] == key) {
+				continue
+			}
+			for _, rule := range rules {
+				if strings.HasPrefix(key, rule.Filter.Prefix) {
+					keys = append(keys, key)
+					break
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func expireKey(txn *badger.Txn, bucket string, key string, rules []LifecycleRule, now time.Time, res *LifecycleResult) error {
+	versions, err := loadVersions(txn, bucket, key)
+	if err != nil || len(versions) == 0 {
+		return err
+	}
+	state, err := versioningState(txn, bucket)
+	if err != nil {
+		return err
+	}
+
+	// Noncurrent versions first: version i stopped being current when
+	// version i-1 was written.
+	kept := versions[:1]
+	for i := 1; i < len(versions); i++ {
+		v := versions[i]
+		if noncurrentExpired(rules, &v, versions[i-1].LastModified, now) && !v.IsLocked(now, false) {
+			if err := txn.Delete(versionKey(&v)); err != nil {
+				return err
+			}
+			if !v.IsDeleteMarker {
+				res.Released = append(res.Released, v)
+			}
+			continue
+		}
+		kept = append(kept, v)
+	}
+	versions = kept
+
+	current := versions[0]
+	switch {
+	case current.IsDeleteMarker:
+		// A delete marker with nothing left behind it serves no purpose.
+		if len(versions) == 1 && deleteMarkerExpired(rules, key) {
+			if err := txn.Delete(versionKey(&current)); err != nil {
+				return err
+			}
+			res.DeleteMarkers++
+			return setLatest(txn, bucket, key, nil)
+		}
+	case currentExpired(rules, &current, now) && !current.IsLocked(now, false):
+		if state == "" {
+			if err := txn.Delete(versionKey(&current)); err != nil {
+				return err
+			}
+			res.Released = append(res.Released, current)
+			return setLatest(txn, bucket, key, nil)
+		}
+		marker := ObjectMeta{
+			Bucket:         bucket,
+			Key:            key,
+			LastModified:   now.UTC(),
+			OwnerID:        current.OwnerID,
+			IsDeleteMarker: true,
+		}
+		released, err := writeVersion(txn, &marker, state)
+		if err != nil {
+			return err
+		}
+		if released != nil {
+			res.Released = append(res.Released, *released)
+		}
+	}
+	return nil
+}
+
+func currentExpired(rules []LifecycleRule, v *ObjectMeta, now time.Time) bool {
+	for _, rule := range rules {
+		exp := rule.Expiration
+		if exp == nil || !rule.Filter.matches(v.Key, v.Tags) {
+			continue
+		}
+		if exp.Days > 0 && lifecycleDue(v.LastModified, exp.Days, now) {
+			return true
+		}
+		if exp.Date != nil && !now.Before(*exp.Date) {
+			return true
+		}
+	}
+	return false
+}
+
+func noncurrentExpired(rules []LifecycleRule, v *ObjectMeta, since time.Time, now time.Time) bool {
+	for _, rule := range rules {
+		nc := rule.NoncurrentVersionExpiration
+		if nc == nil || !rule.Filter.matches(v.Key, v.Tags) {
+			continue
+		}
+		if lifecycleDue(since, nc.NoncurrentDays, now) {
+			return true
+		}
+	}
+	return false
+}
+
+func deleteMarkerExpired(rules []LifecycleRule, key string) bool {
+	for _, rule := range rules {
+		// Delete markers have no tags, so only prefix-only rules apply.
+		if rule.Expiration != nil && rule.Expiration.ExpiredObjectDeleteMarker &&
+			len(rule.Filter.Tags) == 0 && strings.HasPrefix(key, rule.Filter.Prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func abortStaleUploads(bucket string, rules []LifecycleRule, now time.Time, res *LifecycleResult) error {
+	var stale []MultipartUpload
+
+	err := DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := uploadPrefix(bucket)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var upload MultipartUpload
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &upload)
+			}); err != nil {
+				return err
+			}
+			for _, rule := range rules {
+				abort := rule.AbortIncompleteMultipartUpload
+				if abort != nil && strings.HasPrefix(upload.Key, rule.Filter.Prefix) &&
+					lifecycleDue(upload.Initiated, abort.DaysAfterInitiation, now) {
+					stale = append(stale, upload)
+					break
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, upload := range stale {
+		err := DB.Update(func(txn *badger.Txn) error {
+			// The upload may have been completed or aborted meanwhile.
+			if _, err := getUpload(txn, bucket, upload.Key, upload.UploadID); err != nil {
+				if errors.Is(err, ErrUploadNotFound) {
+					return nil
+				}
+				return err
+			}
+			parts, err := loadParts(txn, bucket, upload.UploadID)
+			if err != nil {
+				return err
+			}
+			if err := deleteUpload(txn, bucket, upload.Key, upload.UploadID); err != nil {
+				return err
+			}
+			for _, p := range parts {
+				res.AbortedParts = append(res.AbortedParts, p)
+			}
+			res.Aborted++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		deleteParts(bucket, upload.UploadID)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package metadata
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type ListObjectsParams struct {
+	Prefix    string
+	Delimiter string
+	// StartAfter is exclusive. It may be an object key or a common prefix
+	// returned by an earlier page.
+	StartAfter string
+	MaxKeys    int
+}
+
+type ListObjectsResult struct {
+	Objects        []ObjectMeta
+	CommonPrefixes []string
+	IsTruncated    bool
+	// NextMarker is the last key or common prefix in this page; passing it
+	// back as StartAfter resumes the listing.
+	NextMarker string
+}
+
+// ListObjects walks the bucket's object keys in lexical order. Keys that roll
+// up into a common prefix are skipped with a single seek rather than
+// iterated, so a delimiter listing costs one step per returned entry.
+func ListObjects(ownerID string, bucket string, params ListObjectsParams) (*ListObjectsResult, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+
+	res := &ListObjectsResult{
+		Objects:        []ObjectMeta{},
+		CommonPrefixes: []string{},
+	}
+	if params.MaxKeys <= 0 {
+		return res, nil
+	}
+
+	base := objectPrefix(bucket)
+	prefix := []byte(string(base) + params.Prefix)
+	seek := prefix
+	if params.StartAfter > params.Prefix {
+		seek = []byte(string(base) + params.StartAfter)
+	}
+
+	err := DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		count := 0
+		for it.Seek(seek); it.ValidForPrefix(prefix); {
+			item := it.Item()
+			key := string(item.Key()[len(base):])
+			if key <= params.StartAfter {
+				it.Next()
+				continue
+			}
+
+			if params.Delimiter != "" {
+				if i := strings.Index(key[len(params.Prefix):], params.Delimiter); i >= 0 {
+					cp := key[:len(params.Prefix)+i+len(params.Delimiter)]
+					// A page that ended on this prefix already reported it.
+					if cp != params.StartAfter {
+						if count == params.MaxKeys {
+							res.IsTruncated = true
+							return nil
+						}
+						res.CommonPrefixes = append(res.CommonPrefixes, cp)
+						res.NextMarker = cp
+						count++
+					}
+
+					next := prefixSuccessor([]byte(string(base) + cp))
+					if next == nil {
+						return nil
+					}
+					it.Seek(next)
+					continue
+				}
+			}
+
+			if count == params.MaxKeys {
+				res.IsTruncated = true
+				return nil
+			}
+			var meta ObjectMeta
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &meta)
+			}); err != nil {
+				return err
+			}
+			res.Objects = append(res.Objects, meta)
+			res.NextMarker = key
+			count++
+			it.Next()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !res.IsTruncated {
+		res.NextMarker = ""
+	}
+	return res, nil
+}
+
+// prefixSuccessor returns the smallest key greater than every key with the
+// given prefix, or nil if no such key exists.
+func prefixSuccessor(prefix []byte) []byte {
+	next := append([]byte{}, prefix...)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i] < 0xff {
+			next[i]++
+			return next[:i+1]
+		}
+	}
+	return nil
+}
+
+type ListVersionsParams struct {
+	Prefix          string
+	Delimiter       string
+	KeyMarker       string
+	VersionIDMarker string
+	MaxKeys         int
+}
+
+type ObjectVersion struct {
+	ObjectMeta
+	IsLatest bool
+}
+
+type ListVersionsResult struct {
+	Versions            []ObjectVersion
+	CommonPrefixes      []string
+	IsTruncated         bool
+	NextKeyMarker       string
+	NextVersionIDMarker string
+}
+
+// ListObjectVersions walks every version of every key, newest version first
+// within a key. Resuming mid-key needs both markers: the key, and the last
+// version of it already returned.
+func ListObjectVersions(ownerID string, bucket string, params ListVersionsParams) (*ListVersionsResult, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+
+	res := &ListVersionsResult{
+		Versions:       []ObjectVersion{},
+		CommonPrefixes: []string{},
+	}
+	if params.MaxKeys <= 0 {
+		return res, nil
+	}
+
+	base := versionsPrefix(bucket)
+	prefix := []byte(string(base) + params.Prefix)
+	seek := prefix
+	if params.KeyMarker > params.Prefix {
+		seek = []byte(string(base) + params.KeyMarker)
+	}
+
+	err := DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		count := 0
+		prevKey := ""
+		seenFirst := false
+		passedMarker := false
+		for it.Seek(seek); it.ValidForPrefix(prefix); {
+			item := it.Item()
+			key, versionID, ok := splitVersionKey(string(item.Key()[len(base):]))
+			if !ok {
+				it.Next()
+				continue
+			}
+			isLatest := !seenFirst || key != prevKey
+			prevKey, seenFirst = key, true
+
+			if key < params.KeyMarker {
+				it.Next()
+				continue
+			}
+			if key == params.KeyMarker && (params.VersionIDMarker == "" || !passedMarker) {
+				// Skip up to and including the marker version.
+				passedMarker = sameVersion(versionID, params.VersionIDMarker)
+				it.Next()
+				continue
+			}
+
+			if params.Delimiter != "" {
+				if i := strings.Index(key[len(params.Prefix):], params.Delimiter); i >= 0 {
+					cp := key[:len(params.Prefix)+i+len(params.Delimiter)]
+					if cp != params.KeyMarker {
+						if count == params.MaxKeys {
+							res.IsTruncated = true
+							return nil
+						}
+						res.CommonPrefixes = append(res.CommonPrefixes, cp)
+						res.NextKeyMarker = cp
+						res.NextVersionIDMarker = ""
+						count++
+					}
+
+					next := prefixSuccessor([]byte(string(base) + cp))
+					if next == nil {
+						return nil
+					}
+					it.Seek(next)
+					continue
+				}
+			}
+
+			if count == params.MaxKeys {
+				res.IsTruncated = true
+				return nil
+			}
+			var meta ObjectMeta
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &meta)
+			}); err != nil {
+				return err
+			}
+			res.Versions = append(res.Versions, ObjectVersion{ObjectMeta: meta, IsLatest: isLatest})
+			res.NextKeyMarker = key
+			res.NextVersionIDMarker = versionID
+			if versionID == "" {
+				res.NextVersionIDMarker = NullVersionID
+			}
+			count++
+			it.Next()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !res.IsTruncated {
+		res.NextKeyMarker = ""
+		res.NextVersionIDMarker = ""
+	}
+	return res, nil
+}
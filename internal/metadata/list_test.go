@@ -0,0 +1,109 @@
+package metadata
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListObjects(t *testing.T) {
+	InitDB(t.TempDir())
+	defer CloseDB()
+
+	const owner = "owner"
+	const bucket = "photos"
+	if err := CreateBucket(owner, bucket, false); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	keys := []string{"a/1", "a/2", "b", "c/d/e", "c/f", "d"}
+	for _, k := range keys {
+		if _, err := PutObject(owner, &ObjectMeta{Bucket: bucket, Key: k}); err != nil {
+			t.Fatalf("PutObject(%q): %v", k, err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		params     ListObjectsParams
+		objects    []string
+		prefixes   []string
+		truncated  bool
+		nextMarker string
+	}{
+		{
+			name:     "all",
+			params:   ListObjectsParams{MaxKeys: 1000},
+			objects:  keys,
+			prefixes: []string{},
+		},
+		{
+			name:     "delimiter",
+			params:   ListObjectsParams{Delimiter: "/", MaxKeys: 1000},
+			objects:  []string{"b", "d"},
+			prefixes: []string{"a/", "c/"},
+		},
+		{
+			name:     "prefix and delimiter",
+			params:   ListObjectsParams{Prefix: "c/", Delimiter: "/", MaxKeys: 1000},
+			objects:  []string{"c/f"},
+			prefixes: []string{"c/d/"},
+		},
+		{
+			name:       "truncated on prefix",
+			params:     ListObjectsParams{Delimiter: "/", MaxKeys: 1},
+			objects:    []string{},
+			prefixes:   []string{"a/"},
+			truncated:  true,
+			nextMarker: "a/",
+		},
+		{
+			name:     "resume after prefix",
+			params:   ListObjectsParams{Delimiter: "/", StartAfter: "a/", MaxKeys: 2},
+			objects:  []string{"b"},
+			prefixes: []string{"c/"},
+			// "d" is still left, so the page is truncated.
+			truncated:  true,
+			nextMarker: "c/",
+		},
+		{
+			name:     "start after key",
+			params:   ListObjectsParams{StartAfter: "c/d/e", MaxKeys: 1000},
+			objects:  []string{"c/f", "d"},
+			prefixes: []string{},
+		},
+		{
+			name:     "zero max keys",
+			params:   ListObjectsParams{MaxKeys: 0},
+			objects:  []string{},
+			prefixes: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ListObjects(owner, bucket, tt.params)
+			if err != nil {
+				t.Fatalf("ListObjects: %v", err)
+			}
+			got := []string{}
+			for _, o := range res.Objects {
+				got = append(got, o.Key)
+			}
+			if !reflect.DeepEqual(got, tt.objects) {
+				t.Errorf("objects = %v; want %v", got, tt.objects)
+			}
+			if !reflect.DeepEqual(res.CommonPrefixes, tt.prefixes) {
+				t.Errorf("common prefixes = %v; want %v", res.CommonPrefixes, tt.prefixes)
+			}
+			if res.IsTruncated != tt.truncated {
+				t.Errorf("truncated = %v; want %v", res.IsTruncated, tt.truncated)
+			}
+			if res.NextMarker != tt.nextMarker {
+				t.Errorf("next marker = %q; want %q", res.NextMarker, tt.nextMarker)
+			}
+		})
+	}
+
+	if _, err := ListObjects("someone-else", bucket, ListObjectsParams{MaxKeys: 1}); err != ErrNoAccess {
+		t.Errorf("ListObjects as non-owner: got %v; want ErrNoAccess", err)
+	}
+}
@@ -0,0 +1,560 @@
+package metadata
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	MinPartSize   = 5 << 20
+	MaxPartNumber = 10000
+)
+
+type MultipartUpload struct {
+	UploadID    string
+	Bucket      string
+	Key         string
+	OwnerID     string
+	ContentType string
+	Initiated   time.Time
+	// Encryption is chosen when the upload starts so that every part is
+	// encrypted under the same data key.
+	Encryption *ObjectEncryption `json:",omitempty"`
+	// Compression is likewise fixed for every part.
+	Compression string `json:",omitempty"`
+	// ChecksumAlgorithm, when set, is kept for every part so the object
+	// can be given a checksum of its part checksums on completion.
+	ChecksumAlgorithm string `json:",omitempty"`
+	// Tags and headers are given when the upload starts and land on the
+	// object.
+	Tags map[string]string `json:",omitempty"`
+	ObjectHeaders
+	// Retention and LegalHold are the lock settings asked for when the
+	// upload starts; the bucket's default retention still applies on
+	// completion when Retention is nil.
+	Retention *ObjectRetention `json:",omitempty"`
+	LegalHold bool             `json:",omitempty"`
+}
+
+type PartMeta struct {
+	Number       int
+	BlobID       string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	FrameIndex   []int64         `json:",omitempty"`
+	Checksum     *ObjectChecksum `json:",omitempty"`
+}
+
+type CompletedPart struct {
+	Number int
+	ETag   string
+	// Checksum is optional; when the client lists one it must match the
+	// part's.
+	Checksum string
+}
+
+type CompleteMultipartResult struct {
+	Object *ObjectMeta
+	// Replaced is the object previously stored under the key, if any.
+	Replaced *ObjectMeta
+	// Unused holds uploaded parts that were left out of the final object.
+	Unused []PartMeta
+}
+
+type ListUploadsParams struct {
+	Prefix         string
+	Delimiter      string
+	KeyMarker      string
+	UploadIDMarker string
+	MaxUploads     int
+}
+
+type ListUploadsResult struct {
+	Uploads            []MultipartUpload
+	CommonPrefixes     []string
+	IsTruncated        bool
+	NextKeyMarker      string
+	NextUploadIDMarker string
+}
+
+type ListPartsResult struct {
+	Parts                []PartMeta
+	IsTruncated          bool
+	NextPartNumberMarker int
+}
+
+// Upload records sort by object key first so ListMultipartUploads can walk
+// them in S3 order; the NUL separator keeps "a" ahead of "a/b".
+func uploadKey(bucket string, key string, uploadID string) []byte {
+	return []byte("bucket/" + bucket + "/uploads/" + key + "\x00" + uploadID)
+}
+
+func uploadPrefix(bucket string) []byte {
+	return []byte("bucket/" + bucket + "/uploads/")
+}
+
+func partKey(bucket string, uploadID string, number int) []byte {
+	return []byte(fmt.Sprintf("bucket/%s/parts/%s/%05d", bucket, uploadID, number))
+}
+
+func partPrefix(bucket string, uploadID string) []byte {
+	return []byte("bucket/" + bucket + "/parts/" + uploadID + "/")
+}
+
+// CreateMultipartUpload records a new upload for upload.Bucket and
+// upload.Key, filling in its ID, owner and start time.
+func CreateMultipartUpload(ownerID string, upload *MultipartUpload) error {
+	if err := HeadBucket(ownerID, upload.Bucket); err != nil {
+		return err
+	}
+
+	upload.UploadID = newID()
+	upload.OwnerID = ownerID
+	upload.Initiated = time.Now().UTC()
+
+	return DB.Update(func(txn *badger.Txn) error {
+		if upload.Retention != nil || upload.LegalHold {
+			cfg, err := objectLockState(txn, upload.Bucket)
+			if err != nil {
+				return err
+			}
+			if cfg == nil {
+				return ErrObjectLockNotEnabled
+			}
+		}
+		data, err := json.Marshal(upload)
+		if err != nil {
+			return err
+		}
+		return txn.Set(uploadKey(upload.Bucket, upload.Key, upload.UploadID), data)
+	})
+}
+
+func getUpload(txn *badger.Txn, bucket string, key string, uploadID string) (*MultipartUpload, error) {
+	item, err := txn.Get(uploadKey(bucket, key, uploadID))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var upload MultipartUpload
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &upload)
+	}); err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func GetMultipartUpload(ownerID string, bucket string, key string, uploadID string) (*MultipartUpload, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+
+	var upload *MultipartUpload
+	err := DB.View(func(txn *badger.Txn) error {
+		var err error
+		upload, err = getUpload(txn, bucket, key, uploadID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// PutPart records an uploaded part and returns the part it replaced, if any,
+// so the caller can release the old blob.
+func PutPart(ownerID string, bucket string, key string, uploadID string, part *PartMeta) (*PartMeta, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+	if part.Number < 1 || part.Number > MaxPartNumber {
+		return nil, ErrInvalidPart
+	}
+
+	var prev *PartMeta
+	pk := partKey(bucket, uploadID, part.Number)
+
+	err := DB.Update(func(txn *badger.Txn) error {
+		if _, err := getUpload(txn, bucket, key, uploadID); err != nil {
+			return err
+		}
+
+		item, err := txn.Get(pk)
+		if err == nil {
+			var old PartMeta
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &old)
+			}); err != nil {
+				return err
+			}
+			prev = &old
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+
+		data, err := json.Marshal(part)
+		if err != nil {
+			return err
+		}
+		return txn.Set(pk, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prev, nil
+}
+
+func loadParts(txn *badger.Txn, bucket string, uploadID string) (map[int]PartMeta, error) {
+	parts := map[int]PartMeta{}
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := partPrefix(bucket, uploadID)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var p PartMeta
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &p)
+		}); err != nil {
+			return nil, err
+		}
+		parts[p.Number] = p
+	}
+	return parts, nil
+}
+
+// deleteUpload removes the upload record within txn. An upload can have up
+// to MaxPartNumber part records, more than fit in one transaction beside
+// the caller's other writes, so those are left for deleteParts to remove
+// once txn has committed. Nothing reads them after the upload is gone.
+func deleteUpload(txn *badger.Txn, bucket string, key string, uploadID string) error {
+	return txn.Delete(uploadKey(bucket, key, uploadID))
+}
+
+// deleteParts removes the part records of an upload deleted by
+// deleteUpload, committing in as many transactions as needed. A failure
+// only leaves unreachable records, which go with the bucket, so it is
+// logged rather than returned.
+func deleteParts(bucket string, uploadID string) {
+	if err := deletePrefix(partPrefix(bucket, uploadID)); err != nil {
+		log.Printf("delete parts of upload %s error: %v", uploadID, err)
+	}
+}
+
+func deletePrefix(prefix []byte) error {
+	var keys [][]byte
+	err := DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	txn := DB.NewTransaction(true)
+	defer func() { txn.Discard() }()
+
+	for _, k := range keys {
+		err := txn.Delete(k)
+		if errors.Is(err, badger.ErrTxnTooBig) {
+			if err := txn.Commit(); err != nil {
+				return err
+			}
+			txn = DB.NewTransaction(true)
+			err = txn.Delete(k)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return txn.Commit()
+}
+
+// CompleteMultipartUpload validates the client's part list against what was
+// uploaded and atomically swaps the upload for a finished object. The parts
+// keep their blobs; the object simply references them in order.
+func CompleteMultipartUpload(ownerID string, bucket string, key string, uploadID string, completed []CompletedPart) (*CompleteMultipartResult, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+	if len(completed) == 0 {
+		return nil, ErrInvalidPart
+	}
+
+	var res CompleteMultipartResult
+
+	err := DB.Update(func(txn *badger.Txn) error {
+		upload, err := getUpload(txn, bucket, key, uploadID)
+		if err != nil {
+			return err
+		}
+		uploaded, err := loadParts(txn, bucket, uploadID)
+		if err != nil {
+			return err
+		}
+
+		obj := ObjectMeta{
+			Bucket:       bucket,
+			Key:          key,
+			ContentType:  upload.ContentType,
+			LastModified: time.Now().UTC(),
+			OwnerID:      ownerID,
+			Encryption:   upload.Encryption,
+			Compression:  upload.Compression,
+			Tags:         upload.Tags,
+			Retention:    upload.Retention,
+			LegalHold:    upload.LegalHold,
+		}
+		obj.ObjectHeaders = upload.ObjectHeaders
+		digests := md5.New()
+		for i, c := range completed {
+			if i > 0 && c.Number <= completed[i-1].Number {
+				return ErrInvalidPartOrder
+			}
+			p, ok := uploaded[c.Number]
+			if !ok || strings.Trim(c.ETag, `"`) != p.ETag {
+				return ErrInvalidPart
+			}
+			if c.Checksum != "" && (p.Checksum == nil || c.Checksum != p.Checksum.Value) {
+				return ErrInvalidPart
+			}
+			if i < len(completed)-1 && p.Size < MinPartSize {
+				return ErrEntityTooSmall
+			}
+			raw, err := hex.DecodeString(p.ETag)
+			if err != nil {
+				return err
+			}
+			digests.Write(raw)
+
+			obj.Parts = append(obj.Parts, ObjectPart{
+				Number:     p.Number,
+				BlobID:     p.BlobID,
+				Size:       p.Size,
+				ETag:       p.ETag,
+				FrameIndex: p.FrameIndex,
+				Checksum:   p.Checksum,
+			})
+			obj.Size += p.Size
+			delete(uploaded, c.Number)
+		}
+		obj.ETag = fmt.Sprintf("%s-%d", hex.EncodeToString(digests.Sum(nil)), len(completed))
+		obj.Checksum, err = compositeChecksum(upload.ChecksumAlgorithm, obj.Parts)
+		if err != nil {
+			return err
+		}
+
+		state, err := versioningState(txn, bucket)
+		if err != nil {
+			return err
+		}
+		res.Replaced, err = writeVersion(txn, &obj, state)
+		if err != nil {
+			return err
+		}
+		if err := deleteUpload(txn, bucket, key, uploadID); err != nil {
+			return err
+		}
+
+		for _, p := range uploaded {
+			res.Unused = append(res.Unused, p)
+		}
+		res.Object = &obj
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	deleteParts(bucket, uploadID)
+	return &res, nil
+}
+
+// AbortMultipartUpload drops the upload and returns its parts so the caller
+// can release their blobs.
+func AbortMultipartUpload(ownerID string, bucket string, key string, uploadID string) ([]PartMeta, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+
+	var parts []PartMeta
+
+	err := DB.Update(func(txn *badger.Txn) error {
+		if _, err := getUpload(txn, bucket, key, uploadID); err != nil {
+			return err
+		}
+		uploaded, err := loadParts(txn, bucket, uploadID)
+		if err != nil {
+			return err
+		}
+		for _, p := range uploaded {
+			parts = append(parts, p)
+		}
+		return deleteUpload(txn, bucket, key, uploadID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	deleteParts(bucket, uploadID)
+	return parts, nil
+}
+
+func ListParts(ownerID string, bucket string, key string, uploadID string, marker int, maxParts int) (*ListPartsResult, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+
+	res := &ListPartsResult{Parts: []PartMeta{}}
+
+	err := DB.View(func(txn *badger.Txn) error {
+		if _, err := getUpload(txn, bucket, key, uploadID); err != nil {
+			return err
+		}
+
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := partPrefix(bucket, uploadID)
+		for it.Seek(partKey(bucket, uploadID, marker+1)); it.ValidForPrefix(prefix); it.Next() {
+			if len(res.Parts) == maxParts {
+				res.IsTruncated = true
+				return nil
+			}
+			var p PartMeta
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &p)
+			}); err != nil {
+				return err
+			}
+			res.Parts = append(res.Parts, p)
+			res.NextPartNumberMarker = p.Number
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func ListMultipartUploads(ownerID string, bucket string, params ListUploadsParams) (*ListUploadsResult, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+
+	res := &ListUploadsResult{
+		Uploads:        []MultipartUpload{},
+		CommonPrefixes: []string{},
+	}
+	if params.MaxUploads <= 0 {
+		return res, nil
+	}
+
+	base := uploadPrefix(bucket)
+	prefix := []byte(string(base) + params.Prefix)
+	seek := prefix
+	if params.KeyMarker > params.Prefix {
+		seek = []byte(string(base) + params.KeyMarker)
+	}
+
+	err := DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		count := 0
+		for it.Seek(seek); it.ValidForPrefix(prefix); {
+			item := it.Item()
+			rest := string(item.Key()[len(base):])
+			sep := strings.LastIndexByte(rest, 0)
+			if sep < 0 {
+				it.Next()
+				continue
+			}
+			key, uploadID := rest[:sep], rest[sep+1:]
+			if key < params.KeyMarker ||
+				(key == params.KeyMarker && (params.UploadIDMarker == "" || uploadID <= params.UploadIDMarker)) {
+				it.Next()
+				continue
+			}
+
+			if params.Delimiter != "" {
+				if i := strings.Index(key[len(params.Prefix):], params.Delimiter); i >= 0 {
+					cp := key[:len(params.Prefix)+i+len(params.Delimiter)]
+					if cp != params.KeyMarker {
+						if count == params.MaxUploads {
+							res.IsTruncated = true
+							return nil
+						}
+						res.CommonPrefixes = append(res.CommonPrefixes, cp)
+						res.NextKeyMarker = cp
+						res.NextUploadIDMarker = ""
+						count++
+					}
+
+					next := prefixSuccessor([]byte(string(base) + cp))
+					if next == nil {
+						return nil
+					}
+					it.Seek(next)
+					continue
+				}
+			}
+
+			if count == params.MaxUploads {
+				res.IsTruncated = true
+				return nil
+			}
+			var upload MultipartUpload
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &upload)
+			}); err != nil {
+				return err
+			}
+			res.Uploads = append(res.Uploads, upload)
+			res.NextKeyMarker = key
+			res.NextUploadIDMarker = uploadID
+			count++
+			it.Next()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !res.IsTruncated {
+		res.NextKeyMarker = ""
+		res.NextUploadIDMarker = ""
+	}
+	return res, nil
+}
+
+func bucketHasUploads(txn *badger.Txn, bucket string) bool {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	prefix := uploadPrefix(bucket)
+	it.Seek(prefix)
+	return it.ValidForPrefix(prefix)
+}
@@ -0,0 +1,171 @@
+package metadata
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func partETag(n int) string {
+	sum := md5.Sum([]byte(fmt.Sprint("part ", n)))
+	return hex.EncodeToString(sum[:])
+}
+
+func putTestPart(t *testing.T, upload *MultipartUpload, n int, size int64) {
+	t.Helper()
+	part := &PartMeta{Number: n, BlobID: fmt.Sprint("blob-", n), Size: size, ETag: partETag(n)}
+	if _, err := PutPart(upload.OwnerID, upload.Bucket, upload.Key, upload.UploadID, part); err != nil {
+		t.Fatalf("PutPart(%d): %v", n, err)
+	}
+}
+
+func countParts(t *testing.T, upload *MultipartUpload) int {
+	t.Helper()
+	n := 0
+	err := DB.View(func(txn *badger.Txn) error {
+		parts, err := loadParts(txn, upload.Bucket, upload.UploadID)
+		n = len(parts)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestMultipartUpload(t *testing.T) {
+	InitDB(t.TempDir())
+	defer CloseDB()
+	const owner, bucket = "owner", "uploads"
+	newTestBucket(t, owner, bucket, "")
+
+	upload := &MultipartUpload{Bucket: bucket, Key: "big"}
+	if err := CreateMultipartUpload(owner, upload); err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	if upload.UploadID == "" || upload.OwnerID != owner || upload.Initiated.IsZero() {
+		t.Fatalf("CreateMultipartUpload left %+v", upload)
+	}
+	// Parts arrive out of order and part 2 is uploaded twice.
+	putTestPart(t, upload, 3, 10)
+	putTestPart(t, upload, 1, MinPartSize)
+	putTestPart(t, upload, 2, 1)
+	replaced, err := PutPart(owner, bucket, "big", upload.UploadID,
+		&PartMeta{Number: 2, BlobID: "blob-2b", Size: MinPartSize, ETag: partETag(2)})
+	if err != nil || replaced == nil || replaced.BlobID != "blob-2" {
+		t.Fatalf("re-uploading part 2 = %+v, %v; want the first part 2", replaced, err)
+	}
+	if _, err := PutPart(owner, bucket, "big", upload.UploadID, &PartMeta{Number: MaxPartNumber + 1}); !errors.Is(err, ErrInvalidPart) {
+		t.Errorf("part number over the limit: got %v; want ErrInvalidPart", err)
+	}
+
+	list, err := ListParts(owner, bucket, "big", upload.UploadID, 0, 2)
+	if err != nil {
+		t.Fatalf("ListParts: %v", err)
+	}
+	if len(list.Parts) != 2 || list.Parts[0].Number != 1 || list.Parts[1].Number != 2 || !list.IsTruncated || list.NextPartNumberMarker != 2 {
+		t.Errorf("first page = %+v", list)
+	}
+	list, err = ListParts(owner, bucket, "big", upload.UploadID, list.NextPartNumberMarker, 2)
+	if err != nil {
+		t.Fatalf("ListParts: %v", err)
+	}
+	if len(list.Parts) != 1 || list.Parts[0].Number != 3 || list.IsTruncated {
+		t.Errorf("second page = %+v", list)
+	}
+
+	complete := func(parts ...CompletedPart) error {
+		_, err := CompleteMultipartUpload(owner, bucket, "big", upload.UploadID, parts)
+		return err
+	}
+	p := func(n int) CompletedPart { return CompletedPart{Number: n, ETag: `"` + partETag(n) + `"`} }
+
+	failures := []struct {
+		name  string
+		parts []CompletedPart
+		want  error
+	}{
+		{"no parts", nil, ErrInvalidPart},
+		{"out of order", []CompletedPart{p(2), p(1)}, ErrInvalidPartOrder},
+		{"repeated part", []CompletedPart{p(1), p(1)}, ErrInvalidPartOrder},
+		{"missing part", []CompletedPart{p(1), p(4)}, ErrInvalidPart},
+		{"wrong etag", []CompletedPart{p(1), {Number: 2, ETag: partETag(3)}}, ErrInvalidPart},
+	}
+	for _, f := range failures {
+		if err := complete(f.parts...); !errors.Is(err, f.want) {
+			t.Errorf("%s: got %v; want %v", f.name, err, f.want)
+		}
+	}
+	putTestPart(t, upload, 4, 1)
+	if err := complete(p(1), p(3), p(4)); !errors.Is(err, ErrEntityTooSmall) {
+		t.Errorf("small part before the last: got %v; want ErrEntityTooSmall", err)
+	}
+
+	res, err := CompleteMultipartUpload(owner, bucket, "big", upload.UploadID, []CompletedPart{p(1), p(2), p(3)})
+	if err != nil {
+		t.Fatalf("CompleteMultipartUpload: %v", err)
+	}
+	digests := md5.New()
+	for n := 1; n <= 3; n++ {
+		raw, _ := hex.DecodeString(partETag(n))
+		digests.Write(raw)
+	}
+	wantETag := hex.EncodeToString(digests.Sum(nil)) + "-3"
+	obj := res.Object
+	if obj.ETag != wantETag || obj.Size != 2*MinPartSize+10 || len(obj.Parts) != 3 || obj.Parts[1].BlobID != "blob-2b" {
+		t.Errorf("completed object = %+v; want ETag %s", obj, wantETag)
+	}
+	if len(res.Unused) != 1 || res.Unused[0].Number != 4 {
+		t.Errorf("unused parts = %+v; want part 4", res.Unused)
+	}
+	if got, err := GetObject(owner, bucket, "big"); err != nil || got.ETag != wantETag {
+		t.Errorf("GetObject = %+v, %v", got, err)
+	}
+	if _, err := ListParts(owner, bucket, "big", upload.UploadID, 0, 10); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("ListParts after completion: got %v; want ErrUploadNotFound", err)
+	}
+	if n := countParts(t, upload); n != 0 {
+		t.Errorf("%d part records left after completion", n)
+	}
+}
+
+func TestAbortMultipartUpload(t *testing.T) {
+	InitDB(t.TempDir())
+	defer CloseDB()
+	const owner, bucket = "owner", "uploads"
+	newTestBucket(t, owner, bucket, "")
+
+	upload := &MultipartUpload{Bucket: bucket, Key: "big"}
+	if err := CreateMultipartUpload(owner, upload); err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	// Part records are removed after the upload record, in batches.
+	const parts = 2000
+	for n := 1; n <= parts; n++ {
+		putTestPart(t, upload, n, 1)
+	}
+	if err := DeleteBucket(owner, bucket); !errors.Is(err, ErrBucketNotEmpty) {
+		t.Errorf("DeleteBucket with an upload: got %v; want ErrBucketNotEmpty", err)
+	}
+
+	aborted, err := AbortMultipartUpload(owner, bucket, "big", upload.UploadID)
+	if err != nil {
+		t.Fatalf("AbortMultipartUpload: %v", err)
+	}
+	if len(aborted) != parts {
+		t.Errorf("aborted %d parts; want %d", len(aborted), parts)
+	}
+	if n := countParts(t, upload); n != 0 {
+		t.Errorf("%d part records left after abort", n)
+	}
+	if _, err := AbortMultipartUpload(owner, bucket, "big", upload.UploadID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("second abort: got %v; want ErrUploadNotFound", err)
+	}
+	if err := DeleteBucket(owner, bucket); err != nil {
+		t.Errorf("DeleteBucket: %v", err)
+	}
+}
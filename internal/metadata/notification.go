@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"strings"
 
 	"github.com/dgraph-io/badger/v4"
 )
@@ -118,8 +119,8 @@ func IsNotificationTargetInUse(ownerID, targetID string) (bool, error) {
 			}
 
 			bucketName := string(k[len(prefix) : len(k)-len(suffix)])
-			if bucketName == "" {
-				continue
+			if bucketName == "" || strings.Contains(bucketName, "/") {
+				continue // object keys can end in /notification too
 			}
 
 			// Owner check from a bucket metadata key
@@ -1 +1,541 @@
 package metadata
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type ObjectMeta struct {
+	Bucket       string
+	Key          string
+	Size         int64
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+	OwnerID      string
+	// VersionID is empty for objects in a bucket that never had versioning.
+	VersionID      string
+	IsDeleteMarker bool
+	// BlobID holds the data of a single-request upload. Objects assembled
+	// by multipart upload leave it empty and list their blobs in Parts.
+	BlobID     string
+	Parts      []ObjectPart
+	Tags       map[string]string `json:",omitempty"`
+	Encryption *ObjectEncryption `json:",omitempty"`
+	// Checksum is set when the write named a checksum algorithm, by sending
+	// a checksum or by asking for one. The server computes it itself for
+	// copies, which keep the source's algorithm, and for multipart
+	// uploads, where it is the checksum of the part checksums.
+	Checksum *ObjectChecksum `json:",omitempty"`
+	// Compression names the codec the blobs were compressed with; Size
+	// and ETag still describe the uncompressed bytes. FrameIndex locates
+	// the compressed frames of BlobID.
+	Compression string  `json:",omitempty"`
+	FrameIndex  []int64 `json:",omitempty"`
+	// Retention and LegalHold are only set in buckets with object lock.
+	Retention *ObjectRetention `json:",omitempty"`
+	LegalHold bool             `json:",omitempty"`
+
+	ObjectHeaders
+}
+
+// ObjectHeaders are the headers a client sets on upload and gets back on
+// every GET and HEAD of the object.
+type ObjectHeaders struct {
+	ContentEncoding    string `json:",omitempty"`
+	ContentDisposition string `json:",omitempty"`
+	ContentLanguage    string `json:",omitempty"`
+	CacheControl       string `json:",omitempty"`
+	Expires            string `json:",omitempty"`
+	// UserMetadata holds the x-amz-meta-* headers, keyed by the lowercased
+	// name without the prefix.
+	UserMetadata map[string]string `json:",omitempty"`
+}
+
+// ObjectEncryption records how an object's blobs were encrypted. The data
+// key is only ever stored sealed.
+type ObjectEncryption struct {
+	Algorithm string // "AES256" or "aws:kms"
+	// SealedKey is the data key sealed by version KeyVersion of the KMS
+	// key KeyID (SSE-S3 and SSE-KMS).
+	SealedKey  []byte `json:",omitempty"`
+	KeyID      string `json:",omitempty"`
+	KeyVersion int    `json:",omitempty"`
+	// With a customer-provided key (SSE-C) the data key is derived from
+	// that key and the salt on every request; only a salted fingerprint of
+	// the customer key is kept to check later requests against.
+	CustomerKeySalt        []byte `json:",omitempty"`
+	CustomerKeyFingerprint []byte `json:",omitempty"`
+}
+
+// IsCustomerKey reports whether the object was written with SSE-C.
+func (e *ObjectEncryption) IsCustomerKey() bool {
+	return len(e.CustomerKeyFingerprint) > 0
+}
+
+type ObjectPart struct {
+	Number     int
+	BlobID     string
+	Size       int64
+	ETag       string
+	FrameIndex []int64         `json:",omitempty"`
+	Checksum   *ObjectChecksum `json:",omitempty"`
+}
+
+// Segments returns the blobs making up the object, in order.
+func (m *ObjectMeta) Segments() []ObjectPart {
+	if len(m.Parts) > 0 {
+		return m.Parts
+	}
+	return []ObjectPart{{Number: 1, BlobID: m.BlobID, Size: m.Size, ETag: m.ETag, FrameIndex: m.FrameIndex, Checksum: m.Checksum}}
+}
+
+type DeleteObjectResult struct {
+	VersionID    string
+	DeleteMarker bool
+	// Released is the data version that no longer exists, if any; the
+	// caller owns freeing its blobs.
+	Released *ObjectMeta
+}
+
+// Every version of a key, delete markers included, lives under
+// bucket/<name>/versions/<key>\x00<seq><versionID>, where seq sorts the
+// newest version first. bucket/<name>/objects/<key> mirrors the newest
+// version unless that is a delete marker, which keeps plain listings and
+// GETs to a single lookup.
+func objectKey(bucket string, key string) []byte {
+	return []byte("bucket/" + bucket + "/objects/" + key)
+}
+
+func objectPrefix(bucket string) []byte {
+	return []byte("bucket/" + bucket + "/objects/")
+}
+
+func versionKey(meta *ObjectMeta) []byte {
+	return []byte(string(versionPrefix(meta.Bucket, meta.Key)) + versionSeq(meta.LastModified) + meta.VersionID)
+}
+
+func versionPrefix(bucket string, key string) []byte {
+	return []byte("bucket/" + bucket + "/versions/" + key + "\x00")
+}
+
+func versionsPrefix(bucket string) []byte {
+	return []byte("bucket/" + bucket + "/versions/")
+}
+
+const versionSeqLen = 16
+
+func versionSeq(t time.Time) string {
+	return fmt.Sprintf("%016x", ^uint64(t.UnixNano()))
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// loadVersions returns every version of key, newest first.
+func loadVersions(txn *badger.Txn, bucket string, key string) ([]ObjectMeta, error) {
+	var versions []ObjectMeta
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	// The prefix also matches the versions of any key that continues with
+	// a NUL, so each record's key is checked.
+	prefix := versionPrefix(bucket, key)
+	base := len(versionsPrefix(bucket))
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if k, _, ok := splitVersionKey(string(it.Item().Key()[base:])); !ok || k != key {
+			continue
+		}
+		var v ObjectMeta
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &v)
+		}); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+func findVersion(versions []ObjectMeta, versionID string) int {
+	for i, v := range versions {
+		if sameVersion(v.VersionID, versionID) {
+			return i
+		}
+	}
+	return -1
+}
+
+// addressedVersion finds the version a subresource request addresses:
+// versionID, or the newest version when it is empty. It also reports
+// whether that is the newest version, whose copy under objects/ must be
+// kept in step.
+func addressedVersion(txn *badger.Txn, bucket string, key string, versionID string) (*ObjectMeta, bool, error) {
+	versions, err := loadVersions(txn, bucket, key)
+	if err != nil {
+		return nil, false, err
+	}
+	i := 0
+	if versionID != "" {
+		i = findVersion(versions, versionID)
+		if i < 0 {
+			return nil, false, ErrVersionNotFound
+		}
+	} else if len(versions) == 0 {
+		return nil, false, ErrObjectNotFound
+	}
+	if versions[i].IsDeleteMarker {
+		return nil, false, ErrDeleteMarker
+	}
+	return &versions[i], i == 0, nil
+}
+
+func viewVersion(ownerID string, bucket string, find func(txn *badger.Txn) (*ObjectMeta, bool, error)) (*ObjectMeta, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+
+	var meta ObjectMeta
+	err := DB.View(func(txn *badger.Txn) error {
+		v, _, err := find(txn)
+		if err != nil {
+			return err
+		}
+		meta = *v
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// updateVersion rewrites the version find returns after applying update to
+// it, in place: the version keeps its ID and modification time.
+func updateVersion(ownerID string, bucket string, find func(txn *badger.Txn) (*ObjectMeta, bool, error), update func(*ObjectMeta) error) error {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return err
+	}
+
+	return DB.Update(func(txn *badger.Txn) error {
+		v, latest, err := find(txn)
+		if err != nil {
+			return err
+		}
+		if err := update(v); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(versionKey(v), data); err != nil {
+			return err
+		}
+		if latest {
+			return setLatest(txn, bucket, v.Key, v)
+		}
+		return nil
+	})
+}
+
+func sameVersion(a string, b string) bool {
+	return a == b || (IsNullVersion(a) && IsNullVersion(b))
+}
+
+// setLatest points the objects/ entry at the newest remaining version.
+func setLatest(txn *badger.Txn, bucket string, key string, latest *ObjectMeta) error {
+	if latest == nil || latest.IsDeleteMarker {
+		return txn.Delete(objectKey(bucket, key))
+	}
+	data, err := json.Marshal(latest)
+	if err != nil {
+		return err
+	}
+	return txn.Set(objectKey(bucket, key), data)
+}
+
+// writeVersion makes meta the newest version of its key, assigning a
+// version ID according to the bucket's versioning state. Outside of
+// Enabled, the new version takes over the null version; the one it
+// displaced is returned so its blobs can be released.
+func writeVersion(txn *badger.Txn, meta *ObjectMeta, state string) (*ObjectMeta, error) {
+	versions, err := loadVersions(txn, meta.Bucket, meta.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyObjectLock(txn, meta); err != nil {
+		return nil, err
+	}
+
+	switch state {
+	case VersioningEnabled:
+		meta.VersionID = newID()
+	case VersioningSuspended:
+		meta.VersionID = NullVersionID
+	default:
+		meta.VersionID = ""
+	}
+
+	// The version order comes from the timestamp, so never let a clock
+	// step backwards put the new version behind an older one.
+	if len(versions) > 0 && !meta.LastModified.After(versions[0].LastModified) {
+		meta.LastModified = versions[0].LastModified.Add(time.Nanosecond)
+	}
+
+	var released *ObjectMeta
+	if state != VersioningEnabled {
+		if i := findVersion(versions, NullVersionID); i >= 0 {
+			if err := txn.Delete(versionKey(&versions[i])); err != nil {
+				return nil, err
+			}
+			if !versions[i].IsDeleteMarker {
+				released = &versions[i]
+			}
+		}
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := txn.Set(versionKey(meta), data); err != nil {
+		return nil, err
+	}
+	if err := setLatest(txn, meta.Bucket, meta.Key, meta); err != nil {
+		return nil, err
+	}
+	return released, nil
+}
+
+// PutObject stores meta as the newest version of its key and returns the
+// version it replaced, if any, so the caller can release the old blobs.
+// meta.VersionID is filled in from the bucket's versioning state.
+func PutObject(ownerID string, meta *ObjectMeta) (*ObjectMeta, error) {
+	if err := HeadBucket(ownerID, meta.Bucket); err != nil {
+		return nil, err
+	}
+
+	var prev *ObjectMeta
+
+	err := DB.Update(func(txn *badger.Txn) error {
+		state, err := versioningState(txn, meta.Bucket)
+		if err != nil {
+			return err
+		}
+		prev, err = writeVersion(txn, meta, state)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prev, nil
+}
+
+// GetObject returns the newest version of key. If that version is a delete
+// marker it returns ErrDeleteMarker.
+func GetObject(ownerID string, bucket string, key string) (*ObjectMeta, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+
+	var meta ObjectMeta
+
+	err := DB.View(
+		func(txn *badger.Txn) error {
+			item, err := txn.Get(objectKey(bucket, key))
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				versions, err := loadVersions(txn, bucket, key)
+				if err != nil {
+					return err
+				}
+				if len(versions) > 0 && versions[0].IsDeleteMarker {
+					return ErrDeleteMarker
+				}
+				return ErrObjectNotFound
+			}
+			if err != nil {
+				return err
+			}
+			return item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &meta)
+			})
+		})
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// GetObjectVersion returns a specific version of key, which may be a delete
+// marker.
+func GetObjectVersion(ownerID string, bucket string, key string, versionID string) (*ObjectMeta, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+
+	var meta ObjectMeta
+
+	err := DB.View(func(txn *badger.Txn) error {
+		versions, err := loadVersions(txn, bucket, key)
+		if err != nil {
+			return err
+		}
+		i := findVersion(versions, versionID)
+		if i < 0 {
+			return ErrVersionNotFound
+		}
+		meta = versions[i]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// DeleteObject deletes key the way S3 does for a request without a version
+// ID: a bucket that never had versioning loses the object outright, while a
+// versioned bucket gets a delete marker on top of the existing versions.
+func DeleteObject(ownerID string, bucket string, key string) (*DeleteObjectResult, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+
+	var res DeleteObjectResult
+
+	err := DB.Update(
+		func(txn *badger.Txn) error {
+			state, err := versioningState(txn, bucket)
+			if err != nil {
+				return err
+			}
+
+			if state == "" {
+				versions, err := loadVersions(txn, bucket, key)
+				if err != nil {
+					return err
+				}
+				if len(versions) == 0 {
+					return ErrObjectNotFound
+				}
+				if err := txn.Delete(versionKey(&versions[0])); err != nil {
+					return err
+				}
+				res.Released = &versions[0]
+				return setLatest(txn, bucket, key, nil)
+			}
+
+			marker := ObjectMeta{
+				Bucket:         bucket,
+				Key:            key,
+				LastModified:   time.Now().UTC(),
+				OwnerID:        ownerID,
+				IsDeleteMarker: true,
+			}
+			released, err := writeVersion(txn, &marker, state)
+			if err != nil {
+				return err
+			}
+			res.VersionID = marker.VersionID
+			res.DeleteMarker = true
+			res.Released = released
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// DeleteObjectVersion permanently removes one version of key. Removing the
+// newest version promotes the next one. A version under retention or legal
+// hold is refused with ErrObjectLocked; bypassGovernance lifts governance
+// retention only.
+func DeleteObjectVersion(ownerID string, bucket string, key string, versionID string, bypassGovernance bool) (*DeleteObjectResult, error) {
+	if err := HeadBucket(ownerID, bucket); err != nil {
+		return nil, err
+	}
+	if !ValidVersionID(versionID) {
+		return nil, ErrInvalidVersionID
+	}
+
+	var res DeleteObjectResult
+
+	err := DB.Update(func(txn *badger.Txn) error {
+		versions, err := loadVersions(txn, bucket, key)
+		if err != nil {
+			return err
+		}
+		i := findVersion(versions, versionID)
+		if i < 0 {
+			return ErrVersionNotFound
+		}
+
+		v := versions[i]
+		if v.IsLocked(time.Now(), bypassGovernance) {
+			return ErrObjectLocked
+		}
+		if err := txn.Delete(versionKey(&v)); err != nil {
+			return err
+		}
+		if i == 0 {
+			var next *ObjectMeta
+			if len(versions) > 1 {
+				next = &versions[1]
+			}
+			if err := setLatest(txn, bucket, key, next); err != nil {
+				return err
+			}
+		}
+
+		res.VersionID = v.VersionID
+		res.DeleteMarker = v.IsDeleteMarker
+		if !v.IsDeleteMarker {
+			res.Released = &v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// splitVersionKey splits the part of a version key after the bucket's
+// versions/ prefix into the object key and version ID.
+func splitVersionKey(rest string) (string, string, bool) {
+	sep := strings.LastIndexByte(rest, 0)
+	if sep < 0 || len(rest)-sep-1 < versionSeqLen {
+		return "", "", false
+	}
+	return rest[:sep], rest[sep+1+versionSeqLen:], true
+}
+
+// bucketHasObjects reports whether any version of any key, delete markers
+// included, is left in the bucket.
+func bucketHasObjects(txn *badger.Txn, bucket string) bool {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	prefix := versionsPrefix(bucket)
+	it.Seek(prefix)
+	return it.ValidForPrefix(prefix)
+}
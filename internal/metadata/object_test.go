@@ -0,0 +1,205 @@
+package metadata
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// listVersions returns the version IDs of key, newest first, with "*"
+// marking a delete marker.
+func listVersions(t *testing.T, owner string, bucket string) []string {
+	t.Helper()
+	res, err := ListObjectVersions(owner, bucket, ListVersionsParams{MaxKeys: 1000})
+	if err != nil {
+		t.Fatalf("ListObjectVersions: %v", err)
+	}
+	ids := []string{}
+	for _, v := range res.Versions {
+		id := v.VersionID
+		if v.IsDeleteMarker {
+			id = "*" + id
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func newTestBucket(t *testing.T, owner string, bucket string, state string) {
+	t.Helper()
+	if err := CreateBucket(owner, bucket, false); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	if state != "" {
+		if err := PutBucketVersioning(owner, bucket, &BucketVersioning{Status: state}); err != nil {
+			t.Fatalf("PutBucketVersioning: %v", err)
+		}
+	}
+}
+
+func putTestObject(t *testing.T, owner string, bucket string, key string, etag string) (*ObjectMeta, *ObjectMeta) {
+	t.Helper()
+	meta := &ObjectMeta{Bucket: bucket, Key: key, ETag: etag, LastModified: time.Now().UTC()}
+	prev, err := PutObject(owner, meta)
+	if err != nil {
+		t.Fatalf("PutObject(%q): %v", key, err)
+	}
+	return meta, prev
+}
+
+func TestUnversionedObjects(t *testing.T) {
+	InitDB(t.TempDir())
+	defer CloseDB()
+	const owner, bucket = "owner", "plain"
+	newTestBucket(t, owner, bucket, "")
+
+	first, _ := putTestObject(t, owner, bucket, "k", "1")
+	second, prev := putTestObject(t, owner, bucket, "k", "2")
+	if first.VersionID != "" || second.VersionID != "" {
+		t.Errorf("version IDs = %q, %q; want none", first.VersionID, second.VersionID)
+	}
+	if prev == nil || prev.ETag != "1" {
+		t.Errorf("overwrite released %+v; want the first object", prev)
+	}
+	if got := listVersions(t, owner, bucket); len(got) != 1 {
+		t.Errorf("versions = %v; want one", got)
+	}
+
+	// A key that continues with a NUL shares the version prefix of "k" but
+	// is another object.
+	putTestObject(t, owner, bucket, "k\x00x", "3")
+
+	res, err := DeleteObject(owner, bucket, "k")
+	if err != nil {
+		t.Fatalf("DeleteObject: %v", err)
+	}
+	if res.DeleteMarker || res.Released == nil || res.Released.ETag != "2" {
+		t.Errorf("DeleteObject = %+v; want the object released and no marker", res)
+	}
+	if _, err := GetObject(owner, bucket, "k"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("GetObject after delete: got %v; want ErrObjectNotFound", err)
+	}
+	if _, err := DeleteObject(owner, bucket, "k"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("second DeleteObject: got %v; want ErrObjectNotFound", err)
+	}
+	if got := listVersions(t, owner, bucket); len(got) != 1 {
+		t.Errorf("versions after delete = %v; want the other key's", got)
+	}
+	if res, err := DeleteObject(owner, bucket, "k\x00x"); err != nil || res.Released == nil || res.Released.ETag != "3" {
+		t.Errorf("DeleteObject(k\\x00x) = %+v, %v", res, err)
+	}
+	if err := DeleteBucket(owner, bucket); err != nil {
+		t.Errorf("DeleteBucket: %v", err)
+	}
+}
+
+func TestVersionedObjects(t *testing.T) {
+	InitDB(t.TempDir())
+	defer CloseDB()
+	const owner, bucket = "owner", "versioned"
+	newTestBucket(t, owner, bucket, VersioningEnabled)
+
+	v1, _ := putTestObject(t, owner, bucket, "k", "1")
+	v2, prev := putTestObject(t, owner, bucket, "k", "2")
+	if v1.VersionID == "" || v1.VersionID == v2.VersionID {
+		t.Fatalf("version IDs = %q, %q; want two distinct IDs", v1.VersionID, v2.VersionID)
+	}
+	if prev != nil {
+		t.Errorf("overwrite released %+v; versions are kept", prev)
+	}
+
+	res, err := DeleteObject(owner, bucket, "k")
+	if err != nil {
+		t.Fatalf("DeleteObject: %v", err)
+	}
+	if !res.DeleteMarker || res.VersionID == "" || res.Released != nil {
+		t.Errorf("DeleteObject = %+v; want a delete marker and nothing released", res)
+	}
+	marker := res.VersionID
+	if _, err := GetObject(owner, bucket, "k"); !errors.Is(err, ErrDeleteMarker) {
+		t.Errorf("GetObject under marker: got %v; want ErrDeleteMarker", err)
+	}
+	if got, err := GetObjectVersion(owner, bucket, "k", v1.VersionID); err != nil || got.ETag != "1" {
+		t.Errorf("GetObjectVersion(v1) = %+v, %v", got, err)
+	}
+	want := []string{"*" + marker, v2.VersionID, v1.VersionID}
+	if got := listVersions(t, owner, bucket); !equalStrings(got, want) {
+		t.Errorf("versions = %v; want %v", got, want)
+	}
+	if err := DeleteBucket(owner, bucket); !errors.Is(err, ErrBucketNotEmpty) {
+		t.Errorf("DeleteBucket with versions left: got %v; want ErrBucketNotEmpty", err)
+	}
+
+	// Removing the marker brings the newest data version back.
+	res, err = DeleteObjectVersion(owner, bucket, "k", marker, false)
+	if err != nil || !res.DeleteMarker || res.Released != nil {
+		t.Fatalf("DeleteObjectVersion(marker) = %+v, %v", res, err)
+	}
+	if got, err := GetObject(owner, bucket, "k"); err != nil || got.VersionID != v2.VersionID {
+		t.Errorf("GetObject after removing marker = %+v, %v; want v2", got, err)
+	}
+
+	// Removing the newest version promotes the one before it.
+	res, err = DeleteObjectVersion(owner, bucket, "k", v2.VersionID, false)
+	if err != nil || res.Released == nil || res.Released.ETag != "2" {
+		t.Fatalf("DeleteObjectVersion(v2) = %+v, %v", res, err)
+	}
+	if got, err := GetObject(owner, bucket, "k"); err != nil || got.VersionID != v1.VersionID {
+		t.Errorf("GetObject after removing v2 = %+v, %v; want v1", got, err)
+	}
+	if _, err := DeleteObjectVersion(owner, bucket, "k", v2.VersionID, false); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("deleting a removed version: got %v; want ErrVersionNotFound", err)
+	}
+}
+
+func TestSuspendedVersioning(t *testing.T) {
+	InitDB(t.TempDir())
+	defer CloseDB()
+	const owner, bucket = "owner", "suspended"
+	newTestBucket(t, owner, bucket, VersioningEnabled)
+
+	v1, _ := putTestObject(t, owner, bucket, "k", "1")
+	if err := PutBucketVersioning(owner, bucket, &BucketVersioning{Status: VersioningSuspended}); err != nil {
+		t.Fatalf("PutBucketVersioning: %v", err)
+	}
+
+	// While suspended, writes replace the null version and leave the
+	// versions written before alone.
+	n1, prev := putTestObject(t, owner, bucket, "k", "2")
+	if n1.VersionID != NullVersionID || prev != nil {
+		t.Errorf("first suspended put: version %q, released %+v; want null, nothing", n1.VersionID, prev)
+	}
+	_, prev = putTestObject(t, owner, bucket, "k", "3")
+	if prev == nil || prev.ETag != "2" {
+		t.Errorf("second suspended put released %+v; want the previous null version", prev)
+	}
+	want := []string{NullVersionID, v1.VersionID}
+	if got := listVersions(t, owner, bucket); !equalStrings(got, want) {
+		t.Errorf("versions = %v; want %v", got, want)
+	}
+
+	// A delete puts a null delete marker in place of the null version.
+	res, err := DeleteObject(owner, bucket, "k")
+	if err != nil {
+		t.Fatalf("DeleteObject: %v", err)
+	}
+	if !res.DeleteMarker || res.VersionID != NullVersionID || res.Released == nil || res.Released.ETag != "3" {
+		t.Errorf("DeleteObject = %+v; want a null marker releasing the null version", res)
+	}
+	want = []string{"*" + NullVersionID, v1.VersionID}
+	if got := listVersions(t, owner, bucket); !equalStrings(got, want) {
+		t.Errorf("versions = %v; want %v", got, want)
+	}
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,250 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	// RetentionGovernance locks a version against anyone who does not ask
+	// to bypass governance retention.
+	RetentionGovernance = "GOVERNANCE"
+	// RetentionCompliance locks a version against everyone until the
+	// retention date passes; it can only be extended.
+	RetentionCompliance = "COMPLIANCE"
+)
+
+type ObjectLockConfig struct {
+	Enabled          bool              `json:"enabled"`
+	DefaultRetention *DefaultRetention `json:"default_retention,omitempty"`
+}
+
+// DefaultRetention is applied to every new version that does not carry its
+// own retention. Exactly one of Days and Years is set.
+type DefaultRetention struct {
+	Mode  string `json:"mode"`
+	Days  int    `json:"days,omitempty"`
+	Years int    `json:"years,omitempty"`
+}
+
+type ObjectRetention struct {
+	Mode        string
+	RetainUntil time.Time
+}
+
+func objectLockKey(bucket string) []byte {
+	return []byte("bucket/" + bucket + "/object-lock")
+}
+
+func GetObjectLockConfig(ownerID string, name string) (*ObjectLockConfig, error) {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return nil, err
+	}
+
+	var cfg *ObjectLockConfig
+	err := DB.View(func(txn *badger.Txn) error {
+		var err error
+		cfg, err = objectLockState(txn, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, ErrObjectLockConfigNotFound
+	}
+	return cfg, nil
+}
+
+// PutObjectLockConfig replaces the default retention of a bucket created
+// with object lock. Object lock itself cannot be turned off.
+func PutObjectLockConfig(ownerID string, name string, cfg *ObjectLockConfig) error {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return err
+	}
+
+	if cfg == nil || !cfg.Enabled {
+		return ErrInvalidObjectLockConfig
+	}
+	if d := cfg.DefaultRetention; d != nil {
+		if !validRetentionMode(d.Mode) || d.Days < 0 || d.Years < 0 || (d.Days > 0) == (d.Years > 0) {
+			return ErrInvalidObjectLockConfig
+		}
+	}
+
+	return DB.Update(func(txn *badger.Txn) error {
+		current, err := objectLockState(txn, name)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return ErrObjectLockNotEnabled
+		}
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		return txn.Set(objectLockKey(name), data)
+	})
+}
+
+// objectLockState returns the bucket's object lock config, or nil if the
+// bucket was created without object lock.
+func objectLockState(txn *badger.Txn, bucket string) (*ObjectLockConfig, error) {
+	item, err := txn.Get(objectLockKey(bucket))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg ObjectLockConfig
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &cfg)
+	}); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// applyObjectLock checks the lock settings a new version arrives with and
+// fills in the bucket's default retention when it has none.
+func applyObjectLock(txn *badger.Txn, meta *ObjectMeta) error {
+	if meta.IsDeleteMarker {
+		return nil
+	}
+	cfg, err := objectLockState(txn, meta.Bucket)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		if meta.Retention != nil || meta.LegalHold {
+			return ErrObjectLockNotEnabled
+		}
+		return nil
+	}
+	if meta.Retention != nil || cfg.DefaultRetention == nil {
+		return nil
+	}
+
+	d := cfg.DefaultRetention
+	meta.Retention = &ObjectRetention{
+		Mode:        d.Mode,
+		RetainUntil: meta.LastModified.AddDate(d.Years, 0, d.Days),
+	}
+	return nil
+}
+
+func validRetentionMode(mode string) bool {
+	return mode == RetentionGovernance || mode == RetentionCompliance
+}
+
+// ValidateRetention checks a retention requested by a client: a known mode
+// and a date that has not passed yet.
+func ValidateRetention(ret *ObjectRetention) error {
+	if !validRetentionMode(ret.Mode) || !ret.RetainUntil.After(time.Now()) {
+		return ErrInvalidRetention
+	}
+	return nil
+}
+
+// IsLocked reports whether the version may not be deleted at now. A legal
+// hold always blocks; governance retention can be bypassed, compliance
+// retention cannot.
+func (m *ObjectMeta) IsLocked(now time.Time, bypassGovernance bool) bool {
+	if m.LegalHold {
+		return true
+	}
+	if m.Retention == nil || !now.Before(m.Retention.RetainUntil) {
+		return false
+	}
+	return m.Retention.Mode == RetentionCompliance || !bypassGovernance
+}
+
+// loosensRetention reports whether replacing cur with next would shorten or
+// weaken an active retention period.
+func loosensRetention(cur *ObjectRetention, next *ObjectRetention, now time.Time) bool {
+	if cur == nil || !now.Before(cur.RetainUntil) {
+		return false
+	}
+	if next == nil || next.RetainUntil.Before(cur.RetainUntil) {
+		return true
+	}
+	return cur.Mode == RetentionCompliance && next.Mode != RetentionCompliance
+}
+
+func GetObjectRetention(ownerID string, bucket string, key string, versionID string) (*ObjectRetention, error) {
+	meta, err := getLockableVersion(ownerID, bucket, key, versionID)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Retention == nil {
+		return nil, ErrObjectLockConfigNotFound
+	}
+	return meta.Retention, nil
+}
+
+// PutObjectRetention sets or, when ret is nil, removes the retention of a
+// version. Tightening is always allowed; loosening a governance retention
+// needs bypassGovernance and loosening a compliance retention is refused.
+func PutObjectRetention(ownerID string, bucket string, key string, versionID string, ret *ObjectRetention, bypassGovernance bool) error {
+	if ret != nil {
+		if err := ValidateRetention(ret); err != nil {
+			return err
+		}
+	}
+
+	return updateLockableVersion(ownerID, bucket, key, versionID, func(meta *ObjectMeta) error {
+		if loosensRetention(meta.Retention, ret, time.Now()) {
+			if meta.Retention.Mode == RetentionCompliance || !bypassGovernance {
+				return ErrObjectLocked
+			}
+		}
+		meta.Retention = ret
+		return nil
+	})
+}
+
+func GetObjectLegalHold(ownerID string, bucket string, key string, versionID string) (bool, error) {
+	meta, err := getLockableVersion(ownerID, bucket, key, versionID)
+	if err != nil {
+		return false, err
+	}
+	return meta.LegalHold, nil
+}
+
+func PutObjectLegalHold(ownerID string, bucket string, key string, versionID string, on bool) error {
+	return updateLockableVersion(ownerID, bucket, key, versionID, func(meta *ObjectMeta) error {
+		meta.LegalHold = on
+		return nil
+	})
+}
+
+// getLockableVersion loads the version that a retention or legal hold
+// request addresses: versionID, or the newest version when it is empty.
+func getLockableVersion(ownerID string, bucket string, key string, versionID string) (*ObjectMeta, error) {
+	return viewVersion(ownerID, bucket, func(txn *badger.Txn) (*ObjectMeta, bool, error) {
+		return lockableVersion(txn, bucket, key, versionID)
+	})
+}
+
+func updateLockableVersion(ownerID string, bucket string, key string, versionID string, update func(*ObjectMeta) error) error {
+	return updateVersion(ownerID, bucket, func(txn *badger.Txn) (*ObjectMeta, bool, error) {
+		return lockableVersion(txn, bucket, key, versionID)
+	}, update)
+}
+
+func lockableVersion(txn *badger.Txn, bucket string, key string, versionID string) (*ObjectMeta, bool, error) {
+	cfg, err := objectLockState(txn, bucket)
+	if err != nil {
+		return nil, false, err
+	}
+	if cfg == nil {
+		return nil, false, ErrObjectLockNotEnabled
+	}
+	return addressedVersion(txn, bucket, key, versionID)
+}
@@ -0,0 +1,166 @@
+package metadata
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIsLocked(t *testing.T) {
+	now := time.Now()
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		meta     ObjectMeta
+		bypass   bool
+		wantLock bool
+	}{
+		{"no lock", ObjectMeta{}, false, false},
+		{"legal hold", ObjectMeta{LegalHold: true}, false, true},
+		{"legal hold with bypass", ObjectMeta{LegalHold: true}, true, true},
+		{"governance", ObjectMeta{Retention: &ObjectRetention{Mode: RetentionGovernance, RetainUntil: future}}, false, true},
+		{"governance with bypass", ObjectMeta{Retention: &ObjectRetention{Mode: RetentionGovernance, RetainUntil: future}}, true, false},
+		{"compliance with bypass", ObjectMeta{Retention: &ObjectRetention{Mode: RetentionCompliance, RetainUntil: future}}, true, true},
+		{"expired compliance", ObjectMeta{Retention: &ObjectRetention{Mode: RetentionCompliance, RetainUntil: past}}, false, false},
+		{"expires now", ObjectMeta{Retention: &ObjectRetention{Mode: RetentionCompliance, RetainUntil: now}}, false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.meta.IsLocked(now, tt.bypass); got != tt.wantLock {
+			t.Errorf("%s: IsLocked = %v; want %v", tt.name, got, tt.wantLock)
+		}
+	}
+}
+
+func TestLoosensRetention(t *testing.T) {
+	now := time.Now()
+	gov := func(d time.Duration) *ObjectRetention {
+		return &ObjectRetention{Mode: RetentionGovernance, RetainUntil: now.Add(d)}
+	}
+	comp := func(d time.Duration) *ObjectRetention {
+		return &ObjectRetention{Mode: RetentionCompliance, RetainUntil: now.Add(d)}
+	}
+
+	tests := []struct {
+		name string
+		cur  *ObjectRetention
+		next *ObjectRetention
+		want bool
+	}{
+		{"set on unlocked", nil, gov(time.Hour), false},
+		{"remove", gov(time.Hour), nil, true},
+		{"remove expired", gov(-time.Hour), nil, false},
+		{"shorten", gov(2 * time.Hour), gov(time.Hour), true},
+		{"extend", gov(time.Hour), gov(2 * time.Hour), false},
+		{"governance to compliance", gov(time.Hour), comp(time.Hour), false},
+		{"compliance to governance", comp(time.Hour), gov(2 * time.Hour), true},
+		{"extend compliance", comp(time.Hour), comp(2 * time.Hour), false},
+	}
+	for _, tt := range tests {
+		if got := loosensRetention(tt.cur, tt.next, now); got != tt.want {
+			t.Errorf("%s: loosensRetention = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestObjectLockRefusals(t *testing.T) {
+	InitDB(t.TempDir())
+	defer CloseDB()
+	const owner, bucket = "owner", "locked"
+	if err := CreateBucket(owner, bucket, true); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+
+	err := PutBucketVersioning(owner, bucket, &BucketVersioning{Status: VersioningSuspended})
+	if !errors.Is(err, ErrInvalidBucketState) {
+		t.Errorf("suspending versioning: got %v; want ErrInvalidBucketState", err)
+	}
+
+	until := time.Now().Add(time.Hour)
+	gov := &ObjectMeta{Bucket: bucket, Key: "gov", LastModified: time.Now().UTC(),
+		Retention: &ObjectRetention{Mode: RetentionGovernance, RetainUntil: until}}
+	comp := &ObjectMeta{Bucket: bucket, Key: "comp", LastModified: time.Now().UTC(),
+		Retention: &ObjectRetention{Mode: RetentionCompliance, RetainUntil: until}}
+	held := &ObjectMeta{Bucket: bucket, Key: "held", LastModified: time.Now().UTC(), LegalHold: true}
+	for _, meta := range []*ObjectMeta{gov, comp, held} {
+		if _, err := PutObject(owner, meta); err != nil {
+			t.Fatalf("PutObject(%q): %v", meta.Key, err)
+		}
+	}
+
+	for _, meta := range []*ObjectMeta{gov, comp, held} {
+		if _, err := DeleteObjectVersion(owner, bucket, meta.Key, meta.VersionID, false); !errors.Is(err, ErrObjectLocked) {
+			t.Errorf("deleting %q: got %v; want ErrObjectLocked", meta.Key, err)
+		}
+	}
+	if _, err := DeleteObjectVersion(owner, bucket, "comp", comp.VersionID, true); !errors.Is(err, ErrObjectLocked) {
+		t.Errorf("deleting compliance with bypass: got %v; want ErrObjectLocked", err)
+	}
+	if _, err := DeleteObjectVersion(owner, bucket, "held", held.VersionID, true); !errors.Is(err, ErrObjectLocked) {
+		t.Errorf("deleting legal hold with bypass: got %v; want ErrObjectLocked", err)
+	}
+	if _, err := DeleteObjectVersion(owner, bucket, "gov", gov.VersionID, true); err != nil {
+		t.Errorf("deleting governance with bypass: %v", err)
+	}
+
+	// A plain delete only adds a marker and leaves the locked version.
+	if res, err := DeleteObject(owner, bucket, "comp"); err != nil || !res.DeleteMarker {
+		t.Errorf("DeleteObject(comp) = %+v, %v; want a delete marker", res, err)
+	}
+	if _, err := GetObjectVersion(owner, bucket, "comp", comp.VersionID); err != nil {
+		t.Errorf("locked version gone after DeleteObject: %v", err)
+	}
+}
+
+func TestMultipartObjectLock(t *testing.T) {
+	InitDB(t.TempDir())
+	defer CloseDB()
+	const owner = "owner"
+	if err := CreateBucket(owner, "plain", false); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	if err := CreateBucket(owner, "locked", true); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	err := PutObjectLockConfig(owner, "locked", &ObjectLockConfig{
+		Enabled:          true,
+		DefaultRetention: &DefaultRetention{Mode: RetentionGovernance, Days: 1},
+	})
+	if err != nil {
+		t.Fatalf("PutObjectLockConfig: %v", err)
+	}
+
+	until := time.Now().Add(time.Hour).UTC()
+	explicit := &ObjectRetention{Mode: RetentionCompliance, RetainUntil: until}
+	err = CreateMultipartUpload(owner, &MultipartUpload{Bucket: "plain", Key: "k", Retention: explicit})
+	if !errors.Is(err, ErrObjectLockNotEnabled) {
+		t.Errorf("retention on a bucket without object lock: got %v; want ErrObjectLockNotEnabled", err)
+	}
+
+	complete := func(upload *MultipartUpload) *ObjectMeta {
+		t.Helper()
+		if err := CreateMultipartUpload(owner, upload); err != nil {
+			t.Fatalf("CreateMultipartUpload: %v", err)
+		}
+		part := &PartMeta{Number: 1, BlobID: "b", Size: 1, ETag: "0cc175b9c0f1b6a831c399e269772661"}
+		if _, err := PutPart(owner, upload.Bucket, upload.Key, upload.UploadID, part); err != nil {
+			t.Fatalf("PutPart: %v", err)
+		}
+		res, err := CompleteMultipartUpload(owner, upload.Bucket, upload.Key, upload.UploadID,
+			[]CompletedPart{{Number: 1, ETag: part.ETag}})
+		if err != nil {
+			t.Fatalf("CompleteMultipartUpload: %v", err)
+		}
+		return res.Object
+	}
+
+	obj := complete(&MultipartUpload{Bucket: "locked", Key: "explicit", Retention: explicit, LegalHold: true})
+	if obj.Retention == nil || obj.Retention.Mode != RetentionCompliance || !obj.Retention.RetainUntil.Equal(until) || !obj.LegalHold {
+		t.Errorf("explicit lock: retention %+v, legal hold %v", obj.Retention, obj.LegalHold)
+	}
+	obj = complete(&MultipartUpload{Bucket: "locked", Key: "default"})
+	if obj.Retention == nil || obj.Retention.Mode != RetentionGovernance || obj.LegalHold {
+		t.Errorf("default lock: retention %+v, legal hold %v", obj.Retention, obj.LegalHold)
+	}
+}
@@ -0,0 +1,207 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const rewrapBatchSize = 1000
+
+// encryptedPrefixes are the key ranges holding records with a sealed key.
+var encryptedPrefixes = []string{"bucket/", "accesskey/"}
+
+// RewrapEncryption re-seals the data keys of every object version and
+// multipart upload, and the secrets of every access key, whose encryption
+// stale reports as out of date, storing what rewrap returns in its place.
+// Blobs are untouched: the data key stays the same, only its sealed form
+// changes. It is meant for the background worker, ignores ownership, and
+// returns how many records it updated. A record that fails is skipped and
+// the rest are still rewrapped; the failures are reported together.
+func RewrapEncryption(stale func(*ObjectEncryption) bool, rewrap func(*ObjectEncryption) (*ObjectEncryption, error)) (int, error) {
+	updated := 0
+	var errs []error
+	for _, prefix := range encryptedPrefixes {
+		n, err := rewrapPrefix([]byte(prefix), stale, rewrap)
+		updated += n
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return updated, errors.Join(errs...)
+}
+
+func rewrapPrefix(prefix []byte, stale func(*ObjectEncryption) bool, rewrap func(*ObjectEncryption) (*ObjectEncryption, error)) (int, error) {
+	updated, failed := 0, 0
+	var after []byte
+	for {
+		keys, err := staleEncryptionKeys(prefix, after, stale)
+		if err != nil {
+			return updated, err
+		}
+		for _, key := range keys {
+			// One transaction per record, so a busy key costs a retry on
+			// the next pass rather than the whole batch.
+			ok, err := rewrapRecord(key, stale, rewrap)
+			if errors.Is(err, badger.ErrConflict) {
+				continue
+			}
+			if err != nil {
+				// One record that cannot be rewrapped must not keep the
+				// others under an old key version.
+				log.Printf("rewrap %q error: %v", key, err)
+				failed++
+				continue
+			}
+			if ok {
+				updated++
+			}
+		}
+		if len(keys) < rewrapBatchSize {
+			break
+		}
+		after = keys[len(keys)-1]
+	}
+	if failed > 0 {
+		return updated, fmt.Errorf("rewrap %s: %d records failed", prefix, failed)
+	}
+	return updated, nil
+}
+
+// encryptedRecordKind tells which records carry a sealed key: objects and
+// versions hold ObjectMeta, uploads hold MultipartUpload, access keys hold
+// AccessKey.
+func encryptedRecordKind(key []byte) string {
+	if bytes.HasPrefix(key, []byte("accesskey/")) {
+		return "accesskey/"
+	}
+	rest, ok := bytes.CutPrefix(key, []byte("bucket/"))
+	if !ok {
+		return ""
+	}
+	i := bytes.IndexByte(rest, '/')
+	if i < 0 {
+		return ""
+	}
+	sub := string(rest[i+1:])
+	for _, kind := range []string{"objects/", "versions/", "uploads/"} {
+		if strings.HasPrefix(sub, kind) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// decodeEncryptedRecord decodes a record of the given kind. It returns the
+// record, its encryption, and a function that stores a replacement
+// encryption in the record. An access key's sealed secret is presented as
+// an ObjectEncryption so both are rewrapped alike.
+func decodeEncryptedRecord(kind string, val []byte) (any, *ObjectEncryption, func(*ObjectEncryption), error) {
+	switch kind {
+	case "accesskey/":
+		k := &AccessKey{}
+		if err := json.Unmarshal(val, k); err != nil {
+			return nil, nil, nil, err
+		}
+		enc := &ObjectEncryption{SealedKey: k.SealedSecret, KeyID: k.SecretKeyID, KeyVersion: k.SecretKeyVersion}
+		set := func(e *ObjectEncryption) {
+			k.SealedSecret, k.SecretKeyID, k.SecretKeyVersion = e.SealedKey, e.KeyID, e.KeyVersion
+		}
+		return k, enc, set, nil
+	case "uploads/":
+		upload := &MultipartUpload{}
+		if err := json.Unmarshal(val, upload); err != nil {
+			return nil, nil, nil, err
+		}
+		return upload, upload.Encryption, func(e *ObjectEncryption) { upload.Encryption = e }, nil
+	default:
+		meta := &ObjectMeta{}
+		if err := json.Unmarshal(val, meta); err != nil {
+			return nil, nil, nil, err
+		}
+		return meta, meta.Encryption, func(e *ObjectEncryption) { meta.Encryption = e }, nil
+	}
+}
+
+func staleEncryptionKeys(prefix []byte, after []byte, stale func(*ObjectEncryption) bool) ([][]byte, error) {
+	var keys [][]byte
+
+	err := DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		it.Seek(prefix)
+		if after != nil {
+			it.Seek(after)
+			if it.ValidForPrefix(prefix) && bytes.Equal(it.Item().Key(), after) {
+				it.Next()
+			}
+		}
+		for ; it.ValidForPrefix(prefix) && len(keys) < rewrapBatchSize; it.Next() {
+			item := it.Item()
+			kind := encryptedRecordKind(item.Key())
+			if kind == "" {
+				continue
+			}
+			var enc *ObjectEncryption
+			if err := item.Value(func(val []byte) error {
+				var err error
+				_, enc, _, err = decodeEncryptedRecord(kind, val)
+				return err
+			}); err != nil {
+				return err
+			}
+			if enc != nil && stale(enc) {
+				keys = append(keys, item.KeyCopy(nil))
+			}
+		}
+		return nil
+	})
+	return keys, err
+}
+
+func rewrapRecord(key []byte, stale func(*ObjectEncryption) bool, rewrap func(*ObjectEncryption) (*ObjectEncryption, error)) (bool, error) {
+	updated := false
+
+	err := DB.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec any
+		var enc *ObjectEncryption
+		var set func(*ObjectEncryption)
+		if err := item.Value(func(val []byte) error {
+			var err error
+			rec, enc, set, err = decodeEncryptedRecord(encryptedRecordKind(key), val)
+			return err
+		}); err != nil {
+			return err
+		}
+		if enc == nil || !stale(enc) {
+			return nil
+		}
+
+		next, err := rewrap(enc)
+		if err != nil {
+			return err
+		}
+		set(next)
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		updated = true
+		return txn.Set(key, data)
+	})
+	return updated, err
+}
@@ -0,0 +1,72 @@
+package metadata
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// S3's limits on object tags. Keys and values are counted in characters.
+const (
+	MaxObjectTags     = 10
+	MaxTagKeyLength   = 128
+	MaxTagValueLength = 256
+)
+
+// ValidateTags checks a tag set against S3's limits. Duplicate keys cannot
+// reach a map, so callers parsing a tag list must reject them first.
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > MaxObjectTags {
+		return ErrInvalidTag
+	}
+	for k, v := range tags {
+		if k == "" || utf8.RuneCountInString(k) > MaxTagKeyLength || utf8.RuneCountInString(v) > MaxTagValueLength {
+			return ErrInvalidTag
+		}
+		if !utf8.ValidString(k) || !utf8.ValidString(v) {
+			return ErrInvalidTag
+		}
+		// The aws: prefix is reserved for tags S3 sets itself.
+		if strings.HasPrefix(strings.ToLower(k), "aws:") {
+			return ErrInvalidTag
+		}
+	}
+	return nil
+}
+
+// GetObjectTagging returns the tags of versionID, or of the newest version
+// when it is empty, along with the ID of the version it read.
+func GetObjectTagging(ownerID string, bucket string, key string, versionID string) (map[string]string, string, error) {
+	meta, err := viewVersion(ownerID, bucket, func(txn *badger.Txn) (*ObjectMeta, bool, error) {
+		return addressedVersion(txn, bucket, key, versionID)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return meta.Tags, meta.VersionID, nil
+}
+
+// PutObjectTagging replaces the whole tag set of a version; nil removes
+// every tag. The version keeps its ID and modification time.
+func PutObjectTagging(ownerID string, bucket string, key string, versionID string, tags map[string]string) (string, error) {
+	if err := ValidateTags(tags); err != nil {
+		return "", err
+	}
+
+	var id string
+	err := updateVersion(ownerID, bucket, func(txn *badger.Txn) (*ObjectMeta, bool, error) {
+		return addressedVersion(txn, bucket, key, versionID)
+	}, func(meta *ObjectMeta) error {
+		meta.Tags = tags
+		if len(tags) == 0 {
+			meta.Tags = nil
+		}
+		id = meta.VersionID
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
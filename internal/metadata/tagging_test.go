@@ -0,0 +1,34 @@
+package metadata
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateTags(t *testing.T) {
+	tooMany := map[string]string{}
+	for i := range MaxObjectTags + 1 {
+		tooMany[string(rune('a'+i))] = "v"
+	}
+
+	tests := []struct {
+		name string
+		tags map[string]string
+		want error
+	}{
+		{"none", nil, nil},
+		{"ok", map[string]string{"class": "pii", "team": ""}, nil},
+		{"too many", tooMany, ErrInvalidTag},
+		{"empty key", map[string]string{"": "v"}, ErrInvalidTag},
+		{"long key", map[string]string{strings.Repeat("k", MaxTagKeyLength+1): "v"}, ErrInvalidTag},
+		{"long value", map[string]string{"k": strings.Repeat("v", MaxTagValueLength+1)}, ErrInvalidTag},
+		{"multibyte at limit", map[string]string{strings.Repeat("é", MaxTagKeyLength): "v"}, nil},
+		{"reserved prefix", map[string]string{"aws:owner": "v"}, ErrInvalidTag},
+	}
+	for _, tt := range tests {
+		if err := ValidateTags(tt.tags); !errors.Is(err, tt.want) {
+			t.Errorf("%s: ValidateTags = %v; want %v", tt.name, err, tt.want)
+		}
+	}
+}
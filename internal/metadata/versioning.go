@@ -0,0 +1,103 @@
+package metadata
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	VersioningEnabled   = "Enabled"
+	VersioningSuspended = "Suspended"
+
+	// NullVersionID names the single version a key has in a bucket that
+	// never had versioning, or that was written while versioning was
+	// suspended.
+	NullVersionID = "null"
+)
+
+type BucketVersioning struct {
+	Status string `json:"status"` // "", Enabled or Suspended
+}
+
+func GetBucketVersioning(ownerID string, name string) (*BucketVersioning, error) {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return nil, err
+	}
+
+	var cfg BucketVersioning
+	err := DB.View(func(txn *badger.Txn) error {
+		status, err := versioningState(txn, name)
+		cfg.Status = status
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func PutBucketVersioning(ownerID string, name string, cfg *BucketVersioning) error {
+	if err := HeadBucket(ownerID, name); err != nil {
+		return err
+	}
+
+	if cfg == nil || (cfg.Status != VersioningEnabled && cfg.Status != VersioningSuspended) {
+		return ErrInvalidVersioningConfig
+	}
+
+	key := []byte("bucket/" + name + "/versioning")
+
+	return DB.Update(func(txn *badger.Txn) error {
+		lock, err := objectLockState(txn, name)
+		if err != nil {
+			return err
+		}
+		// Object lock relies on every version being kept.
+		if lock != nil && cfg.Status != VersioningEnabled {
+			return ErrInvalidBucketState
+		}
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, data)
+	})
+}
+
+func versioningState(txn *badger.Txn, bucket string) (string, error) {
+	item, err := txn.Get([]byte("bucket/" + bucket + "/versioning"))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var cfg BucketVersioning
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &cfg)
+	}); err != nil {
+		return "", err
+	}
+	return cfg.Status, nil
+}
+
+// IsNullVersion reports whether id names the null version. Objects in a
+// bucket that never had versioning store an empty ID so that no version
+// header is sent for them.
+func IsNullVersion(id string) bool {
+	return id == "" || id == NullVersionID
+}
+
+// ValidVersionID reports whether id could name a version: the null version
+// or an ID made by newID.
+func ValidVersionID(id string) bool {
+	if IsNullVersion(id) {
+		return true
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && len(id) == 32
+}
@@ -36,12 +36,14 @@ func NewServer() *http.Server {
 	}
 
 	// Declare Server config
+	// Only the headers are time-boxed: object bodies can be many gigabytes,
+	// so whole-request read and write deadlines would cut off large
+	// uploads and downloads.
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", NewServer.port),
-		Handler:      api.RegisterRoutes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		Addr:              fmt.Sprintf(":%d", NewServer.port),
+		Handler:           api.RegisterRoutes(),
+		IdleTimeout:       time.Minute,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 
 	fmt.Println("Server running on port:", port)
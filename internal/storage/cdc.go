@@ -0,0 +1,98 @@
+package storage
+
+import "io"
+
+// Content-defined chunking cuts a stream where a rolling gear hash of its
+// content hits a mask, so an insertion early in a file only changes the
+// chunks around it. Cut points are normalised towards cdcAvgSize as in
+// FastCDC: a stricter mask applies before the average size and a looser
+// one after it.
+const (
+	cdcMinSize = 16 << 10
+	cdcAvgSize = 64 << 10
+	cdcMaxSize = 256 << 10
+
+	// The gear hash shifts left, so its top bits depend on the most bytes.
+	cdcMaskStrict = uint64(0xffffc00000000000) // 18 bits
+	cdcMaskLoose  = uint64(0xfffc000000000000) // 14 bits
+)
+
+// gearTable maps each byte to a pseudo-random value. Changing it changes
+// every cut point and so defeats deduplication against existing chunks;
+// it must stay fixed.
+var gearTable = func() [256]uint64 {
+	var t [256]uint64
+	// splitmix64 from a fixed seed.
+	x := uint64(0x646f7373)
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}()
+
+// cutPoint returns the length of the first chunk in data.
+func cutPoint(data []byte) int {
+	n := len(data)
+	if n <= cdcMinSize {
+		return n
+	}
+	n = min(n, cdcMaxSize)
+	normal := min(n, cdcAvgSize)
+
+	var h uint64
+	i := cdcMinSize
+	for ; i < normal; i++ {
+		h = h<<1 + gearTable[data[i]]
+		if h&cdcMaskStrict == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = h<<1 + gearTable[data[i]]
+		if h&cdcMaskLoose == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// chunker splits a stream into content-defined chunks.
+type chunker struct {
+	r          io.Reader
+	buf        []byte
+	start, end int
+	eof        bool
+}
+
+func newChunker(r io.Reader) *chunker {
+	return &chunker{r: r, buf: make([]byte, cdcMaxSize)}
+}
+
+// next returns the next chunk, which is only valid until the following
+// call, or io.EOF once the stream is exhausted.
+func (c *chunker) next() ([]byte, error) {
+	if c.end-c.start < cdcMaxSize && !c.eof {
+		copy(c.buf, c.buf[c.start:c.end])
+		c.end -= c.start
+		c.start = 0
+		n, err := io.ReadFull(c.r, c.buf[c.end:])
+		c.end += n
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			c.eof = true
+		case err != nil:
+			return nil, err
+		}
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	cut := cutPoint(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+cut]
+	c.start += cut
+	return chunk, nil
+}
@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressionZstd = "zstd"
+	CompressionS2   = "s2"
+
+	// Compressed blobs are a sequence of independently compressed frames
+	// of compressFrameSize plaintext bytes each (the last may be shorter),
+	// so a range read only decompresses the frames it touches.
+	compressFrameSize = 1 << 20
+)
+
+var ErrUnknownCompression = errors.New("unknown compression algorithm")
+
+// The zstd encoder and decoder are safe for concurrent EncodeAll and
+// DecodeAll calls, so one of each serves every request.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+)
+
+// ValidCompression reports whether algorithm names a supported codec.
+func ValidCompression(algorithm string) bool {
+	return algorithm == CompressionZstd || algorithm == CompressionS2
+}
+
+func compressFrame(algorithm string, dst []byte, frame []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(frame, dst), nil
+	case CompressionS2:
+		return s2.Encode(dst[:cap(dst)], frame), nil
+	default:
+		return nil, ErrUnknownCompression
+	}
+}
+
+func decompressFrame(algorithm string, dst []byte, frame []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionZstd:
+		return zstdDecoder.DecodeAll(frame, dst[:0])
+	case CompressionS2:
+		return s2.Decode(dst[:cap(dst)], frame)
+	default:
+		return nil, ErrUnknownCompression
+	}
+}
+
+// CompressReader compresses everything read from its source into frames.
+// Once drained, Size and Index describe what it produced.
+type CompressReader struct {
+	src       io.Reader
+	algorithm string
+	plain     []byte
+	buf       []byte // compressed frame not yet returned
+	off       int
+	size      int64
+	index     []int64
+	done      bool
+}
+
+func NewCompressReader(r io.Reader, algorithm string) (*CompressReader, error) {
+	if !ValidCompression(algorithm) {
+		return nil, ErrUnknownCompression
+	}
+	return &CompressReader{
+		src:       r,
+		algorithm: algorithm,
+		plain:     make([]byte, compressFrameSize),
+	}, nil
+}
+
+// Size returns the number of plaintext bytes compressed.
+func (c *CompressReader) Size() int64 {
+	return c.size
+}
+
+// Index returns the end offset of every compressed frame in the stream.
+func (c *CompressReader) Index() []int64 {
+	return c.index
+}
+
+func (c *CompressReader) Read(p []byte) (int, error) {
+	for c.off == len(c.buf) {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.buf[c.off:])
+	c.off += n
+	return n, nil
+}
+
+func (c *CompressReader) fill() error {
+	n, err := io.ReadFull(c.src, c.plain)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		c.done = true
+	case err != nil:
+		return err
+	}
+	c.buf = c.buf[:0]
+	c.off = 0
+	if n == 0 {
+		return nil
+	}
+	c.buf, err = compressFrame(c.algorithm, c.buf, c.plain[:n])
+	if err != nil {
+		return err
+	}
+	var end int64
+	if len(c.index) > 0 {
+		end = c.index[len(c.index)-1]
+	}
+	c.index = append(c.index, end+int64(len(c.buf)))
+	c.size += int64(n)
+	return nil
+}
+
+// OpenCompressed streams length plaintext bytes starting at offset from a
+// compressed stream of size plaintext bytes described by index. open reads
+// a byte range of the compressed stream, which lets the caller decrypt it
+// first.
+func OpenCompressed(open func(offset, length int64) (io.ReadCloser, error), algorithm string, index []int64, size int64, offset int64, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < 0 || offset+length > size {
+		return nil, ErrInvalidRange
+	}
+	if !ValidCompression(algorithm) {
+		return nil, ErrUnknownCompression
+	}
+	if length == 0 {
+		return io.NopCloser(eofReader{}), nil
+	}
+
+	first := offset / compressFrameSize
+	last := (offset + length - 1) / compressFrameSize
+	if last >= int64(len(index)) {
+		return nil, ErrInvalidRange
+	}
+	start := frameStart(index, first)
+	rc, err := open(start, index[last]-start)
+	if err != nil {
+		return nil, err
+	}
+	return &decompressReader{
+		src:       rc,
+		algorithm: algorithm,
+		index:     index,
+		frame:     first,
+		skip:      offset - first*compressFrameSize,
+		remain:    length,
+	}, nil
+}
+
+func frameStart(index []int64, frame int64) int64 {
+	if frame == 0 {
+		return 0
+	}
+	return index[frame-1]
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
+
+type decompressReader struct {
+	src       io.ReadCloser
+	algorithm string
+	index     []int64
+	frame     int64
+	skip      int64 // plaintext to drop from the first frame
+	remain    int64
+	compBuf   []byte
+	plainBuf  []byte
+	buf       []byte
+}
+
+func (d *decompressReader) Read(p []byte) (int, error) {
+	if d.remain == 0 {
+		return 0, io.EOF
+	}
+	if len(d.buf) == 0 {
+		if err := d.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf[:min(int64(len(d.buf)), d.remain)])
+	d.buf = d.buf[n:]
+	d.remain -= int64(n)
+	return n, nil
+}
+
+func (d *decompressReader) fill() error {
+	compLen := d.index[d.frame] - frameStart(d.index, d.frame)
+	if int64(cap(d.compBuf)) < compLen {
+		d.compBuf = make([]byte, compLen)
+	}
+	comp := d.compBuf[:compLen]
+	if _, err := io.ReadFull(d.src, comp); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if d.plainBuf == nil {
+		d.plainBuf = make([]byte, 0, compressFrameSize)
+	}
+	plain, err := decompressFrame(d.algorithm, d.plainBuf, comp)
+	if err != nil {
+		return err
+	}
+	if int64(len(plain)) <= d.skip {
+		return io.ErrUnexpectedEOF
+	}
+	d.frame++
+	d.buf = plain[d.skip:]
+	d.skip = 0
+	return nil
+}
+
+func (d *decompressReader) Close() error {
+	return d.src.Close()
+}
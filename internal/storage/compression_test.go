@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressedBlob(t *testing.T) {
+	b, err := NewFSBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSBackend: %v", err)
+	}
+
+	var sb strings.Builder
+	for i := 0; sb.Len() < 2*compressFrameSize+1000; i++ {
+		fmt.Fprintf(&sb, "2026-01-10T15:00:00Z INFO request %d served\n", i)
+	}
+	data := []byte(sb.String())
+	size := int64(len(data))
+
+	for _, algorithm := range []string{CompressionZstd, CompressionS2} {
+		for _, dataKey := range [][]byte{nil, NewDataKey()} {
+			name := algorithm
+			if dataKey != nil {
+				name += "+encrypted"
+			}
+			t.Run(name, func(t *testing.T) {
+				id := NewBlobID()
+				cr, err := NewCompressReader(bytes.NewReader(data), algorithm)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if dataKey != nil {
+					_, err = PutEncrypted(b, id, cr, dataKey)
+				} else {
+					_, err = b.Put(id, cr)
+				}
+				if err != nil {
+					t.Fatalf("Put: %v", err)
+				}
+				if cr.Size() != size {
+					t.Errorf("Size = %d; want %d", cr.Size(), size)
+				}
+				index := cr.Index()
+				if len(index) != 3 {
+					t.Fatalf("index has %d frames; want 3", len(index))
+				}
+				if stored := index[len(index)-1]; stored*5 > size {
+					t.Errorf("log text only compressed to %d of %d bytes", stored, size)
+				}
+
+				open := func(offset, length int64) (io.ReadCloser, error) {
+					if dataKey != nil {
+						return GetEncrypted(b, id, dataKey, index[len(index)-1], offset, length)
+					}
+					return b.Get(id, offset, length)
+				}
+				tests := []struct {
+					offset, length int64
+				}{
+					{0, size},
+					{0, 10},
+					{compressFrameSize - 5, 10},
+					{compressFrameSize, compressFrameSize},
+					{size - 1, 1},
+					{size, 0},
+				}
+				for _, tt := range tests {
+					rc, err := OpenCompressed(open, algorithm, index, size, tt.offset, tt.length)
+					if err != nil {
+						t.Fatalf("OpenCompressed(%d, %d): %v", tt.offset, tt.length, err)
+					}
+					got, err := io.ReadAll(rc)
+					rc.Close()
+					if err != nil {
+						t.Fatalf("ReadAll(%d, %d): %v", tt.offset, tt.length, err)
+					}
+					if !bytes.Equal(got, data[tt.offset:tt.offset+tt.length]) {
+						t.Errorf("OpenCompressed(%d, %d) returned the wrong bytes", tt.offset, tt.length)
+					}
+				}
+			})
+		}
+	}
+}
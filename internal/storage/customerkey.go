@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+)
+
+// CustomerKeySaltSize is the size of the random salt kept with each SSE-C
+// object. The customer key itself is never stored.
+const CustomerKeySaltSize = 32
+
+func NewCustomerKeySalt() []byte {
+	salt := make([]byte, CustomerKeySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	return salt
+}
+
+// CustomerDataKey derives the data key of an SSE-C object from the key the
+// customer supplied and the object's salt.
+func CustomerDataKey(customerKey []byte, salt []byte) []byte {
+	return customerKeyMAC(customerKey, "doss sse-c data key", salt)
+}
+
+// CustomerKeyFingerprint identifies a customer key without revealing it, so
+// later requests can be checked against the key the object was written
+// with.
+func CustomerKeyFingerprint(customerKey []byte, salt []byte) []byte {
+	return customerKeyMAC(customerKey, "doss sse-c fingerprint", salt)
+}
+
+// CustomerKeyMatches compares in constant time.
+func CustomerKeyMatches(customerKey []byte, salt []byte, fingerprint []byte) bool {
+	return hmac.Equal(CustomerKeyFingerprint(customerKey, salt), fingerprint)
+}
+
+func customerKeyMAC(customerKey []byte, label string, salt []byte) []byte {
+	mac := hmac.New(sha256.New, customerKey)
+	mac.Write([]byte(label + "\x00"))
+	mac.Write(salt)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCustomerKey(t *testing.T) {
+	key := NewDataKey()
+	salt := NewCustomerKeySalt()
+	fp := CustomerKeyFingerprint(key, salt)
+
+	if !CustomerKeyMatches(key, salt, fp) {
+		t.Error("key does not match its own fingerprint")
+	}
+	if CustomerKeyMatches(NewDataKey(), salt, fp) {
+		t.Error("a different key matched the fingerprint")
+	}
+	if CustomerKeyMatches(key, NewCustomerKeySalt(), fp) {
+		t.Error("the key matched under a different salt")
+	}
+	if bytes.Equal(CustomerDataKey(key, salt), fp) {
+		t.Error("data key equals the stored fingerprint")
+	}
+}
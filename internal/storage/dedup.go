@@ -0,0 +1,474 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// DedupBackend splits blobs into content-defined chunks and stores each
+// distinct chunk once, named by its SHA-256. A blob is a manifest listing
+// its chunks. Manifests and chunk reference counts live in Badger next to
+// the object metadata; chunk files are removed when their count drops to
+// zero.
+//
+// Encrypted blobs do not deduplicate, since every object has its own key.
+type DedupBackend struct {
+	root string
+	db   *badger.DB
+
+	// mu serialises reference-count updates. pending counts the uploads
+	// that have written or found a chunk but not yet committed their
+	// reference to it, so a concurrent delete does not remove the file
+	// from under them.
+	mu      sync.Mutex
+	pending map[string]int
+}
+
+type dedupManifest struct {
+	Size    int64        `json:"size"`
+	Created time.Time    `json:"created"`
+	Chunks  []dedupChunk `json:"chunks"`
+}
+
+type dedupChunk struct {
+	Hash string `json:"h"`
+	Size int64  `json:"n"`
+}
+
+func InitDedup(root string, db *badger.DB) {
+	backend, err := NewDedupBackend(root, db)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	Blobs = backend
+}
+
+func NewDedupBackend(root string, db *badger.DB) (*DedupBackend, error) {
+	tmp := filepath.Join(root, tmpDirName)
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return nil, err
+	}
+	return &DedupBackend{root: root, db: db, pending: make(map[string]int)}, nil
+}
+
+func manifestKey(id string) []byte {
+	return []byte("dedup/blobs/" + id)
+}
+
+func chunkRefKey(hash string) []byte {
+	return []byte("dedup/chunks/" + hash)
+}
+
+func (b *DedupBackend) chunkPath(hash string) string {
+	return filepath.Join(b.root, hash[0:2], hash[2:4], hash)
+}
+
+func (b *DedupBackend) Put(id string, r io.Reader) (int64, error) {
+	if !validBlobID(id) {
+		return 0, ErrInvalidBlobID
+	}
+
+	m := dedupManifest{Created: time.Now().UTC()}
+	refs := make(map[string]int64)
+	defer b.release(refs)
+
+	c := newChunker(r)
+	for {
+		data, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		if refs[hash] == 0 {
+			b.hold(hash)
+		}
+		refs[hash]++
+		if err := b.writeChunk(hash, data); err != nil {
+			return 0, err
+		}
+		m.Chunks = append(m.Chunks, dedupChunk{Hash: hash, Size: int64(len(data))})
+		m.Size += int64(len(data))
+	}
+
+	manifest, err := json.Marshal(&m)
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// References are added before the manifest is written and dropped
+	// after it is deleted, so an interrupted update can only leave counts
+	// too high. That leaks space but never loses a chunk still in use.
+	if err := b.addRefs(refs); err != nil {
+		return 0, err
+	}
+	var replaced *dedupManifest
+	err = b.db.Update(func(txn *badger.Txn) error {
+		var err error
+		replaced, err = getManifest(txn, id)
+		if err != nil && !errors.Is(err, ErrBlobNotFound) {
+			return err
+		}
+		return txn.Set(manifestKey(id), manifest)
+	})
+	if err != nil {
+		b.dropRefs(refs)
+		return 0, err
+	}
+	if replaced != nil {
+		if err := b.dropRefs(manifestRefs(replaced)); err != nil {
+			log.Printf("dedup: release chunks of %s error: %v", id, err)
+		}
+	}
+	return m.Size, nil
+}
+
+func (b *DedupBackend) Get(id string, offset int64, length int64) (io.ReadCloser, error) {
+	if !validBlobID(id) {
+		return nil, ErrInvalidBlobID
+	}
+
+	var m *dedupManifest
+	err := b.db.View(func(txn *badger.Txn) error {
+		var err error
+		m, err = getManifest(txn, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if offset < 0 || offset > m.Size {
+		return nil, ErrInvalidRange
+	}
+	if length < 0 || offset+length > m.Size {
+		length = m.Size - offset
+	}
+
+	chunks := m.Chunks
+	for len(chunks) > 0 && offset >= chunks[0].Size {
+		offset -= chunks[0].Size
+		chunks = chunks[1:]
+	}
+	return &chunkReader{b: b, chunks: chunks, skip: offset, remain: length}, nil
+}
+
+func (b *DedupBackend) Delete(id string) error {
+	if !validBlobID(id) {
+		return ErrInvalidBlobID
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var m *dedupManifest
+	err := b.db.Update(func(txn *badger.Txn) error {
+		var err error
+		m, err = getManifest(txn, id)
+		if err != nil {
+			return err
+		}
+		return txn.Delete(manifestKey(id))
+	})
+	if err != nil {
+		return err
+	}
+	return b.dropRefs(manifestRefs(m))
+}
+
+func (b *DedupBackend) Stat(id string) (*BlobInfo, error) {
+	if !validBlobID(id) {
+		return nil, ErrInvalidBlobID
+	}
+
+	var m *dedupManifest
+	err := b.db.View(func(txn *badger.Txn) error {
+		var err error
+		m, err = getManifest(txn, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BlobInfo{ID: id, Size: m.Size, ModTime: m.Created}, nil
+}
+
+func getManifest(txn *badger.Txn, id string) (*dedupManifest, error) {
+	item, err := txn.Get(manifestKey(id))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m dedupManifest
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &m)
+	}); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func manifestRefs(m *dedupManifest) map[string]int64 {
+	refs := make(map[string]int64)
+	for _, c := range m.Chunks {
+		refs[c.Hash]++
+	}
+	return refs
+}
+
+// writeChunk stores a chunk unless a copy is already on disk. Chunk files
+// are immutable and named by content, so an existing one is as good as a
+// new one.
+func (b *DedupBackend) writeChunk(hash string, data []byte) error {
+	dst := b.chunkPath(hash)
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+
+	f, err := os.CreateTemp(filepath.Join(b.root, tmpDirName), hash+"-*")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			f.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(dst)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, dst); err != nil {
+		return err
+	}
+	committed = true
+	return syncDir(dir)
+}
+
+func (b *DedupBackend) hold(hash string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[hash]++
+}
+
+// release ends an upload's hold on its chunks and removes any that ended
+// up unreferenced because the upload failed.
+func (b *DedupBackend) release(refs map[string]int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var orphans []string
+	for hash := range refs {
+		b.pending[hash]--
+		if b.pending[hash] == 0 {
+			delete(b.pending, hash)
+			orphans = append(orphans, hash)
+		}
+	}
+	if err := b.removeUnreferenced(orphans); err != nil {
+		log.Printf("dedup: remove chunks error: %v", err)
+	}
+}
+
+// addRefs and dropRefs adjust chunk reference counts. A large blob can
+// touch more chunks than fit in one Badger transaction, so the updates are
+// committed in as many as needed. Callers hold b.mu.
+func (b *DedupBackend) addRefs(refs map[string]int64) error {
+	_, err := b.adjustRefs(refs, 1)
+	return err
+}
+
+func (b *DedupBackend) dropRefs(refs map[string]int64) error {
+	freed, err := b.adjustRefs(refs, -1)
+	if err != nil {
+		return err
+	}
+	return b.removeUnreferenced(freed)
+}
+
+func (b *DedupBackend) adjustRefs(refs map[string]int64, sign int64) ([]string, error) {
+	var freed []string
+	txn := b.db.NewTransaction(true)
+	defer func() { txn.Discard() }()
+
+	for hash, n := range refs {
+		count, err := getRefCount(txn, hash)
+		if err != nil {
+			return nil, err
+		}
+		count = max(count+sign*n, 0)
+
+		set := func() error {
+			if count == 0 {
+				return txn.Delete(chunkRefKey(hash))
+			}
+			return txn.Set(chunkRefKey(hash), binary.BigEndian.AppendUint64(nil, uint64(count)))
+		}
+		err = set()
+		if errors.Is(err, badger.ErrTxnTooBig) {
+			if err := txn.Commit(); err != nil {
+				return nil, err
+			}
+			txn = b.db.NewTransaction(true)
+			err = set()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			freed = append(freed, hash)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, err
+	}
+	return freed, nil
+}
+
+func getRefCount(txn *badger.Txn, hash string) (int64, error) {
+	item, err := txn.Get(chunkRefKey(hash))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = item.Value(func(val []byte) error {
+		if len(val) != 8 {
+			return errors.New("dedup: corrupt chunk reference count")
+		}
+		count = int64(binary.BigEndian.Uint64(val))
+		return nil
+	})
+	return count, err
+}
+
+// removeUnreferenced deletes the chunk files among hashes that no blob
+// references and no upload is holding. Callers hold b.mu.
+func (b *DedupBackend) removeUnreferenced(hashes []string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	return b.db.View(func(txn *badger.Txn) error {
+		for _, hash := range hashes {
+			if b.pending[hash] > 0 {
+				continue
+			}
+			count, err := getRefCount(txn, hash)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			err = os.Remove(b.chunkPath(hash))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// chunkReader streams a byte range of a blob, opening one chunk file at a
+// time.
+type chunkReader struct {
+	b      *DedupBackend
+	chunks []dedupChunk
+	skip   int64
+	remain int64
+	cur    io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for r.remain > 0 {
+		if r.cur == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.ErrUnexpectedEOF
+			}
+			rc, err := r.open(r.chunks[0])
+			if err != nil {
+				return 0, err
+			}
+			r.chunks = r.chunks[1:]
+			r.cur = rc
+		}
+		n, err := r.cur.Read(p[:min(int64(len(p)), r.remain)])
+		r.remain -= int64(n)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, io.EOF
+}
+
+func (r *chunkReader) open(c dedupChunk) (io.ReadCloser, error) {
+	f, err := os.Open(r.b.chunkPath(c.Hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.skip > 0 {
+		if _, err := f.Seek(r.skip, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		r.skip = 0
+	}
+	return f, nil
+}
+
+func (r *chunkReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
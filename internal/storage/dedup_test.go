@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func countChunkFiles(t *testing.T, root string) int {
+	t.Helper()
+	n := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == tmpDirName {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkDir: %v", err)
+	}
+	return n
+}
+
+func TestDedupBackend(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions(t.TempDir()).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("badger.Open: %v", err)
+	}
+	defer db.Close()
+	root := t.TempDir()
+	b, err := NewDedupBackend(root, db)
+	if err != nil {
+		t.Fatalf("NewDedupBackend: %v", err)
+	}
+
+	base := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(base)
+	// A near-identical build: a few bytes inserted early on.
+	variant := append(append(append([]byte{}, base[:100_000]...), "patched"...), base[100_000:]...)
+
+	a, v := NewBlobID(), NewBlobID()
+	if n, err := b.Put(a, bytes.NewReader(base)); err != nil || n != int64(len(base)) {
+		t.Fatalf("Put base = %d, %v", n, err)
+	}
+	alone := countChunkFiles(t, root)
+	if _, err := b.Put(v, bytes.NewReader(variant)); err != nil {
+		t.Fatalf("Put variant: %v", err)
+	}
+	both := countChunkFiles(t, root)
+	if added := both - alone; added*10 > alone {
+		t.Errorf("variant added %d chunks to the %d of the base; want only a few", added, alone)
+	}
+
+	tests := []struct {
+		offset, length int64
+	}{
+		{0, int64(len(variant))},
+		{99_990, 20},
+		{cdcMaxSize - 1, 3 * cdcMaxSize},
+		{int64(len(variant)) - 1, 1},
+		{int64(len(variant)), 0},
+	}
+	for _, tt := range tests {
+		rc, err := b.Get(v, tt.offset, tt.length)
+		if err != nil {
+			t.Fatalf("Get(%d, %d): %v", tt.offset, tt.length, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("ReadAll(%d, %d): %v", tt.offset, tt.length, err)
+		}
+		if !bytes.Equal(got, variant[tt.offset:tt.offset+tt.length]) {
+			t.Errorf("Get(%d, %d) returned the wrong bytes", tt.offset, tt.length)
+		}
+	}
+
+	// Deleting the base keeps every chunk the variant still needs.
+	if err := b.Delete(a); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	rc, err := b.Get(v, 0, -1)
+	if err != nil {
+		t.Fatalf("Get after Delete: %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(got, variant) {
+		t.Errorf("variant damaged by deleting the base: %v", err)
+	}
+
+	if err := b.Delete(v); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if n := countChunkFiles(t, root); n != 0 {
+		t.Errorf("%d chunk files left after deleting every blob", n)
+	}
+	if _, err := b.Stat(v); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Stat after Delete: got %v; want ErrBlobNotFound", err)
+	}
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek([]byte("dedup/")); it.ValidForPrefix([]byte("dedup/")); it.Next() {
+			t.Errorf("left behind key %q", it.Item().Key())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// DataKeySize is the size of a per-object AES-256 data key.
+	DataKeySize = 32
+
+	// Encrypted blobs are sealed as a sequence of fixed-size AES-256-GCM
+	// packages, so a range read only decrypts the packages it touches.
+	encPackageSize = 64 << 10
+	encTagSize     = 16
+	encSealedSize  = encPackageSize + encTagSize
+)
+
+var ErrDecrypt = errors.New("blob decryption failed")
+
+// NewDataKey returns a fresh random data key.
+func NewDataKey() []byte {
+	key := make([]byte, DataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// blobCipher derives a key for one blob from the object's data key. The
+// parts of a multipart upload share a data key but never a blob key, so
+// package nonces, which restart at zero in every blob, are never reused.
+func blobCipher(dataKey []byte, id string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write([]byte("doss blob key\x00" + id))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func packageNonce(index int64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], uint64(index))
+	return nonce
+}
+
+// EncryptedSize returns the stored size of a blob holding size plaintext
+// bytes.
+func EncryptedSize(size int64) int64 {
+	packages := (size + encPackageSize - 1) / encPackageSize
+	return size + packages*encTagSize
+}
+
+// PutEncrypted stores r under id, encrypted with a key derived from dataKey,
+// and returns the number of plaintext bytes written.
+func PutEncrypted(b Backend, id string, r io.Reader, dataKey []byte) (int64, error) {
+	aead, err := blobCipher(dataKey, id)
+	if err != nil {
+		return 0, err
+	}
+	er := &encryptReader{src: r, aead: aead, buf: make([]byte, 0, encSealedSize)}
+	if _, err := b.Put(id, er); err != nil {
+		return 0, err
+	}
+	return er.plain, nil
+}
+
+type encryptReader struct {
+	src   io.Reader
+	aead  cipher.AEAD
+	buf   []byte // sealed package not yet returned
+	off   int
+	index int64
+	plain int64
+	done  bool
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	if e.off == len(e.buf) {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.fill(); err != nil {
+			return 0, err
+		}
+		if e.off == len(e.buf) {
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, e.buf[e.off:])
+	e.off += n
+	return n, nil
+}
+
+func (e *encryptReader) fill() error {
+	plain := e.buf[:encPackageSize]
+	n, err := io.ReadFull(e.src, plain)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		e.done = true
+	case err != nil:
+		return err
+	}
+	e.buf = e.buf[:0]
+	e.off = 0
+	if n == 0 {
+		return nil
+	}
+	e.buf = e.aead.Seal(e.buf, packageNonce(e.index), plain[:n], nil)
+	e.index++
+	e.plain += int64(n)
+	return nil
+}
+
+// GetEncrypted streams length plaintext bytes starting at offset from a
+// blob written by PutEncrypted. size is the plaintext size of the blob.
+func GetEncrypted(b Backend, id string, dataKey []byte, size int64, offset int64, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < 0 || offset+length > size {
+		return nil, ErrInvalidRange
+	}
+	aead, err := blobCipher(dataKey, id)
+	if err != nil {
+		return nil, err
+	}
+
+	first := offset / encPackageSize
+	last := first
+	if length > 0 {
+		last = (offset + length - 1) / encPackageSize
+	}
+	start := first * encSealedSize
+	end := min(EncryptedSize(size), (last+1)*encSealedSize)
+
+	rc, err := b.Get(id, start, end-start)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		src:    rc,
+		aead:   aead,
+		index:  first,
+		size:   size,
+		skip:   offset - first*encPackageSize,
+		remain: length,
+		sealed: make([]byte, encSealedSize),
+	}, nil
+}
+
+type decryptReader struct {
+	src    io.ReadCloser
+	aead   cipher.AEAD
+	index  int64
+	size   int64
+	skip   int64 // plaintext to drop from the first package
+	remain int64
+	sealed []byte
+	buf    []byte
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	if d.remain == 0 {
+		return 0, io.EOF
+	}
+	if len(d.buf) == 0 {
+		if err := d.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf[:min(int64(len(d.buf)), d.remain)])
+	d.buf = d.buf[n:]
+	d.remain -= int64(n)
+	return n, nil
+}
+
+func (d *decryptReader) fill() error {
+	plainLen := min(int64(encPackageSize), d.size-d.index*encPackageSize)
+	sealed := d.sealed[:plainLen+encTagSize]
+	if _, err := io.ReadFull(d.src, sealed); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	plain, err := d.aead.Open(sealed[:0], packageNonce(d.index), sealed, nil)
+	if err != nil {
+		return ErrDecrypt
+	}
+	d.index++
+	d.buf = plain[d.skip:]
+	d.skip = 0
+	return nil
+}
+
+func (d *decryptReader) Close() error {
+	return d.src.Close()
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestEncryptedBlob(t *testing.T) {
+	b, err := NewFSBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFSBackend: %v", err)
+	}
+
+	data := make([]byte, 2*encPackageSize+100)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(data))
+	key := NewDataKey()
+	id := NewBlobID()
+
+	n, err := PutEncrypted(b, id, bytes.NewReader(data), key)
+	if err != nil {
+		t.Fatalf("PutEncrypted: %v", err)
+	}
+	if n != size {
+		t.Errorf("PutEncrypted wrote %d plaintext bytes; want %d", n, size)
+	}
+	info, err := b.Stat(id)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != EncryptedSize(size) {
+		t.Errorf("stored size = %d; want %d", info.Size, EncryptedSize(size))
+	}
+
+	tests := []struct {
+		offset, length int64
+	}{
+		{0, size},
+		{0, 10},
+		{encPackageSize - 5, 10},
+		{encPackageSize, encPackageSize},
+		{size - 1, 1},
+		{size, 0},
+	}
+	for _, tt := range tests {
+		rc, err := GetEncrypted(b, id, key, size, tt.offset, tt.length)
+		if err != nil {
+			t.Fatalf("GetEncrypted(%d, %d): %v", tt.offset, tt.length, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("ReadAll(%d, %d): %v", tt.offset, tt.length, err)
+		}
+		if !bytes.Equal(got, data[tt.offset:tt.offset+tt.length]) {
+			t.Errorf("GetEncrypted(%d, %d) returned the wrong bytes", tt.offset, tt.length)
+		}
+	}
+
+	rc, err := GetEncrypted(b, id, NewDataKey(), size, 0, size)
+	if err != nil {
+		t.Fatalf("GetEncrypted with wrong key: %v", err)
+	}
+	if _, err := io.ReadAll(rc); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("read with wrong key: got %v; want ErrDecrypt", err)
+	}
+	rc.Close()
+}
@@ -0,0 +1,735 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+const (
+	// Blobs are erasure coded in blocks of erasureBlockSize bytes, each
+	// split into data shards plus parity shards of the same length.
+	erasureBlockSize = 1 << 20
+
+	shardHeaderSize = 40
+	shardSumSize    = 4
+)
+
+var (
+	shardMagic = [8]byte{'D', 'O', 'S', 'S', 'E', 'C', '0', '1'}
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+	ErrTooFewDrives = errors.New("not enough healthy drives")
+)
+
+// ErasureBackend stripes every blob over several drives with Reed-Solomon
+// coding, so a blob stays readable with up to parity drives lost. Each
+// drive holds one shard file per blob: a header describing the stripe,
+// then one frame per block, each followed by its CRC-32C so bit rot is
+// caught on read.
+//
+// The order of drives must not change between runs; shard i of a blob is
+// always looked for on the same drive.
+type ErasureBackend struct {
+	drives []string
+	data   int
+	parity int
+
+	encMu    sync.Mutex
+	encoders map[[2]int]reedsolomon.Encoder
+
+	locks [64]sync.Mutex
+}
+
+// shardHeader is the first shardHeaderSize bytes of every shard file.
+type shardHeader struct {
+	data, parity int
+	index        int
+	blockSize    int64
+	size         int64
+}
+
+func InitErasure(drives []string, parity int) {
+	backend, err := NewErasureBackend(drives, parity)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	Blobs = backend
+}
+
+func NewErasureBackend(drives []string, parity int) (*ErasureBackend, error) {
+	data := len(drives) - parity
+	if parity < 1 || data < 1 || data < parity {
+		return nil, fmt.Errorf("erasure coding needs at least as many data as parity drives; got %d drives with %d parity", len(drives), parity)
+	}
+	for _, drive := range drives {
+		tmp := filepath.Join(drive, tmpDirName)
+		if err := os.RemoveAll(tmp); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(tmp, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	b := &ErasureBackend{
+		drives:   drives,
+		data:     data,
+		parity:   parity,
+		encoders: make(map[[2]int]reedsolomon.Encoder),
+	}
+	if _, err := b.encoder(data, parity); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *ErasureBackend) encoder(data int, parity int) (reedsolomon.Encoder, error) {
+	b.encMu.Lock()
+	defer b.encMu.Unlock()
+	if enc, ok := b.encoders[[2]int{data, parity}]; ok {
+		return enc, nil
+	}
+	enc, err := reedsolomon.New(data, parity)
+	if err != nil {
+		return nil, err
+	}
+	b.encoders[[2]int{data, parity}] = enc
+	return enc, nil
+}
+
+// writeQuorum is how many shards a Put must store to succeed. Missing
+// shards are restored by Heal.
+func (b *ErasureBackend) writeQuorum() int {
+	if b.data == b.parity {
+		return b.data + 1
+	}
+	return b.data
+}
+
+// shardDrive spreads the first shard of different blobs over different
+// drives, so parity does not always land on the same disks.
+func (b *ErasureBackend) shardDrive(id string, index int) string {
+	start := int(crc32.ChecksumIEEE([]byte(id)) % uint32(len(b.drives)))
+	return b.drives[(start+index)%len(b.drives)]
+}
+
+func (b *ErasureBackend) shardPath(id string, index int) string {
+	return filepath.Join(b.shardDrive(id, index), id[0:2], id[2:4], id)
+}
+
+func shardLen(blockLen int64, data int) int64 {
+	return (blockLen + int64(data) - 1) / int64(data)
+}
+
+// frameOffset is where block n starts in a shard file. Every block but the
+// last is full, so the position follows from the geometry alone.
+func (h *shardHeader) frameOffset(n int64) int64 {
+	return shardHeaderSize + n*(shardLen(h.blockSize, h.data)+shardSumSize)
+}
+
+func (h *shardHeader) blockLen(n int64) int64 {
+	return min(h.blockSize, h.size-n*h.blockSize)
+}
+
+func (h *shardHeader) blocks() int64 {
+	return (h.size + h.blockSize - 1) / h.blockSize
+}
+
+func (h *shardHeader) marshal() []byte {
+	buf := make([]byte, shardHeaderSize)
+	copy(buf, shardMagic[:])
+	binary.BigEndian.PutUint16(buf[8:], uint16(h.data))
+	binary.BigEndian.PutUint16(buf[10:], uint16(h.parity))
+	binary.BigEndian.PutUint16(buf[12:], uint16(h.index))
+	binary.BigEndian.PutUint32(buf[16:], uint32(h.blockSize))
+	binary.BigEndian.PutUint64(buf[24:], uint64(h.size))
+	binary.BigEndian.PutUint32(buf[32:], crc32.Checksum(buf[:32], castagnoli))
+	return buf
+}
+
+func parseShardHeader(buf []byte) (*shardHeader, bool) {
+	if len(buf) != shardHeaderSize || [8]byte(buf[:8]) != shardMagic {
+		return nil, false
+	}
+	if binary.BigEndian.Uint32(buf[32:]) != crc32.Checksum(buf[:32], castagnoli) {
+		return nil, false
+	}
+	h := &shardHeader{
+		data:      int(binary.BigEndian.Uint16(buf[8:])),
+		parity:    int(binary.BigEndian.Uint16(buf[10:])),
+		index:     int(binary.BigEndian.Uint16(buf[12:])),
+		blockSize: int64(binary.BigEndian.Uint32(buf[16:])),
+		size:      int64(binary.BigEndian.Uint64(buf[24:])),
+	}
+	if h.data < 1 || h.parity < 1 || h.index >= h.data+h.parity || h.blockSize < 1 || h.size < 0 {
+		return nil, false
+	}
+	return h, true
+}
+
+func (b *ErasureBackend) Put(id string, r io.Reader) (int64, error) {
+	if !validBlobID(id) {
+		return 0, ErrInvalidBlobID
+	}
+	enc, err := b.encoder(b.data, b.parity)
+	if err != nil {
+		return 0, err
+	}
+	total := b.data + b.parity
+
+	// A shard whose drive fails is dropped and the write carries on as
+	// long as a quorum is left.
+	files := make([]*os.File, total)
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+				os.Remove(f.Name())
+			}
+		}
+	}()
+	live := 0
+	drop := func(i int, err error) {
+		log.Printf("erasure: blob %s shard %d on %s: %v", id, i, b.shardDrive(id, i), err)
+		files[i].Close()
+		os.Remove(files[i].Name())
+		files[i] = nil
+		live--
+		// A shard of an earlier blob under this ID must not be mixed
+		// with the new ones.
+		os.Remove(b.shardPath(id, i))
+	}
+	for i := range files {
+		f, err := os.CreateTemp(filepath.Join(b.shardDrive(id, i), tmpDirName), id+"-*")
+		if err != nil {
+			log.Printf("erasure: blob %s shard %d on %s: %v", id, i, b.shardDrive(id, i), err)
+			continue
+		}
+		files[i] = f
+		live++
+	}
+	if live < b.writeQuorum() {
+		return 0, ErrTooFewDrives
+	}
+
+	block := make([]byte, erasureBlockSize)
+	fullShard := shardLen(erasureBlockSize, b.data)
+	shards := make([][]byte, total)
+	for i := range shards {
+		shards[i] = make([]byte, fullShard)
+	}
+	frame := make([]byte, 0, fullShard+shardSumSize)
+
+	var size int64
+	for pos := int64(shardHeaderSize); ; {
+		n, err := io.ReadFull(r, block)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		if n == 0 {
+			break
+		}
+		size += int64(n)
+
+		sl := shardLen(int64(n), b.data)
+		for i := range shards {
+			shards[i] = shards[i][:sl]
+			clear(shards[i])
+			if i < b.data {
+				from := min(int64(i)*sl, int64(n))
+				copy(shards[i], block[from:min(from+sl, int64(n))])
+			}
+		}
+		if err := enc.Encode(shards); err != nil {
+			return 0, err
+		}
+		for i, f := range files {
+			if f == nil {
+				continue
+			}
+			frame = binary.BigEndian.AppendUint32(append(frame[:0], shards[i]...), crc32.Checksum(shards[i], castagnoli))
+			if _, err := f.WriteAt(frame, pos); err != nil {
+				drop(i, err)
+			}
+		}
+		if live < b.writeQuorum() {
+			return 0, ErrTooFewDrives
+		}
+		pos += int64(len(frame))
+		if n < len(block) {
+			break
+		}
+	}
+
+	lock := b.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+	for i, f := range files {
+		if f == nil {
+			continue
+		}
+		h := shardHeader{data: b.data, parity: b.parity, index: i, blockSize: erasureBlockSize, size: size}
+		if err := commitShard(f, h.marshal(), b.shardPath(id, i)); err != nil {
+			drop(i, err)
+			continue
+		}
+		files[i] = nil
+	}
+	if live < b.writeQuorum() {
+		// Shards already renamed into place would be read as a complete
+		// blob, so take them back out.
+		b.remove(id)
+		return 0, ErrTooFewDrives
+	}
+	return size, nil
+}
+
+// commitShard writes the header of a finished shard file and moves it into
+// place.
+func commitShard(f *os.File, header []byte, dst string) error {
+	if _, err := f.WriteAt(header, 0); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	dir := filepath.Dir(dst)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), dst); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// lock serialises the final steps of Put, Delete and Heal on one blob, so
+// a heal never brings back shards of a blob deleted under it.
+func (b *ErasureBackend) lock(id string) *sync.Mutex {
+	return &b.locks[crc32.ChecksumIEEE([]byte(id))%uint32(len(b.locks))]
+}
+
+// openShards opens every shard of a blob and returns the files that carry
+// a valid header agreeing with the first one found, along with that
+// header. The slice is indexed by shard and holds nil for shards that are
+// missing or unusable.
+func (b *ErasureBackend) openShards(id string) ([]*os.File, *shardHeader, error) {
+	files := make([]*os.File, len(b.drives))
+	var ref *shardHeader
+	found := false
+	buf := make([]byte, shardHeaderSize)
+	for i := range files {
+		f, err := os.Open(b.shardPath(id, i))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		found = true
+		if err != nil {
+			log.Printf("erasure: blob %s shard %d: %v", id, i, err)
+			continue
+		}
+		h, ok := (*shardHeader)(nil), false
+		if _, err := f.ReadAt(buf, 0); err == nil {
+			h, ok = parseShardHeader(buf)
+		}
+		if ok && h.index == i && (ref == nil || h.sameBlob(ref)) {
+			if ref == nil {
+				ref = h
+			}
+			files[i] = f
+			continue
+		}
+		f.Close()
+	}
+	if !found {
+		return nil, nil, ErrBlobNotFound
+	}
+	if ref == nil || ref.data+ref.parity != len(files) || countOpen(files) < ref.data {
+		closeShards(files)
+		return nil, nil, ErrTooFewDrives
+	}
+	return files, ref, nil
+}
+
+func (h *shardHeader) sameBlob(o *shardHeader) bool {
+	return h.data == o.data && h.parity == o.parity && h.blockSize == o.blockSize && h.size == o.size
+}
+
+func countOpen(files []*os.File) int {
+	n := 0
+	for _, f := range files {
+		if f != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func closeShards(files []*os.File) {
+	for _, f := range files {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// readFrame reads the frame of one shard for block n into buf and reports
+// whether its checksum holds.
+func readFrame(f *os.File, h *shardHeader, n int64, buf []byte) bool {
+	sl := shardLen(h.blockLen(n), h.data)
+	frame := buf[:sl+shardSumSize]
+	if _, err := f.ReadAt(frame, h.frameOffset(n)); err != nil {
+		return false
+	}
+	return binary.BigEndian.Uint32(frame[sl:]) == crc32.Checksum(frame[:sl], castagnoli)
+}
+
+func (b *ErasureBackend) Get(id string, offset int64, length int64) (io.ReadCloser, error) {
+	if !validBlobID(id) {
+		return nil, ErrInvalidBlobID
+	}
+
+	files, h, err := b.openShards(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset > h.size {
+		closeShards(files)
+		return nil, ErrInvalidRange
+	}
+	if length < 0 || offset+length > h.size {
+		length = h.size - offset
+	}
+	enc, err := b.encoder(h.data, h.parity)
+	if err != nil {
+		closeShards(files)
+		return nil, err
+	}
+
+	bufs := make([][]byte, len(files))
+	for i := range bufs {
+		bufs[i] = make([]byte, shardLen(h.blockSize, h.data)+shardSumSize)
+	}
+	return &erasureReader{
+		id:     id,
+		files:  files,
+		h:      h,
+		enc:    enc,
+		bufs:   bufs,
+		shards: make([][]byte, len(files)),
+		block:  offset / h.blockSize,
+		skip:   offset % h.blockSize,
+		remain: length,
+	}, nil
+}
+
+// erasureReader decodes a blob block by block. Data shards are read first;
+// parity is only touched when one of them is missing or fails its
+// checksum.
+type erasureReader struct {
+	id     string
+	files  []*os.File
+	h      *shardHeader
+	enc    reedsolomon.Encoder
+	bufs   [][]byte
+	shards [][]byte
+	block  int64
+	skip   int64
+	remain int64
+	out    []byte
+	buf    []byte
+}
+
+func (e *erasureReader) Read(p []byte) (int, error) {
+	if e.remain == 0 {
+		return 0, io.EOF
+	}
+	if len(e.buf) == 0 {
+		if err := e.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.buf[:min(int64(len(e.buf)), e.remain)])
+	e.buf = e.buf[n:]
+	e.remain -= int64(n)
+	return n, nil
+}
+
+func (e *erasureReader) fill() error {
+	h := e.h
+	sl := shardLen(h.blockLen(e.block), h.data)
+	// Shards the loop stops short of would otherwise still hold the
+	// previous block.
+	clear(e.shards)
+	good := 0
+	for i := range e.shards {
+		if i >= h.data && good == h.data {
+			break
+		}
+		if e.files[i] == nil {
+			continue
+		}
+		if !readFrame(e.files[i], h, e.block, e.bufs[i]) {
+			log.Printf("erasure: blob %s shard %d block %d failed its checksum", e.id, i, e.block)
+			continue
+		}
+		e.shards[i] = e.bufs[i][:sl]
+		good++
+	}
+	if good < h.data {
+		return ErrTooFewDrives
+	}
+	for i := range h.data {
+		if e.shards[i] == nil {
+			if err := e.enc.ReconstructData(e.shards); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	e.out = e.out[:0]
+	for i := range h.data {
+		e.out = append(e.out, e.shards[i]...)
+	}
+	e.buf = e.out[e.skip:h.blockLen(e.block)]
+	e.skip = 0
+	e.block++
+	return nil
+}
+
+func (e *erasureReader) Close() error {
+	closeShards(e.files)
+	return nil
+}
+
+func (b *ErasureBackend) Delete(id string) error {
+	if !validBlobID(id) {
+		return ErrInvalidBlobID
+	}
+
+	lock := b.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+	return b.remove(id)
+}
+
+func (b *ErasureBackend) remove(id string) error {
+	found := false
+	var firstErr error
+	for i := range b.drives {
+		err := os.Remove(b.shardPath(id, i))
+		switch {
+		case err == nil:
+			found = true
+		case errors.Is(err, fs.ErrNotExist):
+		case firstErr == nil:
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	if !found {
+		return ErrBlobNotFound
+	}
+	return nil
+}
+
+func (b *ErasureBackend) Stat(id string) (*BlobInfo, error) {
+	if !validBlobID(id) {
+		return nil, ErrInvalidBlobID
+	}
+
+	files, h, err := b.openShards(id)
+	if err != nil {
+		return nil, err
+	}
+	defer closeShards(files)
+	for _, f := range files {
+		if f == nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return &BlobInfo{ID: id, Size: h.size, ModTime: info.ModTime()}, nil
+	}
+	return nil, ErrBlobNotFound
+}
+
+// Heal checks every shard of a blob and rewrites the ones that are
+// missing, truncated or fail a checksum from the remaining shards. It
+// reports whether anything was rewritten.
+func (b *ErasureBackend) Heal(id string) (bool, error) {
+	if !validBlobID(id) {
+		return false, ErrInvalidBlobID
+	}
+
+	lock := b.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	files, h, err := b.openShards(id)
+	if err != nil {
+		return false, err
+	}
+	defer closeShards(files)
+	enc, err := b.encoder(h.data, h.parity)
+	if err != nil {
+		return false, err
+	}
+
+	fullShard := shardLen(h.blockSize, h.data) + shardSumSize
+	bufs := make([][]byte, len(files))
+	for i := range bufs {
+		bufs[i] = make([]byte, fullShard)
+	}
+
+	// First find the bad shards, so a shard that rots halfway through is
+	// not used to rebuild the blocks before it.
+	bad := make([]bool, len(files))
+	for i, f := range files {
+		bad[i] = f == nil
+	}
+	for n := range h.blocks() {
+		for i, f := range files {
+			if !bad[i] && !readFrame(f, h, n, bufs[i]) {
+				log.Printf("erasure: blob %s shard %d block %d failed its checksum", id, i, n)
+				bad[i] = true
+			}
+		}
+	}
+	var rebuild []int
+	for i := range bad {
+		if bad[i] {
+			rebuild = append(rebuild, i)
+		}
+	}
+	if len(rebuild) == 0 {
+		return false, nil
+	}
+	if len(rebuild) > h.parity {
+		return false, ErrTooFewDrives
+	}
+
+	out := make([]*os.File, len(files))
+	defer func() {
+		for _, f := range out {
+			if f != nil {
+				f.Close()
+				os.Remove(f.Name())
+			}
+		}
+	}()
+	for _, i := range rebuild {
+		// The drive may have been replaced with an empty one.
+		tmp := filepath.Join(b.shardDrive(id, i), tmpDirName)
+		if err := os.MkdirAll(tmp, 0o755); err != nil {
+			return false, err
+		}
+		f, err := os.CreateTemp(tmp, id+"-*")
+		if err != nil {
+			return false, err
+		}
+		out[i] = f
+	}
+
+	shards := make([][]byte, len(files))
+	frame := make([]byte, 0, fullShard)
+	for n := range h.blocks() {
+		sl := shardLen(h.blockLen(n), h.data)
+		for i, f := range files {
+			shards[i] = nil
+			if !bad[i] {
+				if !readFrame(f, h, n, bufs[i]) {
+					return false, fmt.Errorf("erasure: blob %s shard %d changed during heal", id, i)
+				}
+				shards[i] = bufs[i][:sl]
+			}
+		}
+		if err := enc.Reconstruct(shards); err != nil {
+			return false, err
+		}
+		for _, i := range rebuild {
+			frame = binary.BigEndian.AppendUint32(append(frame[:0], shards[i]...), crc32.Checksum(shards[i], castagnoli))
+			if _, err := out[i].WriteAt(frame, h.frameOffset(n)); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	for _, i := range rebuild {
+		hi := *h
+		hi.index = i
+		if err := commitShard(out[i], hi.marshal(), b.shardPath(id, i)); err != nil {
+			return false, err
+		}
+		out[i] = nil
+	}
+	return true, nil
+}
+
+// HealResult summarises a HealAll run.
+type HealResult struct {
+	Scanned int `json:"scanned"`
+	Healed  int `json:"healed"`
+	Failed  int `json:"failed"`
+}
+
+// HealAll heals every blob that has a shard on any drive.
+func (b *ErasureBackend) HealAll() (*HealResult, error) {
+	ids := make(map[string]struct{})
+	for _, drive := range b.drives {
+		err := filepath.WalkDir(drive, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if d.Name() == tmpDirName {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if validBlobID(d.Name()) {
+				ids[d.Name()] = struct{}{}
+			}
+			return nil
+		})
+		if err != nil {
+			// A missing drive is exactly what heal is for; keep going
+			// with the others.
+			log.Printf("erasure: scan %s: %v", drive, err)
+		}
+	}
+
+	res := &HealResult{}
+	for id := range ids {
+		res.Scanned++
+		healed, err := b.Heal(id)
+		switch {
+		case errors.Is(err, ErrBlobNotFound):
+			// Deleted since the scan.
+		case err != nil:
+			log.Printf("erasure: heal %s: %v", id, err)
+			res.Failed++
+		case healed:
+			res.Healed++
+		}
+	}
+	return res, nil
+}
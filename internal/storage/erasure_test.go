@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readErasure(t *testing.T, b *ErasureBackend, id string, offset int64, length int64) []byte {
+	t.Helper()
+	rc, err := b.Get(id, offset, length)
+	if err != nil {
+		t.Fatalf("Get(%d, %d): %v", offset, length, err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("ReadAll(%d, %d): %v", offset, length, err)
+	}
+	return got
+}
+
+func TestErasureBackend(t *testing.T) {
+	drives := make([]string, 6)
+	for i := range drives {
+		drives[i] = filepath.Join(t.TempDir(), "drive")
+	}
+	b, err := NewErasureBackend(drives, 2)
+	if err != nil {
+		t.Fatalf("NewErasureBackend: %v", err)
+	}
+
+	data := make([]byte, 2*erasureBlockSize+12345)
+	rand.New(rand.NewSource(1)).Read(data)
+	size := int64(len(data))
+	id := NewBlobID()
+	if n, err := b.Put(id, bytes.NewReader(data)); err != nil || n != size {
+		t.Fatalf("Put = %d, %v", n, err)
+	}
+	if info, err := b.Stat(id); err != nil || info.Size != size {
+		t.Fatalf("Stat = %+v, %v", info, err)
+	}
+
+	tests := []struct {
+		offset, length int64
+	}{
+		{0, -1},
+		{0, 10},
+		{erasureBlockSize - 5, 10},
+		{erasureBlockSize, erasureBlockSize},
+		{size - 1, 1},
+		{size, 0},
+	}
+	check := func(stage string) {
+		t.Helper()
+		for _, tt := range tests {
+			want := data[tt.offset:]
+			if tt.length >= 0 {
+				want = want[:tt.length]
+			}
+			if got := readErasure(t, b, id, tt.offset, tt.length); !bytes.Equal(got, want) {
+				t.Errorf("%s: Get(%d, %d) returned the wrong bytes", stage, tt.offset, tt.length)
+			}
+		}
+	}
+	check("intact")
+
+	// Lose one shard and flip a byte in another: two failures are within
+	// the parity budget.
+	if err := os.Remove(b.shardPath(id, 0)); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := b.shardPath(id, 3)
+	raw, err := os.ReadFile(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[shardHeaderSize+erasureBlockSize/8]++
+	if err := os.WriteFile(corrupt, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	check("degraded")
+
+	healed, err := b.Heal(id)
+	if err != nil || !healed {
+		t.Fatalf("Heal = %v, %v; want true", healed, err)
+	}
+	if healed, err := b.Heal(id); err != nil || healed {
+		t.Fatalf("second Heal = %v, %v; want false", healed, err)
+	}
+
+	// After healing, any two other shards can go.
+	for _, i := range []int{4, 5} {
+		if err := os.Remove(b.shardPath(id, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("healed")
+
+	res, err := b.HealAll()
+	if err != nil || res.Scanned != 1 || res.Healed != 1 || res.Failed != 0 {
+		t.Fatalf("HealAll = %+v, %v", res, err)
+	}
+
+	// Three lost shards is one more than parity can cover.
+	for _, i := range []int{0, 1, 2} {
+		if err := os.Remove(b.shardPath(id, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := b.Get(id, 0, -1); !errors.Is(err, ErrTooFewDrives) {
+		t.Errorf("Get with three shards lost: got %v; want ErrTooFewDrives", err)
+	}
+
+	if err := b.Delete(id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := b.Stat(id); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Stat after Delete: got %v; want ErrBlobNotFound", err)
+	}
+}
+
+// A block that needs reconstructing must not see shards left over from
+// an earlier block, which would not even be the same size as the last one.
+func TestErasureReconstructAfterDegradedBlock(t *testing.T) {
+	drives := make([]string, 7)
+	for i := range drives {
+		drives[i] = filepath.Join(t.TempDir(), "drive")
+	}
+	b, err := NewErasureBackend(drives, 3)
+	if err != nil {
+		t.Fatalf("NewErasureBackend: %v", err)
+	}
+
+	data := make([]byte, erasureBlockSize+12345)
+	rand.New(rand.NewSource(2)).Read(data)
+	id := NewBlobID()
+	if _, err := b.Put(id, bytes.NewReader(data)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// The first block is read from every parity shard, the second from
+	// one of them.
+	for i := range 3 {
+		path := b.shardPath(id, i)
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw[shardHeaderSize+erasureBlockSize/8]++
+		if i == 0 {
+			raw[len(raw)-1]++
+		}
+		if err := os.WriteFile(path, raw, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readErasure(t, b, id, 0, -1); !bytes.Equal(got, data) {
+		t.Errorf("Get returned the wrong bytes")
+	}
+}
@@ -0,0 +1,9 @@
+package storage
+
+import "errors"
+
+var (
+	ErrBlobNotFound  = errors.New("blob not found")
+	ErrInvalidBlobID = errors.New("invalid blob id")
+	ErrInvalidRange  = errors.New("invalid range")
+)
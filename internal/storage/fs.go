@@ -1 +1,172 @@
 package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const tmpDirName = ".tmp"
+
+// FSBackend keeps each blob in its own file under root, sharded by the first
+// characters of the blob ID so no single directory grows unbounded.
+type FSBackend struct {
+	root string
+}
+
+func InitFS(root string) {
+	backend, err := NewFSBackend(root)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	Blobs = backend
+}
+
+func NewFSBackend(root string) (*FSBackend, error) {
+	tmp := filepath.Join(root, tmpDirName)
+	// Anything left in the temp dir is from a write that never got renamed
+	// into place, so it is safe to throw away.
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return nil, err
+	}
+	return &FSBackend{root: root}, nil
+}
+
+func (b *FSBackend) path(id string) string {
+	return filepath.Join(b.root, id[0:2], id[2:4], id)
+}
+
+func (b *FSBackend) Put(id string, r io.Reader) (int64, error) {
+	if !validBlobID(id) {
+		return 0, ErrInvalidBlobID
+	}
+
+	f, err := os.CreateTemp(filepath.Join(b.root, tmpDirName), id+"-*")
+	if err != nil {
+		return 0, err
+	}
+	tmpName := f.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			f.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+
+	dst := b.path(id)
+	dir := filepath.Dir(dst)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpName, dst); err != nil {
+		return 0, err
+	}
+	committed = true
+
+	// The rename is only durable once the directory entry itself is synced.
+	if err := syncDir(dir); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (b *FSBackend) Get(id string, offset int64, length int64) (io.ReadCloser, error) {
+	if !validBlobID(id) {
+		return nil, ErrInvalidBlobID
+	}
+
+	f, err := os.Open(b.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if offset < 0 || offset > info.Size() {
+		f.Close()
+		return nil, ErrInvalidRange
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if length < 0 || offset+length > info.Size() {
+		length = info.Size() - offset
+	}
+
+	return &limitedFile{Reader: io.LimitReader(f, length), f: f}, nil
+}
+
+func (b *FSBackend) Delete(id string) error {
+	if !validBlobID(id) {
+		return ErrInvalidBlobID
+	}
+
+	err := os.Remove(b.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrBlobNotFound
+	}
+	return err
+}
+
+func (b *FSBackend) Stat(id string) (*BlobInfo, error) {
+	if !validBlobID(id) {
+		return nil, ErrInvalidBlobID
+	}
+
+	info, err := os.Stat(b.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &BlobInfo{
+		ID:      id,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+type limitedFile struct {
+	io.Reader
+	f *os.File
+}
+
+func (l *limitedFile) Close() error {
+	return l.f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
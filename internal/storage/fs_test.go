@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFSBackend(t *testing.T) {
+	root := t.TempDir()
+	b, err := NewFSBackend(root)
+	if err != nil {
+		t.Fatalf("NewFSBackend: %v", err)
+	}
+
+	id := NewBlobID()
+	data := []byte("hello, doss")
+
+	n, err := b.Put(id, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("Put wrote %d bytes; want %d", n, len(data))
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, tmpDirName))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected temp dir to be empty after Put; got %d entries", len(entries))
+	}
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "hello, doss"},
+		{7, -1, "doss"},
+		{0, 5, "hello"},
+		{7, 100, "doss"},
+		{11, -1, ""},
+	}
+	for _, tt := range tests {
+		rc, err := b.Get(id, tt.offset, tt.length)
+		if err != nil {
+			t.Fatalf("Get(%d, %d): %v", tt.offset, tt.length, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("ReadAll: %v", err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Get(%d, %d) = %q; want %q", tt.offset, tt.length, got, tt.want)
+		}
+	}
+
+	if _, err := b.Get(id, 12, -1); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("Get past end: got %v; want ErrInvalidRange", err)
+	}
+
+	info, err := b.Stat(id)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Errorf("Stat size = %d; want %d", info.Size, len(data))
+	}
+
+	if err := b.Delete(id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := b.Stat(id); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Stat after Delete: got %v; want ErrBlobNotFound", err)
+	}
+	if err := b.Delete(id); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("second Delete: got %v; want ErrBlobNotFound", err)
+	}
+
+	if _, err := b.Put("../../etc/passwd", bytes.NewReader(data)); !errors.Is(err, ErrInvalidBlobID) {
+		t.Errorf("Put with traversal id: got %v; want ErrInvalidBlobID", err)
+	}
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"time"
+)
+
+// Backend stores immutable blobs addressed by opaque IDs. Object metadata
+// lives in Badger; a backend only ever sees the bytes.
+type Backend interface {
+	// Put stores the contents of r under id, replacing any existing blob,
+	// and returns the number of bytes written.
+	Put(id string, r io.Reader) (int64, error)
+	// Get streams length bytes of the blob starting at offset. A negative
+	// length reads to the end of the blob.
+	Get(id string, offset int64, length int64) (io.ReadCloser, error)
+	Delete(id string) error
+	Stat(id string) (*BlobInfo, error)
+}
+
+// Healer is implemented by backends that keep redundant copies of a blob
+// and can rebuild the ones that are lost or damaged.
+type Healer interface {
+	HealAll() (*HealResult, error)
+}
+
+type BlobInfo struct {
+	ID      string
+	Size    int64
+	ModTime time.Time
+}
+
+var Blobs Backend
+
+// NewBlobID returns a random identifier suitable for any Backend.
+func NewBlobID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func validBlobID(id string) bool {
+	if len(id) < 4 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}